@@ -16,6 +16,7 @@ package aws
 
 import (
 	"context"
+	"slices"
 	"strings"
 	"time"
 
@@ -155,3 +156,98 @@ func (c *Clients) SetDesiredCapacity(ctx context.Context, asg *at.AutoScalingGro
 	_, err := c.ASGClient.SetDesiredCapacity(ctx, &input)
 	return errors.Wrapf(err, "error setting desired capacity for %s", *asg.AutoScalingGroupName)
 }
+
+// SuspendProcesses suspends the given scaling processes on the ASG
+func (c *Clients) SuspendProcesses(ctx context.Context, asgName string, processes []string) error {
+	input := autoscaling.SuspendProcessesInput{
+		AutoScalingGroupName: &asgName,
+		ScalingProcesses:     processes,
+	}
+	_, err := c.ASGClient.SuspendProcesses(ctx, &input)
+	return errors.Wrapf(err, "error suspending processes for %s", asgName)
+}
+
+// ResumeProcesses resumes the given scaling processes on the ASG
+func (c *Clients) ResumeProcesses(ctx context.Context, asgName string, processes []string) error {
+	input := autoscaling.ResumeProcessesInput{
+		AutoScalingGroupName: &asgName,
+		ScalingProcesses:     processes,
+	}
+	_, err := c.ASGClient.ResumeProcesses(ctx, &input)
+	return errors.Wrapf(err, "error resuming processes for %s", asgName)
+}
+
+// SetInstanceProtection turns scale-in protection on or off for the given instances in the ASG
+func (c *Clients) SetInstanceProtection(ctx context.Context, asgName string, instanceIDs []string, protected bool) error {
+	input := autoscaling.SetInstanceProtectionInput{
+		AutoScalingGroupName: &asgName,
+		InstanceIds:          instanceIDs,
+		ProtectedFromScaleIn: &protected,
+	}
+	_, err := c.ASGClient.SetInstanceProtection(ctx, &input)
+	return errors.Wrapf(err, "error setting scale-in protection to %t for %v in %s", protected, instanceIDs, asgName)
+}
+
+// standbyChunk is how many instance IDs EnterStandby and ExitStandby take in each call
+const standbyChunk = 20
+
+// EnterStandby moves the given InService instances of the ASG to Standby, optionally decrementing its desired
+// capacity so they aren't replaced
+func (c *Clients) EnterStandby(ctx context.Context, asgName string, instanceIDs []string, decrement bool) error {
+	for chunk := range slices.Chunk(instanceIDs, standbyChunk) {
+		input := autoscaling.EnterStandbyInput{
+			AutoScalingGroupName:           &asgName,
+			InstanceIds:                    chunk,
+			ShouldDecrementDesiredCapacity: &decrement,
+		}
+		_, err := c.ASGClient.EnterStandby(ctx, &input)
+		if err != nil {
+			return errors.Wrapf(err, "error moving %v in %s to standby", chunk, asgName)
+		}
+	}
+	return nil
+}
+
+// ExitStandby moves the given Standby instances of the ASG back into service, incrementing its desired capacity
+func (c *Clients) ExitStandby(ctx context.Context, asgName string, instanceIDs []string) error {
+	for chunk := range slices.Chunk(instanceIDs, standbyChunk) {
+		input := autoscaling.ExitStandbyInput{
+			AutoScalingGroupName: &asgName,
+			InstanceIds:          chunk,
+		}
+		_, err := c.ASGClient.ExitStandby(ctx, &input)
+		if err != nil {
+			return errors.Wrapf(err, "error moving %v in %s out of standby", chunk, asgName)
+		}
+	}
+	return nil
+}
+
+// GetWarmPool returns every instance in the ASG's warm pool
+func (c *Clients) GetWarmPool(ctx context.Context, asgName string) ([]at.Instance, error) {
+	var nexttoken *string
+	var insts []at.Instance
+
+	for {
+		input := &autoscaling.DescribeWarmPoolInput{
+			AutoScalingGroupName: &asgName,
+			NextToken:            nexttoken,
+		}
+
+		output, err := c.ASGClient.DescribeWarmPool(ctx, input)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error describing warm pool of %s", asgName)
+		}
+
+		insts = append(insts, output.Instances...)
+		nexttoken = output.NextToken
+
+		if nexttoken == nil {
+			break
+		} else {
+			time.Sleep(apiSleepTime)
+		}
+	}
+
+	return insts, nil
+}
@@ -18,76 +18,173 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"slices"
 	"strconv"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
 	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	et "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancing"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/pkg/errors"
 )
 
 const apiSleepTime = 200 * time.Millisecond
 
+// ASGAPI is the subset of the autoscaling API that bouncer calls
+type ASGAPI interface {
+	DescribeAutoScalingGroups(ctx context.Context, params *autoscaling.DescribeAutoScalingGroupsInput, optFns ...func(*autoscaling.Options)) (*autoscaling.DescribeAutoScalingGroupsOutput, error)
+	DescribeLaunchConfigurations(ctx context.Context, params *autoscaling.DescribeLaunchConfigurationsInput, optFns ...func(*autoscaling.Options)) (*autoscaling.DescribeLaunchConfigurationsOutput, error)
+	CompleteLifecycleAction(ctx context.Context, params *autoscaling.CompleteLifecycleActionInput, optFns ...func(*autoscaling.Options)) (*autoscaling.CompleteLifecycleActionOutput, error)
+	TerminateInstanceInAutoScalingGroup(ctx context.Context, params *autoscaling.TerminateInstanceInAutoScalingGroupInput, optFns ...func(*autoscaling.Options)) (*autoscaling.TerminateInstanceInAutoScalingGroupOutput, error)
+	SetDesiredCapacity(ctx context.Context, params *autoscaling.SetDesiredCapacityInput, optFns ...func(*autoscaling.Options)) (*autoscaling.SetDesiredCapacityOutput, error)
+	StartInstanceRefresh(ctx context.Context, params *autoscaling.StartInstanceRefreshInput, optFns ...func(*autoscaling.Options)) (*autoscaling.StartInstanceRefreshOutput, error)
+	DescribeInstanceRefreshes(ctx context.Context, params *autoscaling.DescribeInstanceRefreshesInput, optFns ...func(*autoscaling.Options)) (*autoscaling.DescribeInstanceRefreshesOutput, error)
+	CancelInstanceRefresh(ctx context.Context, params *autoscaling.CancelInstanceRefreshInput, optFns ...func(*autoscaling.Options)) (*autoscaling.CancelInstanceRefreshOutput, error)
+	RollbackInstanceRefresh(ctx context.Context, params *autoscaling.RollbackInstanceRefreshInput, optFns ...func(*autoscaling.Options)) (*autoscaling.RollbackInstanceRefreshOutput, error)
+	SuspendProcesses(ctx context.Context, params *autoscaling.SuspendProcessesInput, optFns ...func(*autoscaling.Options)) (*autoscaling.SuspendProcessesOutput, error)
+	ResumeProcesses(ctx context.Context, params *autoscaling.ResumeProcessesInput, optFns ...func(*autoscaling.Options)) (*autoscaling.ResumeProcessesOutput, error)
+	SetInstanceProtection(ctx context.Context, params *autoscaling.SetInstanceProtectionInput, optFns ...func(*autoscaling.Options)) (*autoscaling.SetInstanceProtectionOutput, error)
+	EnterStandby(ctx context.Context, params *autoscaling.EnterStandbyInput, optFns ...func(*autoscaling.Options)) (*autoscaling.EnterStandbyOutput, error)
+	ExitStandby(ctx context.Context, params *autoscaling.ExitStandbyInput, optFns ...func(*autoscaling.Options)) (*autoscaling.ExitStandbyOutput, error)
+	DescribeWarmPool(ctx context.Context, params *autoscaling.DescribeWarmPoolInput, optFns ...func(*autoscaling.Options)) (*autoscaling.DescribeWarmPoolOutput, error)
+}
+
+// EC2API is the subset of the EC2 API that bouncer calls
+type EC2API interface {
+	DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error)
+	DescribeInstanceAttribute(ctx context.Context, params *ec2.DescribeInstanceAttributeInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceAttributeOutput, error)
+	DescribeLaunchTemplates(ctx context.Context, params *ec2.DescribeLaunchTemplatesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeLaunchTemplatesOutput, error)
+}
+
+// ELBV2API is the subset of the elasticloadbalancingv2 API that bouncer calls
+type ELBV2API interface {
+	DescribeTargetHealth(ctx context.Context, params *elasticloadbalancingv2.DescribeTargetHealthInput, optFns ...func(*elasticloadbalancingv2.Options)) (*elasticloadbalancingv2.DescribeTargetHealthOutput, error)
+	DescribeTargetGroups(ctx context.Context, params *elasticloadbalancingv2.DescribeTargetGroupsInput, optFns ...func(*elasticloadbalancingv2.Options)) (*elasticloadbalancingv2.DescribeTargetGroupsOutput, error)
+}
+
+// ELBAPI is the subset of the classic elasticloadbalancing API that bouncer calls
+type ELBAPI interface {
+	DescribeInstanceHealth(ctx context.Context, params *elasticloadbalancing.DescribeInstanceHealthInput, optFns ...func(*elasticloadbalancing.Options)) (*elasticloadbalancing.DescribeInstanceHealthOutput, error)
+}
+
 // Clients holds the clients for this account's invocation of the APIs we'll need
 type Clients struct {
-	ASGClient *autoscaling.Client
-	EC2Client *ec2.Client
+	ASGClient   ASGAPI
+	EC2Client   EC2API
+	ELBV2Client ELBV2API
+	ELBClient   ELBAPI
 }
 
+// ClientOpts picks the account and region the clients talk to.  Each zero-valued field falls back to the default
+// credential chain and AWS_DEFAULT_REGION
+type ClientOpts struct {
+	Region  string
+	Profile string
+	// AssumeRoleARN, if set, is assumed using the credentials from Profile or the default chain
+	AssumeRoleARN   string
+	ExternalID      string
+	RoleSessionName string
+}
+
+const (
+	defaultRegion          = "us-east-1"
+	defaultRoleSessionName = "bouncer"
+)
+
 // GetAWSClients returns the AWS client objects we'll need
-func GetAWSClients(ctx context.Context) (*Clients, error) {
-	region := os.Getenv("AWS_DEFAULT_REGION")
+func GetAWSClients(ctx context.Context, opts ClientOpts) (*Clients, error) {
+	region := opts.Region
 	if region == "" {
-		region = "us-east-1"
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = defaultRegion
 	}
 
-	cfg, err := config.LoadDefaultConfig(ctx,
+	loadOpts := []func(*config.LoadOptions) error{
 		config.WithRegion(region),
 		config.WithRetryer(func() aws.Retryer {
 			return retry.AddWithMaxAttempts(retry.NewStandard(), 20)
 		}),
-	)
+	}
+	if opts.Profile != "" {
+		loadOpts = append(loadOpts, config.WithSharedConfigProfile(opts.Profile))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, loadOpts...)
 	if err != nil {
 		return nil, errors.Wrap(err, "Error opening default AWS config")
 	}
 
+	if opts.AssumeRoleARN != "" {
+		sessionName := opts.RoleSessionName
+		if sessionName == "" {
+			sessionName = defaultRoleSessionName
+		}
+
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), opts.AssumeRoleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = sessionName
+			if opts.ExternalID != "" {
+				o.ExternalID = aws.String(opts.ExternalID)
+			}
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+
 	asg := autoscaling.NewFromConfig(cfg)
 	ec2 := ec2.NewFromConfig(cfg)
 
 	ac := Clients{
-		ASGClient: asg,
-		EC2Client: ec2,
+		ASGClient:   asg,
+		EC2Client:   ec2,
+		ELBV2Client: elasticloadbalancingv2.NewFromConfig(cfg),
+		ELBClient:   elasticloadbalancing.NewFromConfig(cfg),
 	}
 
 	return &ac, nil
 }
 
-// ASGInstToEC2Inst converts a *autoscaling.Instance to its corresponding *ec2.Instance
-func (c *Clients) ASGInstToEC2Inst(ctx context.Context, inst at.Instance) (*et.Instance, error) {
-	input := ec2.DescribeInstancesInput{
-		InstanceIds: []string{*inst.InstanceId},
-	}
-	output, err := c.EC2Client.DescribeInstances(ctx, &input)
-	if err != nil {
-		return nil, errors.Wrapf(err, "Error describing instance %s", *inst.InstanceId)
-	}
-
-	for _, res := range output.Reservations {
-		if len(res.Instances) > 1 {
-			return nil, errors.New("More than 1 instance found somehow")
+// describeInstancesChunk is how many instance IDs are asked for in each DescribeInstances call
+const describeInstancesChunk = 1000
+
+// GetEC2Instances returns the *ec2.Instance for each of the given instance IDs, keyed by ID.  They're described
+// together, a page at a time, rather than with a call per instance
+func (c *Clients) GetEC2Instances(ctx context.Context, instanceIDs []string) (map[string]*et.Instance, error) {
+	ec2Insts := make(map[string]*et.Instance, len(instanceIDs))
+
+	for chunk := range slices.Chunk(instanceIDs, describeInstancesChunk) {
+		paginator := ec2.NewDescribeInstancesPaginator(c.EC2Client, &ec2.DescribeInstancesInput{
+			InstanceIds: chunk,
+		})
+		for paginator.HasMorePages() {
+			output, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Error describing %d instances", len(chunk))
+			}
+
+			for _, res := range output.Reservations {
+				for _, ec2Inst := range res.Instances {
+					ec2Insts[*ec2Inst.InstanceId] = &ec2Inst
+				}
+			}
 		}
+	}
 
-		for _, ec2Inst := range res.Instances {
-			return &ec2Inst, nil
+	for _, id := range instanceIDs {
+		if ec2Insts[id] == nil {
+			return nil, errors.Errorf("No instances found for %s", id)
 		}
 	}
 
-	return nil, errors.Errorf("No instances found for %s", *inst.InstanceId)
+	return ec2Insts, nil
 }
 
 // ASGLTplVersionToEC2LTplVersion resolves ASG Template Versions to its actual *int32 ec2LaunchTemplate Version
@@ -97,28 +194,11 @@ func (c Clients) ASGLTplVersionToEC2LTplVersion(ctx context.Context, asgLaunchTe
 		return nil, nil
 	}
 
-	input := &ec2.DescribeLaunchTemplatesInput{
-		LaunchTemplateIds: []string{
-			*asgLaunchTemplate.LaunchTemplateId,
-		},
-	}
-
-	res, err := c.EC2Client.DescribeLaunchTemplates(ctx, input)
+	ec2LaunchTemplate, err := c.GetLaunchTemplate(ctx, asgLaunchTemplate)
 	if err != nil {
-		return nil, errors.Wrapf(err, "Error describing LaunchTemplate %s", *asgLaunchTemplate.LaunchTemplateId)
-	}
-
-	if len(res.LaunchTemplates) != 1 {
-		return nil, errors.Wrapf(err,
-			"Expected exactly one LaunchTemplate returned for launch template id %s, got %d: %v",
-			*asgLaunchTemplate.LaunchTemplateId,
-			len(res.LaunchTemplates),
-			res.LaunchTemplates,
-		)
+		return nil, err
 	}
 
-	ec2LaunchTemplate := res.LaunchTemplates[0]
-
 	targetVersion := asgLaunchTemplate.Version
 
 	// Per https://docs.aws.amazon.com/autoscaling/ec2/APIReference/API_LaunchTemplateSpecification.html
@@ -138,3 +218,28 @@ func (c Clients) ASGLTplVersionToEC2LTplVersion(ctx context.Context, asgLaunchTe
 	}
 
 }
+
+// GetLaunchTemplate returns the *ec2.LaunchTemplate an ASG's launch template spec points to
+func (c Clients) GetLaunchTemplate(ctx context.Context, asgLaunchTemplate *at.LaunchTemplateSpecification) (*et.LaunchTemplate, error) {
+	input := &ec2.DescribeLaunchTemplatesInput{
+		LaunchTemplateIds: []string{
+			*asgLaunchTemplate.LaunchTemplateId,
+		},
+	}
+
+	res, err := c.EC2Client.DescribeLaunchTemplates(ctx, input)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error describing LaunchTemplate %s", *asgLaunchTemplate.LaunchTemplateId)
+	}
+
+	if len(res.LaunchTemplates) != 1 {
+		return nil, errors.Errorf(
+			"Expected exactly one LaunchTemplate returned for launch template id %s, got %d: %v",
+			*asgLaunchTemplate.LaunchTemplateId,
+			len(res.LaunchTemplates),
+			res.LaunchTemplates,
+		)
+	}
+
+	return &res.LaunchTemplates[0], nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancing"
+	lt "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancing/types"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	tt "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	"github.com/pkg/errors"
+)
+
+// GetTargetHealth returns the health of every target registered with the target group
+func (c *Clients) GetTargetHealth(ctx context.Context, targetGroupARN string) ([]tt.TargetHealthDescription, error) {
+	input := elasticloadbalancingv2.DescribeTargetHealthInput{
+		TargetGroupArn: &targetGroupARN,
+	}
+
+	output, err := c.ELBV2Client.DescribeTargetHealth(ctx, &input)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error describing target health for %s", targetGroupARN)
+	}
+
+	return output.TargetHealthDescriptions, nil
+}
+
+// GetTargetGroups returns the target groups with the given ARNs
+func (c *Clients) GetTargetGroups(ctx context.Context, targetGroupARNs []string) ([]tt.TargetGroup, error) {
+	var groups []tt.TargetGroup
+	paginator := elasticloadbalancingv2.NewDescribeTargetGroupsPaginator(c.ELBV2Client, &elasticloadbalancingv2.DescribeTargetGroupsInput{
+		TargetGroupArns: targetGroupARNs,
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error describing target groups")
+		}
+		groups = append(groups, output.TargetGroups...)
+	}
+
+	return groups, nil
+}
+
+// GetELBInstanceHealth returns the state of every instance registered with the classic ELB
+func (c *Clients) GetELBInstanceHealth(ctx context.Context, loadBalancerName string) ([]lt.InstanceState, error) {
+	input := elasticloadbalancing.DescribeInstanceHealthInput{
+		LoadBalancerName: &loadBalancerName,
+	}
+
+	output, err := c.ELBClient.DescribeInstanceHealth(ctx, &input)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error describing instance health for ELB %s", loadBalancerName)
+	}
+
+	return output.InstanceStates, nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/pkg/errors"
+)
+
+// StartInstanceRefresh calls https://docs.aws.amazon.com/cli/latest/reference/autoscaling/start-instance-refresh.html and returns the refresh's ID
+func (c *Clients) StartInstanceRefresh(ctx context.Context, asgName *string, prefs *at.RefreshPreferences) (*string, error) {
+	input := autoscaling.StartInstanceRefreshInput{
+		AutoScalingGroupName: asgName,
+		Preferences:          prefs,
+		Strategy:             at.RefreshStrategyRolling,
+	}
+	output, err := c.ASGClient.StartInstanceRefresh(ctx, &input)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error starting instance refresh for %s", *asgName)
+	}
+	return output.InstanceRefreshId, nil
+}
+
+// GetInstanceRefreshes returns the most recent instance refreshes of the ASG, newest first
+func (c *Clients) GetInstanceRefreshes(ctx context.Context, asgName *string) ([]at.InstanceRefresh, error) {
+	input := autoscaling.DescribeInstanceRefreshesInput{
+		AutoScalingGroupName: asgName,
+	}
+	output, err := c.ASGClient.DescribeInstanceRefreshes(ctx, &input)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error describing instance refreshes for %s", *asgName)
+	}
+	return output.InstanceRefreshes, nil
+}
+
+// GetInstanceRefresh returns the instance refresh of the ASG with the given ID
+func (c *Clients) GetInstanceRefresh(ctx context.Context, asgName *string, refreshID *string) (*at.InstanceRefresh, error) {
+	input := autoscaling.DescribeInstanceRefreshesInput{
+		AutoScalingGroupName: asgName,
+		InstanceRefreshIds:   []string{*refreshID},
+	}
+	output, err := c.ASGClient.DescribeInstanceRefreshes(ctx, &input)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error describing instance refresh %s for %s", *refreshID, *asgName)
+	}
+
+	if len(output.InstanceRefreshes) != 1 {
+		return nil, errors.Errorf("Instance refresh %s for %s matched %d refreshes, expecting it to match 1", *refreshID, *asgName, len(output.InstanceRefreshes))
+	}
+
+	return &output.InstanceRefreshes[0], nil
+}
+
+// CancelInstanceRefresh calls https://docs.aws.amazon.com/cli/latest/reference/autoscaling/cancel-instance-refresh.html
+func (c *Clients) CancelInstanceRefresh(ctx context.Context, asgName *string) error {
+	input := autoscaling.CancelInstanceRefreshInput{
+		AutoScalingGroupName: asgName,
+	}
+	_, err := c.ASGClient.CancelInstanceRefresh(ctx, &input)
+	return errors.Wrapf(err, "error cancelling instance refresh for %s", *asgName)
+}
+
+// RollbackInstanceRefresh calls https://docs.aws.amazon.com/cli/latest/reference/autoscaling/rollback-instance-refresh.html
+func (c *Clients) RollbackInstanceRefresh(ctx context.Context, asgName *string) error {
+	input := autoscaling.RollbackInstanceRefreshInput{
+		AutoScalingGroupName: asgName,
+	}
+	_, err := c.ASGClient.RollbackInstanceRefresh(ctx, &input)
+	return errors.Wrapf(err, "error rolling back instance refresh for %s", *asgName)
+}
+
+// IsInstanceRefreshActive returns whether the refresh is still going, or still winding down after being cancelled or rolled back
+func IsInstanceRefreshActive(status at.InstanceRefreshStatus) bool {
+	switch status {
+	case at.InstanceRefreshStatusPending,
+		at.InstanceRefreshStatusInProgress,
+		at.InstanceRefreshStatusCancelling,
+		at.InstanceRefreshStatusRollbackInProgress,
+		at.InstanceRefreshStatusBaking:
+		return true
+	}
+	return false
+}
@@ -16,7 +16,6 @@ package batchcanary
 
 import (
 	"context"
-	"strings"
 
 	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
 	"github.com/palantir/bouncer/bouncer"
@@ -24,8 +23,11 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// Mode is the name this runner is invoked by
+const Mode = "batch-canary"
+
 // Runner holds data for a particular batch-canary run
-// Note that in the batch-canary case, asgs will always be of length 1
+// Note that in the batch-canary case, every ASG given is bounced as one pool, e.g. per-AZ ASGs of the same service
 type Runner struct {
 	bouncer.BaseRunner
 	batchSize int32 // This field is set in ValidatePrereqs
@@ -33,29 +35,13 @@ type Runner struct {
 
 // NewRunner instantiates a new batch-canary runner
 func NewRunner(ctx context.Context, opts *bouncer.RunnerOpts) (*Runner, error) {
-	br, err := bouncer.NewBaseRunner(ctx, opts)
+	br, err := bouncer.NewBaseRunner(ctx, Mode, opts)
 	if err != nil {
 		return nil, errors.Wrap(err, "error getting base runner")
 	}
 
-	batchSize := *opts.BatchSize
-
-	if batchSize == 0 {
-		if len(strings.Split(opts.AsgString, ",")) > 1 {
-			return nil, errors.New("Batch canary mode supports only 1 ASG at a time")
-		}
-
-		da, err := bouncer.ExtractDesiredASG(opts.AsgString, nil, nil)
-		if err != nil {
-			return nil, err
-		}
-
-		batchSize = da.DesiredCapacity
-	}
-
 	r := Runner{
 		BaseRunner: *br,
-		batchSize:  batchSize,
 	}
 	return &r, nil
 }
@@ -67,43 +53,8 @@ func (r *Runner) ValidatePrereqs(ctx context.Context) error {
 		return errors.Wrap(err, "error building actualASG")
 	}
 
-	if len(asgSet.ASGs) > 1 {
-		log.WithFields(log.Fields{
-			"count given": len(asgSet.ASGs),
-		}).Error("Batch Canary mode supports only 1 ASG at a time")
-		return errors.New("error validating ASG input")
-	}
-
-	for _, actualAsg := range asgSet.ASGs {
-		if actualAsg.DesiredASG.DesiredCapacity != *actualAsg.ASG.DesiredCapacity {
-			log.WithFields(log.Fields{
-				"desired capacity given":  actualAsg.DesiredASG.DesiredCapacity,
-				"desired capacity actual": *actualAsg.ASG.DesiredCapacity,
-			}).Error("Desired capacity given must be equal to starting desired_capacity of ASG")
-			return errors.New("error validating ASG state")
-		}
-
-		if actualAsg.DesiredASG.DesiredCapacity < *actualAsg.ASG.MinSize {
-			log.WithFields(log.Fields{
-				"min size":         *actualAsg.ASG.MinSize,
-				"max size":         *actualAsg.ASG.MaxSize,
-				"desired capacity": actualAsg.DesiredASG.DesiredCapacity,
-			}).Error("Desired capacity given must be greater than or equal to min ASG size")
-			return errors.New("error validating ASG state")
-		}
-
-		if *actualAsg.ASG.MaxSize < (actualAsg.DesiredASG.DesiredCapacity + r.batchSize) {
-			log.WithFields(log.Fields{
-				"min size":         *actualAsg.ASG.MinSize,
-				"max size":         *actualAsg.ASG.MaxSize,
-				"desired capacity": actualAsg.DesiredASG.DesiredCapacity,
-				"batch size":       r.batchSize,
-			}).Error("Max capacity of ASG must be >= desired capacity + batch size")
-			return errors.New("error validating ASG state")
-		}
-	}
-
-	return nil
+	r.batchSize, err = r.ValidatePoolPrereqs(asgSet)
+	return err
 }
 
 // Run has the meat of the batch job
@@ -122,10 +73,8 @@ func (r *Runner) Run() error {
 			return errors.Wrap(err, "error building ASGSet")
 		}
 
-		// Since we only support one ASG in batch-canary mode
-		asg := asgSet.ASGs[0]
-		curDesiredCapacity := *asg.ASG.DesiredCapacity
-		finDesiredCapacity := asg.DesiredASG.DesiredCapacity
+		// Every ASG is one pool, so the capacities, counts and batch are all across the whole set
+		curDesiredCapacity, finDesiredCapacity := asgSet.PoolCapacity()
 
 		oldUnhealthy := asgSet.GetUnHealthyOldInstances()
 		newHealthy := asgSet.GetHealthyNewInstances()
@@ -158,7 +107,10 @@ func (r *Runner) Run() error {
 		if oldKilled {
 			ctx, cancel = r.NewContext()
 			defer cancel()
-			r.Sleep(ctx)
+			err = r.WaitOrRollBack(ctx)
+			if err != nil {
+				return err
+			}
 
 			continue
 		}
@@ -166,7 +118,10 @@ func (r *Runner) Run() error {
 		// This check already prints statuses of individual nodes
 		if asgSet.IsTransient() {
 			log.Info("Waiting for nodes to settle")
-			r.Sleep(ctx)
+			err = r.WaitOrRollBack(ctx)
+			if err != nil {
+				return err
+			}
 			continue
 		}
 
@@ -185,19 +140,48 @@ func (r *Runner) Run() error {
 			return errors.New("old instance mismatch")
 		}
 
+		// Once every old instance is gone, any surge left is in ASGs that had no old instances left to kill
+		if oldCount == 0 && curDesiredCapacity > finDesiredCapacity {
+			log.Info("Removing surge left over in the pool")
+			capacities := make(map[string]int32)
+			for _, asg := range asgSet.ASGs {
+				capacities[*asg.ASG.AutoScalingGroupName] = asg.DesiredASG.DesiredCapacity
+			}
+
+			err = r.ScaleInPool(ctx, asgSet, capacities)
+			if err != nil {
+				return errors.Wrap(err, "error killing instance")
+			}
+
+			ctx, cancel = r.NewContext()
+			defer cancel()
+			err = r.WaitOrRollBack(ctx)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
 		// If we haven't canaried a new instance yet, let's do that
 		if newCount == 0 {
 			log.Info("Adding canary node")
-			newDesiredCapacity = curDesiredCapacity + 1
+			capacities, err := asgSet.SpreadCapacity(1)
+			if err != nil {
+				return errors.Wrap(err, "error adding canary node")
+			}
 
-			err = r.SetDesiredCapacity(ctx, asg, &newDesiredCapacity)
+			err = r.SetPoolCapacity(ctx, asgSet, capacities)
 			if err != nil {
 				return errors.Wrap(err, "error setting desired capacity")
 			}
 
 			ctx, cancel = r.NewContext()
 			defer cancel()
-			r.Sleep(ctx)
+			err = r.WaitOrRollBack(ctx)
+			if err != nil {
+				return err
+			}
 
 			continue
 		}
@@ -211,22 +195,28 @@ func (r *Runner) Run() error {
 				"Current batch size":     newDesiredCapacity - curDesiredCapacity,
 			}).Info("Adding a batch of new nodes")
 
-			err = r.SetDesiredCapacity(ctx, asg, &newDesiredCapacity)
+			capacities, err := asgSet.SpreadCapacity(newDesiredCapacity - curDesiredCapacity)
+			if err != nil {
+				return errors.Wrap(err, "error spreading batch across ASGs")
+			}
+
+			err = r.SetPoolCapacity(ctx, asgSet, capacities)
 			if err != nil {
 				return errors.Wrap(err, "error setting desired capacity")
 			}
 
 			ctx, cancel = r.NewContext()
 			defer cancel()
-			r.Sleep(ctx)
+			err = r.WaitOrRollBack(ctx)
+			if err != nil {
+				return err
+			}
 
 			continue
 		}
 
 		// Scale-in a batch
 		if extraNodes > 0 {
-			killed := int32(0)
-
 			l := log.WithFields(log.Fields{
 				"Old nodes":     oldCount,
 				"Healthy nodes": healthyCount,
@@ -240,22 +230,26 @@ func (r *Runner) Run() error {
 
 			l.Info("Killing a batch of nodes")
 
-			for _, oi := range oldHealthy {
-				err := r.KillInstance(ctx, oi, &decrement)
-				if err != nil {
-					return errors.Wrap(err, "error killing instance")
-				}
-				killed++
-				if killed == extraNodes {
-					log.WithFields(log.Fields{
-						"Killed Nodes": killed,
-					}).Info("Already killed number of extra nodes to get back to desired capacity, pausing here")
-					break
-				}
+			withDecrement, withoutDecrement := asgSet.PickPoolVictims(oldHealthy, extraNodes)
+			err = r.killAll(ctx, withDecrement, true)
+			if err == nil {
+				err = r.killAll(ctx, withoutDecrement, false)
 			}
+			if err != nil {
+				return errors.Wrap(err, "error killing instance")
+			}
+			if int32(len(withDecrement)+len(withoutDecrement)) == extraNodes {
+				log.WithFields(log.Fields{
+					"Killed Nodes": extraNodes,
+				}).Info("Already killed number of extra nodes to get back to desired capacity, pausing here")
+			}
+
 			ctx, cancel = r.NewContext()
 			defer cancel()
-			r.Sleep(ctx)
+			err = r.WaitOrRollBack(ctx)
+			if err != nil {
+				return err
+			}
 
 			continue
 		}
@@ -271,3 +265,14 @@ func (r *Runner) Run() error {
 		return errors.New("undefined error")
 	}
 }
+
+// killAll terminates each of the given instances, decrementing their ASGs' desired capacity if asked
+func (r *Runner) killAll(ctx context.Context, instances []*bouncer.Instance, decrement bool) error {
+	for _, inst := range instances {
+		err := r.KillInstance(ctx, inst, &decrement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
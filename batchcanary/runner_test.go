@@ -0,0 +1,521 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package batchcanary
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/palantir/bouncer/bouncer"
+	"github.com/palantir/bouncer/simulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRunner returns a runner against the simulator which, unless opts say otherwise, checks it every millisecond
+// and gives each change a minute
+func newTestRunner(t *testing.T, sim *simulator.Simulator, opts bouncer.RunnerOpts) *Runner {
+	t.Helper()
+	opts.Clients = sim.Clients()
+	if opts.CheckInterval == 0 {
+		opts.CheckInterval = time.Millisecond
+	}
+	if opts.ItemTimeout == 0 {
+		opts.ItemTimeout = time.Minute
+	}
+
+	r, err := NewRunner(context.Background(), &opts)
+	require.NoError(t, err)
+	return r
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	sim, err := simulator.NewWithOldASGs(simulator.ASGConfig{
+		Name:            "test-asg",
+		MinSize:         4,
+		MaxSize:         6,
+		DesiredCapacity: 4,
+	})
+	require.NoError(t, err)
+
+	batchSize := int32(2)
+
+	r := newTestRunner(t, sim, bouncer.RunnerOpts{
+		AsgString: "test-asg:4",
+		BatchSize: &batchSize,
+	})
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	require.NoError(t, r.Run())
+
+	assert.Equal(t, 0, sim.OldInstanceCount("test-asg"))
+	assert.Len(t, sim.InstanceStates("test-asg"), 4)
+	assert.Equal(t, int32(4), sim.DesiredCapacity("test-asg"))
+	assert.Equal(t, simulator.Stats{MaxInstances: 6, MinInService: 4}, sim.Stats("test-asg"))
+}
+
+func TestRunWarmPool(t *testing.T) {
+	ctx := context.Background()
+	// Scale-outs are served from the old warm pool first, so the canary is only new once it's been emptied
+	sim, err := simulator.NewWithOldASGs(simulator.ASGConfig{
+		Name:            "test-asg",
+		MinSize:         4,
+		MaxSize:         8,
+		DesiredCapacity: 4,
+		WarmPoolSize:    2,
+	})
+	require.NoError(t, err)
+
+	batchSize := int32(2)
+
+	r := newTestRunner(t, sim, bouncer.RunnerOpts{
+		AsgString: "test-asg:4",
+		BatchSize: &batchSize,
+	})
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	require.NoError(t, r.Run())
+
+	// Old instances handed out by the warm pool are replaced like any other, and the pool never counts towards desired
+	assert.Equal(t, 0, sim.OldInstanceCount("test-asg"))
+	assert.Len(t, sim.InstanceStates("test-asg"), 4)
+	assert.Equal(t, int32(4), sim.DesiredCapacity("test-asg"))
+	assert.Len(t, sim.WarmPoolStates("test-asg"), 2)
+}
+
+func TestRefreshWarmPool(t *testing.T) {
+	sim, err := simulator.NewWithOldASGs(simulator.ASGConfig{
+		Name:            "test-asg",
+		MinSize:         4,
+		MaxSize:         6,
+		DesiredCapacity: 4,
+		WarmPoolSize:    3,
+	})
+	require.NoError(t, err)
+
+	r := newTestRunner(t, sim, bouncer.RunnerOpts{
+		AsgString:       "test-asg:4",
+		RefreshWarmPool: true,
+	})
+	require.NoError(t, r.RefreshWarmPool())
+
+	assert.Equal(t, 0, sim.OldWarmPoolCount("test-asg"))
+	assert.Len(t, sim.WarmPoolStates("test-asg"), 3)
+	for _, state := range sim.WarmPoolStates("test-asg") {
+		assert.Equal(t, at.LifecycleStateWarmedStopped, state)
+	}
+
+	// The instances in service are left alone
+	assert.Equal(t, 4, sim.OldInstanceCount("test-asg"))
+	assert.Equal(t, int32(4), sim.DesiredCapacity("test-asg"))
+
+	require.Len(t, r.Actions(), 3)
+	for _, action := range r.Actions() {
+		assert.Equal(t, bouncer.ActionTerminateInstance, action.Kind)
+		assert.False(t, action.Decrement)
+	}
+}
+
+func TestRunMixedInstancesPolicy(t *testing.T) {
+	ctx := context.Background()
+	sim := simulator.New()
+	require.NoError(t, sim.AddASG(simulator.ASGConfig{
+		Name:            "test-asg",
+		MinSize:         4,
+		MaxSize:         6,
+		DesiredCapacity: 4,
+		InstanceTypes:   []string{"m5.large", "c5.large"},
+	}))
+	require.NoError(t, sim.NewOverrideTemplate("test-asg", "m5.large"))
+
+	batchSize := int32(2)
+
+	r := newTestRunner(t, sim, bouncer.RunnerOpts{
+		AsgString: "test-asg:4",
+		BatchSize: &batchSize,
+	})
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	require.NoError(t, r.Run())
+
+	// Replacements launched from the override's template are new, even though it isn't the ASG's own
+	assert.Equal(t, 0, sim.OldInstanceCount("test-asg"))
+	assert.Len(t, sim.InstanceStates("test-asg"), 4)
+	assert.Equal(t, simulator.Stats{MaxInstances: 6, MinInService: 4}, sim.Stats("test-asg"))
+}
+
+func TestResumeSuspendProcesses(t *testing.T) {
+	ctx := context.Background()
+	sim, err := simulator.NewWithOldASGs(simulator.ASGConfig{
+		Name:            "test-asg",
+		MinSize:         4,
+		MaxSize:         6,
+		DesiredCapacity: 4,
+	})
+	require.NoError(t, err)
+
+	batchSize := int32(2)
+	opts := bouncer.RunnerOpts{
+		AsgString:        "test-asg:4",
+		BatchSize:        &batchSize,
+		SuspendProcesses: bouncer.DefaultSuspendProcesses,
+		CheckpointFile:   filepath.Join(t.TempDir(), "checkpoint.json"),
+		// Fails the run at the first termination, once the surge is in
+		CommandString: "false",
+	}
+
+	r := newTestRunner(t, sim, opts)
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	err = r.Run()
+	require.Error(t, err)
+	r.Finish(err)
+	assert.Empty(t, sim.SuspendedProcesses("test-asg"))
+
+	// The resumed run suspends them all over again, and resumes them when it's done
+	opts.CommandString = ""
+	opts.Resume = true
+	r = newTestRunner(t, sim, opts)
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	require.NoError(t, r.Run())
+	assert.Equal(t, []string{"AZRebalance", "AlarmNotification", "ScheduledActions"}, sim.SuspendedProcesses("test-asg"))
+
+	r.Finish(nil)
+	assert.Empty(t, sim.SuspendedProcesses("test-asg"))
+	assert.Equal(t, 0, sim.OldInstanceCount("test-asg"))
+}
+
+func TestResumeUnprotectsNewInstances(t *testing.T) {
+	ctx := context.Background()
+	sim, err := simulator.NewWithOldASGs(simulator.ASGConfig{
+		Name:            "test-asg",
+		MinSize:         4,
+		MaxSize:         6,
+		DesiredCapacity: 4,
+	})
+	require.NoError(t, err)
+
+	batchSize := int32(2)
+	opts := bouncer.RunnerOpts{
+		AsgString:      "test-asg:4",
+		BatchSize:      &batchSize,
+		ProtectNew:     true,
+		CheckpointFile: filepath.Join(t.TempDir(), "checkpoint.json"),
+		// Fails the run at the first termination, once the surge is in and protected
+		CommandString: "false",
+	}
+
+	// The first run dies without finishing, so the surge is left protected
+	r := newTestRunner(t, sim, opts)
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	require.Error(t, r.Run())
+	require.Len(t, sim.ProtectedInstances("test-asg"), 2)
+
+	// The resumed run unprotects them along with its own
+	opts.CommandString = ""
+	opts.Resume = true
+	r = newTestRunner(t, sim, opts)
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	require.NoError(t, r.Run())
+	r.Finish(nil)
+	assert.Equal(t, 0, sim.OldInstanceCount("test-asg"))
+	assert.Empty(t, sim.ProtectedInstances("test-asg"))
+}
+
+func TestRunInterruptMidBatch(t *testing.T) {
+	ctx := context.Background()
+	sim, err := simulator.NewWithOldASGs(simulator.ASGConfig{
+		Name:            "test-asg",
+		MinSize:         4,
+		MaxSize:         8,
+		DesiredCapacity: 4,
+	})
+	require.NoError(t, err)
+
+	// The first pre-terminate webhook of the batch interrupts the run
+	interrupt := make(chan struct{})
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		if calls == 1 {
+			close(interrupt)
+		}
+	}))
+	defer server.Close()
+
+	batchSize := int32(4)
+
+	r := newTestRunner(t, sim, bouncer.RunnerOpts{
+		AsgString: "test-asg:4",
+		BatchSize: &batchSize,
+		Interrupt: interrupt,
+		Webhooks: bouncer.WebhookOpts{
+			PreTerminate: server.URL,
+			Timeout:      time.Second,
+		},
+	})
+	require.NoError(t, r.ValidatePrereqs(ctx))
+
+	err = r.Run()
+	assert.True(t, errors.Is(err, bouncer.ErrInterrupted))
+
+	// Only the instance whose termination had already started is gone
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 3, sim.OldInstanceCount("test-asg"))
+	var terminated int
+	for _, action := range r.Actions() {
+		if action.Kind == bouncer.ActionTerminateInstance {
+			terminated++
+		}
+	}
+	assert.Equal(t, 1, terminated)
+}
+
+func TestRunSuspendProcesses(t *testing.T) {
+	ctx := context.Background()
+	sim, err := simulator.NewWithOldASGs(simulator.ASGConfig{
+		Name:               "test-asg",
+		MinSize:            4,
+		MaxSize:            6,
+		DesiredCapacity:    4,
+		SuspendedProcesses: []string{"AZRebalance"},
+	})
+	require.NoError(t, err)
+
+	batchSize := int32(2)
+
+	r := newTestRunner(t, sim, bouncer.RunnerOpts{
+		AsgString:        "test-asg:4",
+		BatchSize:        &batchSize,
+		SuspendProcesses: bouncer.DefaultSuspendProcesses,
+	})
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	require.NoError(t, r.Run())
+
+	assert.Equal(t, []string{"AZRebalance", "AlarmNotification", "ScheduledActions"}, sim.SuspendedProcesses("test-asg"))
+
+	// AZRebalance was suspended before bouncer started, so it stays that way
+	r.Finish(nil)
+	assert.Equal(t, []string{"AZRebalance"}, sim.SuspendedProcesses("test-asg"))
+
+	// Without Launch, nothing would replace the instances bouncer terminates
+	_, err = NewRunner(ctx, &bouncer.RunnerOpts{
+		AsgString:        "test-asg:4",
+		BatchSize:        &batchSize,
+		Clients:          sim.Clients(),
+		SuspendProcesses: []string{"Launch"},
+	})
+	assert.Error(t, err)
+}
+
+func TestRunPool(t *testing.T) {
+	ctx := context.Background()
+	asgs := map[string]int32{"test-asg-a": 3, "test-asg-b": 3, "test-asg-c": 6}
+	var cfgs []simulator.ASGConfig
+	for name, maxSize := range asgs {
+		cfgs = append(cfgs, simulator.ASGConfig{
+			Name:            name,
+			MinSize:         2,
+			MaxSize:         maxSize,
+			DesiredCapacity: 2,
+		})
+	}
+	sim, err := simulator.NewWithOldASGs(cfgs...)
+	require.NoError(t, err)
+
+	batchSize := int32(4)
+	r := newTestRunner(t, sim, bouncer.RunnerOpts{
+		AsgString: "test-asg-a:2,test-asg-b:2,test-asg-c:2",
+		BatchSize: &batchSize,
+	})
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	require.NoError(t, r.Run())
+
+	for name := range asgs {
+		assert.Equal(t, 0, sim.OldInstanceCount(name), name)
+		assert.Len(t, sim.InstanceStates(name), 2, name)
+		assert.Equal(t, int32(2), sim.DesiredCapacity(name), name)
+	}
+
+	// The surge is spread by max size, so the biggest ASG takes twice what the others do, and no ASG dips
+	assert.Equal(t, simulator.Stats{MaxInstances: 3, MinInService: 2}, sim.Stats("test-asg-a"))
+	assert.Equal(t, simulator.Stats{MaxInstances: 3, MinInService: 2}, sim.Stats("test-asg-b"))
+	assert.Equal(t, simulator.Stats{MaxInstances: 4, MinInService: 2}, sim.Stats("test-asg-c"))
+}
+
+func TestRunScaleInProtection(t *testing.T) {
+	ctx := context.Background()
+	asgs := map[string]int32{"test-asg-a": 3, "test-asg-b": 3, "test-asg-c": 6}
+	var cfgs []simulator.ASGConfig
+	for name, maxSize := range asgs {
+		cfgs = append(cfgs, simulator.ASGConfig{
+			Name:            name,
+			MinSize:         2,
+			MaxSize:         maxSize,
+			DesiredCapacity: 2,
+		})
+	}
+	sim, err := simulator.NewWithOldASGs(cfgs...)
+	require.NoError(t, err)
+
+	// The old instances start out protected
+	for name := range asgs {
+		ids := slices.Collect(maps.Keys(sim.InstanceStates(name)))
+		require.NoError(t, sim.Clients().SetInstanceProtection(ctx, name, ids, true))
+	}
+
+	batchSize := int32(4)
+	r := newTestRunner(t, sim, bouncer.RunnerOpts{
+		AsgString:    "test-asg-a:2,test-asg-b:2,test-asg-c:2",
+		BatchSize:    &batchSize,
+		UnprotectOld: true,
+		ProtectNew:   true,
+	})
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	require.NoError(t, r.Run())
+
+	// Every new instance is protected, so the surge left in the pool had to be terminated rather than scaled in
+	for name := range asgs {
+		assert.Equal(t, 0, sim.OldInstanceCount(name), name)
+		assert.Len(t, sim.InstanceStates(name), 2, name)
+		assert.Len(t, sim.ProtectedInstances(name), 2, name)
+	}
+
+	var unprotected int
+	for _, action := range r.Actions() {
+		if action.Kind == bouncer.ActionRemoveScaleInProtection {
+			unprotected++
+		}
+	}
+	assert.Equal(t, 6, unprotected)
+
+	r.Finish(nil)
+	for name := range asgs {
+		assert.Empty(t, sim.ProtectedInstances(name), name)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	ctx := context.Background()
+	sim, err := simulator.NewWithOldASGs(simulator.ASGConfig{
+		Name:            "test-asg",
+		MinSize:         4,
+		MaxSize:         6,
+		DesiredCapacity: 4,
+	})
+	require.NoError(t, err)
+
+	batchSize := int32(2)
+	r := newTestRunner(t, sim, bouncer.RunnerOpts{
+		Noop:      true,
+		AsgString: "test-asg:4",
+		BatchSize: &batchSize,
+	})
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	require.NoError(t, r.Run())
+
+	plan := r.Plan()
+	require.Len(t, plan, 5)
+
+	var desired []int32
+	for i, phase := range plan {
+		assert.Equal(t, i+1, phase.Phase)
+		assert.Equal(t, "test-asg", phase.ASG)
+		assert.LessOrEqual(t, phase.PeakInService, int32(6))
+		assert.GreaterOrEqual(t, phase.MinInService, int32(4))
+		desired = append(desired, phase.DesiredCapacity)
+	}
+	assert.Equal(t, []int32{5, 6, 4, 6, 4}, desired)
+
+	assert.Empty(t, plan[1].Terminate)
+	assert.Len(t, plan[2].Terminate, 2)
+	assert.True(t, plan[2].Decrement)
+	assert.Len(t, plan[4].Terminate, 2)
+	assert.True(t, plan[4].Decrement)
+}
+
+func TestRunEvents(t *testing.T) {
+	ctx := context.Background()
+	sim, err := simulator.NewWithOldASGs(simulator.ASGConfig{
+		Name:            "test-asg",
+		MinSize:         4,
+		MaxSize:         6,
+		DesiredCapacity: 4,
+	})
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	eventsFile := filepath.Join(dir, "events.ndjson")
+	summaryFile := filepath.Join(dir, "summary.json")
+
+	batchSize := int32(2)
+	r := newTestRunner(t, sim, bouncer.RunnerOpts{
+		AsgString:   "test-asg:4",
+		BatchSize:   &batchSize,
+		EventsFile:  eventsFile,
+		SummaryFile: summaryFile,
+	})
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	err = r.Run()
+	require.NoError(t, err)
+	r.Finish(err)
+
+	f, err := os.Open(eventsFile)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var events []bouncer.Event
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var event bouncer.Event
+		require.NoError(t, dec.Decode(&event))
+		events = append(events, event)
+	}
+
+	require.NotEmpty(t, events)
+	assert.Equal(t, bouncer.EventRunStarted, events[0].Type)
+	assert.Equal(t, Mode, events[0].Mode)
+	assert.Equal(t, bouncer.EventRunFinished, events[len(events)-1].Type)
+
+	counts := make(map[bouncer.EventType]int)
+	for _, event := range events {
+		counts[event.Type]++
+	}
+	assert.Equal(t, 5, counts[bouncer.EventPhaseChanged])
+	assert.Equal(t, 3, counts[bouncer.EventCapacitySet])
+	assert.Equal(t, 4, counts[bouncer.EventInstanceSelected])
+	assert.Equal(t, 4, counts[bouncer.EventInstanceTerminated])
+
+	data, err := os.ReadFile(summaryFile)
+	require.NoError(t, err)
+	var summary bouncer.Summary
+	require.NoError(t, json.Unmarshal(data, &summary))
+
+	assert.True(t, summary.Success)
+	assert.Equal(t, Mode, summary.Mode)
+	assert.Len(t, summary.Phases, 5)
+	require.Len(t, summary.Replaced, 4)
+	for _, replaced := range summary.Replaced {
+		assert.Equal(t, "test-asg", replaced.ASG)
+		assert.Equal(t, "1", replaced.OldVersion)
+		assert.Equal(t, "2", replaced.NewVersion)
+	}
+}
@@ -23,8 +23,11 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// Mode is the name this runner is invoked by
+const Mode = "batch-serial"
+
 // Runner holds data for a particular batch-serial run
-// Note that in the batch-serial case, asgs will always be of length 1
+// Note that in the batch-serial case, every ASG given is bounced as one pool, e.g. per-AZ ASGs of the same service
 type Runner struct {
 	bouncer.BaseRunner
 	batchSize int32 // This field is set in ValidatePrereqs
@@ -32,14 +35,13 @@ type Runner struct {
 
 // NewRunner instantiates a new batch-serial runner
 func NewRunner(ctx context.Context, opts *bouncer.RunnerOpts) (*Runner, error) {
-	br, err := bouncer.NewBaseRunner(ctx, opts)
+	br, err := bouncer.NewBaseRunner(ctx, Mode, opts)
 	if err != nil {
 		return nil, errors.Wrap(err, "error getting base runner")
 	}
 
 	r := Runner{
 		BaseRunner: *br,
-		batchSize:  *opts.BatchSize,
 	}
 	return &r, nil
 }
@@ -51,18 +53,11 @@ func (r *Runner) ValidatePrereqs(ctx context.Context) error {
 		return errors.Wrap(err, "error building actualASG")
 	}
 
-	if len(asgSet.ASGs) > 1 {
-		log.WithFields(log.Fields{
-			"count given": len(asgSet.ASGs),
-		}).Error("Batch Serial mode supports only 1 ASG at a time")
-		return errors.New("error validating ASG input")
-	}
-
 	for _, actualAsg := range asgSet.ASGs {
-		if actualAsg.DesiredASG.DesiredCapacity != *actualAsg.ASG.DesiredCapacity {
+		if actualAsg.DesiredASG.DesiredCapacity != r.StartingDesiredCapacity(actualAsg) {
 			log.WithFields(log.Fields{
 				"desired capacity given":  actualAsg.DesiredASG.DesiredCapacity,
-				"desired capacity actual": *actualAsg.ASG.DesiredCapacity,
+				"desired capacity actual": r.StartingDesiredCapacity(actualAsg),
 			}).Error("Desired capacity given must be equal to starting desired_capacity of ASG")
 			return errors.New("error validating ASG state")
 		}
@@ -75,16 +70,25 @@ func (r *Runner) ValidatePrereqs(ctx context.Context) error {
 			}).Error("Desired capacity given must be greater than or equal to min ASG size")
 			return errors.New("error validating ASG state")
 		}
+	}
 
-		if *actualAsg.ASG.MinSize > (actualAsg.DesiredASG.DesiredCapacity - r.batchSize) {
-			log.WithFields(log.Fields{
-				"min size":         *actualAsg.ASG.MinSize,
-				"max size":         *actualAsg.ASG.MaxSize,
-				"desired capacity": actualAsg.DesiredASG.DesiredCapacity,
-				"batch size":       r.batchSize,
-			}).Error("Min capacity of ASG must be <= desired capacity - batch size")
-			return errors.New("error validating ASG state")
-		}
+	// The batch is how many instances may be unavailable, so a percentage rounds down
+	_, finDesiredCapacity := asgSet.PoolCapacity()
+	r.batchSize = r.ResolveBatchSize(finDesiredCapacity, false)
+	log.WithFields(log.Fields{
+		"batch size given":    r.BatchSizeGiven(),
+		"desired capacity":    finDesiredCapacity,
+		"resolved batch size": r.batchSize,
+	}).Info("Resolved batch size")
+
+	// The batch is taken out of the whole pool, so it only has to fit above the min sizes between them
+	if asgSet.PoolMinSize() > (finDesiredCapacity - r.batchSize) {
+		log.WithFields(log.Fields{
+			"min size":         asgSet.PoolMinSize(),
+			"desired capacity": finDesiredCapacity,
+			"batch size":       r.batchSize,
+		}).Error("Min capacity of the ASGs must be <= desired capacity - batch size")
+		return errors.New("error validating ASG state")
 	}
 
 	return nil
@@ -105,10 +109,8 @@ func (r *Runner) Run() error {
 			return errors.Wrap(err, "error building ASGSet")
 		}
 
-		// Since we only support one ASG in batch-serial mode
-		asg := asgSet.ASGs[0]
-		curDesiredCapacity := *asg.ASG.DesiredCapacity
-		finDesiredCapacity := asg.DesiredASG.DesiredCapacity
+		// Every ASG is one pool, so the capacities, counts and batch are all across the whole set
+		curDesiredCapacity, finDesiredCapacity := asgSet.PoolCapacity()
 
 		oldUnhealthy := asgSet.GetUnHealthyOldInstances()
 		newHealthy := asgSet.GetHealthyNewInstances()
@@ -170,6 +172,8 @@ func (r *Runner) Run() error {
 		if newCount == 0 && totalCount == finDesiredCapacity {
 			log.Info("Terminating a canary node")
 			oi := asgSet.GetBestOldInstance()
+			asg := asgSet.GetASG(*oi.AutoscalingGroup.AutoScalingGroupName)
+			decrement := *asg.ASG.DesiredCapacity > *asg.ASG.MinSize
 
 			err := r.KillInstance(ctx, oi, &decrement)
 			if err != nil {
@@ -185,7 +189,12 @@ func (r *Runner) Run() error {
 
 		// Scale-out a batch to original size to refresh nodes
 		if totalCount < finDesiredCapacity {
-			err = r.SetDesiredCapacity(ctx, asg, &finDesiredCapacity)
+			capacities := make(map[string]int32)
+			for _, asg := range asgSet.ASGs {
+				capacities[*asg.ASG.AutoScalingGroupName] = asg.DesiredASG.DesiredCapacity
+			}
+
+			err = r.SetPoolCapacity(ctx, asgSet, capacities)
 			if err != nil {
 				return errors.Wrap(err, "error setting desired capacity")
 			}
@@ -207,7 +216,20 @@ func (r *Runner) Run() error {
 				"Nodes to kill": toKill,
 			}).Info("Killing a batch of nodes")
 
-			for _, oi := range oldHealthy {
+			// An ASG already down to its min size has its instances replaced rather than removed
+			capacities := make(map[string]int32)
+			for _, asg := range asgSet.ASGs {
+				capacities[*asg.ASG.AutoScalingGroupName] = *asg.ASG.DesiredCapacity
+			}
+
+			// Take from the AZs with the most healthy capacity first, so no one AZ is drained
+			for _, oi := range asgSet.OrderByAZBalance(oldHealthy) {
+				asg := asgSet.GetASG(*oi.AutoscalingGroup.AutoScalingGroupName)
+				decrement := capacities[*asg.ASG.AutoScalingGroupName] > *asg.ASG.MinSize
+				if decrement {
+					capacities[*asg.ASG.AutoScalingGroupName]--
+				}
+
 				err := r.KillInstance(ctx, oi, &decrement)
 				if err != nil {
 					return errors.Wrap(err, "error killing instance")
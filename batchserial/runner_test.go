@@ -0,0 +1,124 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package batchserial
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/palantir/bouncer/bouncer"
+	"github.com/palantir/bouncer/simulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRunner returns a runner against the simulator which, unless opts say otherwise, checks it every millisecond
+// and gives each change a minute
+func newTestRunner(t *testing.T, sim *simulator.Simulator, opts bouncer.RunnerOpts) *Runner {
+	t.Helper()
+	opts.Clients = sim.Clients()
+	if opts.CheckInterval == 0 {
+		opts.CheckInterval = time.Millisecond
+	}
+	if opts.ItemTimeout == 0 {
+		opts.ItemTimeout = time.Minute
+	}
+
+	r, err := NewRunner(context.Background(), &opts)
+	require.NoError(t, err)
+	return r
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	sim, err := simulator.NewWithOldASGs(simulator.ASGConfig{
+		Name:            "test-asg",
+		MinSize:         2,
+		MaxSize:         4,
+		DesiredCapacity: 4,
+	})
+	require.NoError(t, err)
+
+	batchSize := int32(2)
+
+	r := newTestRunner(t, sim, bouncer.RunnerOpts{
+		AsgString: "test-asg:4",
+		BatchSize: &batchSize,
+	})
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	require.NoError(t, r.Run())
+
+	assert.Equal(t, 0, sim.OldInstanceCount("test-asg"))
+	assert.Len(t, sim.InstanceStates("test-asg"), 4)
+	assert.Equal(t, int32(4), sim.DesiredCapacity("test-asg"))
+	assert.Equal(t, simulator.Stats{MaxInstances: 4, MinInService: 2}, sim.Stats("test-asg"))
+}
+
+func TestRunPool(t *testing.T) {
+	ctx := context.Background()
+	asgs := []string{"test-asg-a", "test-asg-b", "test-asg-c"}
+	var cfgs []simulator.ASGConfig
+	for _, name := range asgs {
+		cfgs = append(cfgs, simulator.ASGConfig{
+			Name:            name,
+			MinSize:         1,
+			MaxSize:         2,
+			DesiredCapacity: 2,
+		})
+	}
+	sim, err := simulator.NewWithOldASGs(cfgs...)
+	require.NoError(t, err)
+
+	batchSize := int32(2)
+	r := newTestRunner(t, sim, bouncer.RunnerOpts{
+		AsgString: "test-asg-a:2,test-asg-b:2,test-asg-c:2",
+		BatchSize: &batchSize,
+	})
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	require.NoError(t, r.Run())
+
+	for _, name := range asgs {
+		assert.Equal(t, 0, sim.OldInstanceCount(name), name)
+		assert.Len(t, sim.InstanceStates(name), 2, name)
+		assert.Equal(t, int32(2), sim.DesiredCapacity(name), name)
+		assert.GreaterOrEqual(t, sim.Stats(name).MinInService, int32(1), name)
+	}
+}
+
+func TestRunAZBalance(t *testing.T) {
+	ctx := context.Background()
+	sim, err := simulator.NewWithOldASGs(simulator.ASGConfig{
+		Name:              "test-asg",
+		MinSize:           2,
+		MaxSize:           4,
+		DesiredCapacity:   4,
+		AvailabilityZones: []string{"us-east-1a", "us-east-1b"},
+		// The oldest instances are all in one AZ
+		StartingAZs: []string{"us-east-1a", "us-east-1a", "us-east-1a", "us-east-1b"},
+	})
+	require.NoError(t, err)
+
+	batchSize := int32(2)
+	r := newTestRunner(t, sim, bouncer.RunnerOpts{
+		AsgString: "test-asg:4",
+		BatchSize: &batchSize,
+	})
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	require.NoError(t, r.Run())
+
+	assert.Equal(t, 0, sim.OldInstanceCount("test-asg"))
+	// Neither AZ should ever be left without an instance in service
+	assert.Equal(t, map[string]int32{"us-east-1a": 1, "us-east-1b": 1}, sim.MinInServiceByAZ("test-asg"))
+}
@@ -19,8 +19,10 @@ import (
 	"time"
 
 	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	et "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/palantir/bouncer/aws"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 )
 
 // ASG object holds a pointer to an ASG and its Instances
@@ -28,30 +30,94 @@ type ASG struct {
 	ASG        *at.AutoScalingGroup
 	Instances  []*Instance
 	DesiredASG *DesiredASG
+	// Draining is targets still being deregistered from the ASG's target groups, only checked when gating on load balancer health
+	Draining []DrainingTarget
+	// WarmPool is the instances in the ASG's warm pool, which don't count towards its desired capacity
+	WarmPool []*Instance
 }
 
-// NewASG creates a new ASG object
-func NewASG(ctx context.Context, ac *aws.Clients, desASG *DesiredASG, force bool, startTime time.Time) (*ASG, error) {
-	awsAsg, err := ac.GetASG(ctx, desASG.AsgName)
+// NewASG creates a new ASG object from the AWS ASG and its warm pool instances, given the EC2 instances behind both, keyed by ID
+// If lbHealth is set, instances are only healthy once they're healthy in every target group and classic ELB attached to the ASG,
+// and targets still draining are tracked if they're the ASG's own instances or in killed, the ones this run terminated
+func NewASG(ctx context.Context, ac *aws.Clients, awsAsg *at.AutoScalingGroup, warm []at.Instance, desASG *DesiredASG, ec2Insts map[string]*et.Instance, force bool, lbHealth bool, killed map[string]bool, startTime time.Time) (*ASG, error) {
+	var health *lbStatus
+	var err error
+	if lbHealth {
+		health, err = getLBStatus(ctx, ac, awsAsg, killed)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Every instance is compared against the same few launch template versions, so they're only resolved once
+	templates, err := resolveLaunchTemplates(ctx, ac, awsAsg)
 	if err != nil {
-		return nil, errors.Wrap(err, "error getting AWS ASG object")
+		return nil, err
+	}
+	newInstance := func(asgInst at.Instance, ec2Inst *et.Instance) *Instance {
+		lts, ec2LTplVersion := templates.forInstance(&asgInst)
+		inst := NewInstance(awsAsg, asgInst, ec2Inst, lts, ec2LTplVersion, force, startTime, desASG.PreTerminateCmd)
+		if !inst.IsOld && !templates.allowsType(&asgInst) {
+			inst.IsOld = true
+		}
+		return inst
 	}
 
 	var instances []*Instance
 
 	for _, asgInst := range awsAsg.Instances {
-		inst, err := NewInstance(ctx, ac, awsAsg, asgInst, force, startTime, desASG.PreTerminateCmd)
-		if err != nil {
-			return nil, errors.Wrapf(err, "error generating bouncer.instance for %s", *asgInst.InstanceId)
+		if isWarmedState(asgInst.LifecycleState) {
+			// Warm pool instances are described separately, they don't belong with the ones counted against desired capacity
+			continue
+		}
+
+		ec2Inst, ok := ec2Insts[*asgInst.InstanceId]
+		if !ok {
+			return nil, errors.Errorf("error generating bouncer.instance for %s: EC2 instance wasn't described", *asgInst.InstanceId)
+		}
+		inst := newInstance(asgInst, ec2Inst)
+
+		if health != nil {
+			if reason, ok := health.unhealthy[*asgInst.InstanceId]; ok && inst.IsHealthy {
+				log.WithFields(log.Fields{
+					"InstanceID": *asgInst.InstanceId,
+					"Reason":     reason,
+				}).Debug("Instance marked as unhealthy because it isn't healthy in its load balancers")
+				inst.IsHealthy = false
+			}
 		}
 		instances = append(instances, inst)
 	}
 
+	var warmPool []*Instance
+	for _, asgInst := range warm {
+		ec2Inst, ok := ec2Insts[*asgInst.InstanceId]
+		if !ok {
+			return nil, errors.Errorf("error generating bouncer.instance for warm pool instance %s: EC2 instance wasn't described", *asgInst.InstanceId)
+		}
+		warmPool = append(warmPool, newInstance(asgInst, ec2Inst))
+	}
+
 	asg := ASG{
 		ASG:        awsAsg,
 		Instances:  instances,
 		DesiredASG: desASG,
+		WarmPool:   warmPool,
+	}
+	if health != nil {
+		asg.Draining = health.draining
 	}
 
 	return &asg, nil
 }
+
+// instanceIDs returns the IDs of every instance in the AWS ASG, leaving out any warm pool instances
+func instanceIDs(awsAsg *at.AutoScalingGroup) []string {
+	var ids []string
+	for _, asgInst := range awsAsg.Instances {
+		if !isWarmedState(asgInst.LifecycleState) {
+			ids = append(ids, *asgInst.InstanceId)
+		}
+	}
+	return ids
+}
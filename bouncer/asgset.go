@@ -16,6 +16,7 @@ package bouncer
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
@@ -30,16 +31,53 @@ type ASGSet struct {
 	ASGs []*ASG
 }
 
-func newASGSet(ctx context.Context, ac *aws.Clients, desiredASGs []*DesiredASG, force bool, startTime time.Time) (*ASGSet, error) {
-	var asgs []*ASG
-
-	for _, desASG := range desiredASGs {
-		asg, err := NewASG(ctx, ac, desASG, force, startTime)
+func newASGSet(ctx context.Context, ac *aws.Clients, desiredASGs []*DesiredASG, force bool, lbHealth bool, killed map[string]bool, startTime time.Time) (*ASGSet, error) {
+	// The ASGs are independent, so they're described concurrently, along with any warm pools
+	awsAsgs := make([]*at.AutoScalingGroup, len(desiredASGs))
+	warmPools := make([][]at.Instance, len(desiredASGs))
+	err := forEachASG(desiredASGs, func(i int, desASG *DesiredASG) error {
+		awsAsg, err := ac.GetASG(ctx, desASG.AsgName)
 		if err != nil {
-			return nil, errors.Wrapf(err, "Error getting information for ASG %s", desASG.AsgName)
+			return errors.Wrapf(err, "Error getting information for ASG %s", desASG.AsgName)
+		}
+		awsAsgs[i] = awsAsg
+
+		if awsAsg.WarmPoolConfiguration != nil {
+			warmPools[i], err = ac.GetWarmPool(ctx, desASG.AsgName)
+			if err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Then every instance across all of them is described at once, rather than one call per instance
+	var ids []string
+	for i, awsAsg := range awsAsgs {
+		ids = append(ids, instanceIDs(awsAsg)...)
+		for _, asgInst := range warmPools[i] {
+			ids = append(ids, *asgInst.InstanceId)
+		}
+	}
+	ec2Insts, err := ac.GetEC2Instances(ctx, ids)
+	if err != nil {
+		return nil, errors.Wrap(err, "error describing EC2 instances")
+	}
 
-		asgs = append(asgs, asg)
+	asgs := make([]*ASG, len(desiredASGs))
+	err = forEachASG(desiredASGs, func(i int, desASG *DesiredASG) error {
+		asg, err := NewASG(ctx, ac, awsAsgs[i], warmPools[i], desASG, ec2Insts, force, lbHealth, killed, startTime)
+		if err != nil {
+			return errors.Wrapf(err, "Error getting information for ASG %s", desASG.AsgName)
+		}
+		asgs[i] = asg
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	asgSet := ASGSet{
@@ -49,6 +87,33 @@ func newASGSet(ctx context.Context, ac *aws.Clients, desiredASGs []*DesiredASG,
 	return &asgSet, nil
 }
 
+// maxConcurrentASGs caps how many ASGs forEachASG works on at once, so a long run spec doesn't get throttled by AWS
+const maxConcurrentASGs = 8
+
+// forEachASG calls fn for every desired ASG concurrently, up to maxConcurrentASGs at a time, returning the error of
+// the first ASG, in order, that failed
+func forEachASG(desiredASGs []*DesiredASG, fn func(i int, desASG *DesiredASG) error) error {
+	errs := make([]error, len(desiredASGs))
+	sem := make(chan struct{}, maxConcurrentASGs)
+
+	var wg sync.WaitGroup
+	for i, desASG := range desiredASGs {
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+			errs[i] = fn(i, desASG)
+		})
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // GetImmutableInstances returns instances which are in autoscaling events that we can't manipulate by completing lifecycle actions
 func (a *ASGSet) GetImmutableInstances() []*Instance {
 	var instances []*Instance
@@ -56,7 +121,8 @@ func (a *ASGSet) GetImmutableInstances() []*Instance {
 		for _, inst := range asg.Instances {
 			if inst.ASGInstance.LifecycleState == at.LifecycleStateTerminating ||
 				inst.ASGInstance.LifecycleState == at.LifecycleStatePending ||
-				inst.ASGInstance.LifecycleState == at.LifecycleStateTerminatingProceed {
+				inst.ASGInstance.LifecycleState == at.LifecycleStateTerminatingProceed ||
+				inst.ASGInstance.LifecycleState == at.LifecycleStateEnteringStandby {
 				instances = append(instances, inst)
 			}
 		}
@@ -162,27 +228,28 @@ func (a *ASGSet) GetNewInstances() []*Instance {
 	return newInstances
 }
 
-// GetBestOldInstance returns the instance which is the best candidate to be bounced
+// GetBestOldInstance returns the instance which is the best candidate to be bounced: an unhealthy one if there
+// is one, otherwise one from the AZ with the most healthy instances, oldest first
 func (a *ASGSet) GetBestOldInstance() *Instance {
-	var bestInstance *Instance
-	oldInstances := a.GetOldInstances()
-	for _, inst := range oldInstances {
-		if bestInstance == nil {
-			bestInstance = inst
-		} else if !inst.IsHealthy && bestInstance.IsHealthy {
-			bestInstance = inst
-		} else if (inst.IsHealthy == bestInstance.IsHealthy) && inst.EC2Instance.LaunchTime.Before(*bestInstance.EC2Instance.LaunchTime) {
-			bestInstance = inst
-		}
+	ordered := a.OrderByAZBalance(a.GetOldInstances())
+	if len(ordered) == 0 {
+		return nil
 	}
-	return bestInstance
+	return ordered[0]
 }
 
-// GetActualBadCounts returns all ASGs whose desired counts don't match their actual counts
+// GetActualBadCounts returns all ASGs whose desired counts don't match their actual counts, which leave out
+// instances in Standby
 func (a *ASGSet) GetActualBadCounts() []*ASG {
 	var badCountASGs []*ASG
 	for _, asg := range a.ASGs {
-		if *asg.ASG.DesiredCapacity != int32(len(asg.Instances)) {
+		var count int32
+		for _, inst := range asg.Instances {
+			if !inst.InStandby() {
+				count++
+			}
+		}
+		if *asg.ASG.DesiredCapacity != count {
 			badCountASGs = append(badCountASGs, asg)
 		}
 	}
@@ -249,6 +316,24 @@ func (a *ASGSet) IsTerminating() bool {
 	return isTerminating
 }
 
+// IsDraining prints all targets still being deregistered from the ASGs' target groups and returns true/false whether it found any
+func (a *ASGSet) IsDraining() bool {
+	isDraining := false
+
+	for _, asg := range a.ASGs {
+		for _, target := range asg.Draining {
+			log.WithFields(log.Fields{
+				"ASG":         *asg.ASG.AutoScalingGroupName,
+				"TargetGroup": target.TargetGroupARN,
+				"TargetID":    target.TargetID,
+			}).Info("Waiting for target to finish draining")
+			isDraining = true
+		}
+	}
+
+	return isDraining
+}
+
 // IsCountMismatch prints all instances whose desired_capacity doesn't match running instances and returns true/false whether it found any
 func (a *ASGSet) IsCountMismatch() bool {
 	isCountMismatch := false
@@ -320,10 +405,13 @@ func (a *ASGSet) IsTransient() bool {
 	// Don't return true yet if we got true, wait to see if there are also new unhealthy instances
 	isTerminating := a.IsTerminating()
 
+	// Will print all targets still draining from a target group, which can outlast the instance itself
+	isDraining := a.IsDraining()
+
 	// Will print instances that are "new" (latest LC), but any status other than InService
 	// Would technically double report from above if a new instance is in one of the Terminating states, but this is _very_ rare,
 	// and a double print is not _so_ bad
-	if a.IsNewUnhealthy() || isTerminating {
+	if a.IsNewUnhealthy() || isTerminating || isDraining {
 		// Short-circuit for the rest of the logic here - otherwise the next two checks will pretty regularly double-report new instances
 		return true
 	}
@@ -0,0 +1,136 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/palantir/bouncer/aws"
+	"github.com/palantir/bouncer/simulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingEC2 counts the calls made through it to the EC2 APIs that get called per instance
+type countingEC2 struct {
+	aws.EC2API
+	describeInstances       atomic.Int32
+	describeLaunchTemplates atomic.Int32
+}
+
+func (c *countingEC2) DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	c.describeInstances.Add(1)
+	return c.EC2API.DescribeInstances(ctx, params, optFns...)
+}
+
+func (c *countingEC2) DescribeLaunchTemplates(ctx context.Context, params *ec2.DescribeLaunchTemplatesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeLaunchTemplatesOutput, error) {
+	c.describeLaunchTemplates.Add(1)
+	return c.EC2API.DescribeLaunchTemplates(ctx, params, optFns...)
+}
+
+func TestNewASGSetBatchesLookups(t *testing.T) {
+	ctx := context.Background()
+	sim := simulator.New()
+	var desiredASGs []*DesiredASG
+	for _, name := range []string{"test-asg-a", "test-asg-b", "test-asg-c"} {
+		require.NoError(t, sim.AddASG(simulator.ASGConfig{
+			Name:            name,
+			MinSize:         1,
+			MaxSize:         20,
+			DesiredCapacity: 10,
+		}))
+		desiredASGs = append(desiredASGs, &DesiredASG{AsgName: name, DesiredCapacity: 10})
+	}
+	require.NoError(t, sim.NewLaunchTemplateVersion("test-asg-b"))
+
+	ac := sim.Clients()
+	counter := &countingEC2{EC2API: ac.EC2Client}
+	ac.EC2Client = counter
+
+	asgSet, err := newASGSet(ctx, ac, desiredASGs, false, false, nil, time.Now())
+	require.NoError(t, err)
+
+	// One DescribeInstances for every instance, and one DescribeLaunchTemplates per ASG
+	assert.Equal(t, int32(1), counter.describeInstances.Load())
+	assert.Equal(t, int32(3), counter.describeLaunchTemplates.Load())
+
+	require.Len(t, asgSet.ASGs, 3)
+	for i, asg := range asgSet.ASGs {
+		assert.Equal(t, desiredASGs[i].AsgName, *asg.ASG.AutoScalingGroupName)
+		assert.Len(t, asg.Instances, 10)
+	}
+	assert.Len(t, asgSet.GetOldInstances(), 10)
+}
+
+func TestNewASGSetMixedInstancesPolicy(t *testing.T) {
+	ctx := context.Background()
+	sim := simulator.New()
+	require.NoError(t, sim.AddASG(simulator.ASGConfig{
+		Name:            "test-asg",
+		MinSize:         1,
+		MaxSize:         10,
+		DesiredCapacity: 4,
+		InstanceTypes:   []string{"m5.large", "c5.large"},
+	}))
+	desiredASGs := []*DesiredASG{{AsgName: "test-asg", DesiredCapacity: 4}}
+
+	oldCount := func() int {
+		asgSet, err := newASGSet(ctx, sim.Clients(), desiredASGs, false, false, nil, time.Now())
+		require.NoError(t, err)
+		return len(asgSet.GetOldInstances())
+	}
+	assert.Equal(t, 0, oldCount())
+
+	// Instances whose type was dropped from the policy are old
+	require.NoError(t, sim.SetInstanceTypes("test-asg", []string{"c5.large"}))
+	assert.Equal(t, 4, oldCount())
+
+	require.NoError(t, sim.SetInstanceTypes("test-asg", []string{"c5.large", "m5.large"}))
+	assert.Equal(t, 0, oldCount())
+
+	// As are those of a type whose override now has its own launch template, but not those of any other type
+	require.NoError(t, sim.NewOverrideTemplate("test-asg", "c5.large"))
+	assert.Equal(t, 0, oldCount())
+
+	require.NoError(t, sim.NewOverrideTemplate("test-asg", "m5.large"))
+	assert.Equal(t, 4, oldCount())
+}
+
+func TestForEachASGLimitsConcurrency(t *testing.T) {
+	desiredASGs := make([]*DesiredASG, 3*maxConcurrentASGs)
+	for i := range desiredASGs {
+		desiredASGs[i] = &DesiredASG{}
+	}
+
+	var running, most atomic.Int32
+	err := forEachASG(desiredASGs, func(i int, desASG *DesiredASG) error {
+		n := running.Add(1)
+		for {
+			m := most.Load()
+			if n <= m || most.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		running.Add(-1)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.LessOrEqual(t, most.Load(), int32(maxConcurrentASGs))
+}
@@ -0,0 +1,80 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// instanceAZ returns the AZ an instance is in, or "" if the ASG didn't say
+func instanceAZ(inst *Instance) string {
+	return aws.ToString(inst.ASGInstance.AvailabilityZone)
+}
+
+// healthyCountByAZ counts the healthy instances in each AZ across every ASG in the set, old and new alike
+func (a *ASGSet) healthyCountByAZ() map[string]int {
+	counts := make(map[string]int)
+	for _, asg := range a.ASGs {
+		for _, inst := range asg.Instances {
+			if inst.IsHealthy {
+				counts[instanceAZ(inst)]++
+			}
+		}
+	}
+	return counts
+}
+
+// betterVictim reports whether inst should be terminated before other.  Unhealthy instances go first, since
+// they aren't serving anyway, then ones from the AZ with the most healthy capacity left, then the oldest
+func betterVictim(inst, other *Instance, azCounts map[string]int) bool {
+	if inst.IsHealthy != other.IsHealthy {
+		return !inst.IsHealthy
+	}
+	if inst.IsHealthy {
+		instCount, otherCount := azCounts[instanceAZ(inst)], azCounts[instanceAZ(other)]
+		if instCount != otherCount {
+			return instCount > otherCount
+		}
+	}
+	return inst.EC2Instance.LaunchTime.Before(*other.EC2Instance.LaunchTime)
+}
+
+// OrderByAZBalance returns the given instances in the order they should be terminated, so that the healthy
+// instances left across the set stay as balanced across AZs as possible however many of them are taken
+func (a *ASGSet) OrderByAZBalance(instances []*Instance) []*Instance {
+	azCounts := a.healthyCountByAZ()
+	remaining := slices.Clone(instances)
+	ordered := make([]*Instance, 0, len(instances))
+
+	for len(remaining) > 0 {
+		best := 0
+		for i := range remaining {
+			if betterVictim(remaining[i], remaining[best], azCounts) {
+				best = i
+			}
+		}
+
+		victim := remaining[best]
+		ordered = append(ordered, victim)
+		remaining = slices.Delete(remaining, best, best+1)
+		if victim.IsHealthy {
+			azCounts[instanceAZ(victim)]--
+		}
+	}
+
+	return ordered
+}
@@ -0,0 +1,55 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	et "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func testAZInstance(id, az string, age time.Duration, old, healthy bool) *Instance {
+	return &Instance{
+		EC2Instance: &et.Instance{LaunchTime: aws.Time(time.Now().Add(-age))},
+		ASGInstance: &at.Instance{InstanceId: aws.String(id), AvailabilityZone: aws.String(az)},
+		IsOld:       old,
+		IsHealthy:   healthy,
+	}
+}
+
+func TestOrderByAZBalance(t *testing.T) {
+	asgSet := &ASGSet{ASGs: []*ASG{{Instances: []*Instance{
+		testAZInstance("a-oldest", "us-east-1a", 4*time.Hour, true, true),
+		testAZInstance("a-old", "us-east-1a", 3*time.Hour, true, true),
+		testAZInstance("b-old", "us-east-1b", 2*time.Hour, true, true),
+		testAZInstance("b-new", "us-east-1b", time.Minute, false, true),
+		testAZInstance("b-new-2", "us-east-1b", time.Minute, false, true),
+		testAZInstance("c-unhealthy", "us-east-1c", time.Hour, true, false),
+	}}}}
+
+	var ids []string
+	for _, inst := range asgSet.OrderByAZBalance(asgSet.GetOldInstances()) {
+		ids = append(ids, *inst.ASGInstance.InstanceId)
+	}
+
+	// Unhealthy first, then b for having the most healthy instances even though a's are older
+	assert.Equal(t, []string{"c-unhealthy", "b-old", "a-oldest", "a-old"}, ids)
+	assert.Equal(t, "c-unhealthy", *asgSet.GetBestOldInstance().ASGInstance.InstanceId)
+	assert.Nil(t, (&ASGSet{}).GetBestOldInstance())
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ParseBatchSize parses a batch size given either as a number of instances, e.g. "2", or as a percentage of desired
+// capacity, e.g. "25%", of at most 100%.  A percentage is returned as percent, with count left 0
+func ParseBatchSize(s string) (count int32, percent *int32, err error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil, nil
+	}
+
+	if strings.HasSuffix(s, "%") {
+		p, err := strconv.ParseInt(strings.TrimSuffix(s, "%"), 10, 32)
+		if err != nil || p <= 0 || p > 100 {
+			return 0, nil, errors.Errorf("batch size percentage must be a whole number from 1 to 100, got %s", s)
+		}
+		pct := int32(p)
+		return 0, &pct, nil
+	}
+
+	c, err := strconv.ParseInt(s, 10, 32)
+	if err != nil || c < 0 {
+		return 0, nil, errors.Errorf("batch size must be a whole number >= 0 or a percentage, got %s", s)
+	}
+	return int32(c), nil, nil
+}
+
+// ResolveBatchSize returns the batch size to use against the given desired capacity.  A BatchPercent is rounded up
+// when it's a surge above desired capacity and down when it's how many instances may be unavailable, but never
+// resolves to less than 1, which would never make progress.  Without one, BatchSize is returned as given
+func (r *BaseRunner) ResolveBatchSize(capacity int32, surge bool) int32 {
+	if r.Opts.BatchPercent == nil {
+		if r.Opts.BatchSize == nil {
+			return 0
+		}
+		return *r.Opts.BatchSize
+	}
+
+	percent := *r.Opts.BatchPercent
+	size := capacity * percent / 100
+	if surge && size*100 < capacity*percent {
+		size++
+	}
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
+// BatchSizeGiven returns the batch size as it was given, for logging
+func (r *BaseRunner) BatchSizeGiven() string {
+	if r.Opts.BatchPercent != nil {
+		return strconv.Itoa(int(*r.Opts.BatchPercent)) + "%"
+	}
+	if r.Opts.BatchSize == nil {
+		return "0"
+	}
+	return strconv.Itoa(int(*r.Opts.BatchSize))
+}
@@ -0,0 +1,64 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBatchSize(t *testing.T) {
+	count, percent, err := ParseBatchSize("3")
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), count)
+	assert.Nil(t, percent)
+
+	count, percent, err = ParseBatchSize("25%")
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), count)
+	assert.Equal(t, int32(25), *percent)
+
+	for _, s := range []string{"-1", "0%", "101%", "2147483647%", "25.5%", "abc", "%"} {
+		_, _, err = ParseBatchSize(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestResolveBatchSize(t *testing.T) {
+	for _, tc := range []struct {
+		percent  int32
+		capacity int32
+		surge    int32
+		down     int32
+	}{
+		{percent: 25, capacity: 60, surge: 15, down: 15},
+		{percent: 25, capacity: 10, surge: 3, down: 2},
+		{percent: 25, capacity: 3, surge: 1, down: 1},
+		{percent: 100, capacity: 3, surge: 3, down: 3},
+	} {
+		percent := tc.percent
+		r := BaseRunner{Opts: &RunnerOpts{BatchPercent: &percent}}
+		assert.Equal(t, tc.surge, r.ResolveBatchSize(tc.capacity, true), "%d%% of %d rounded up", tc.percent, tc.capacity)
+		assert.Equal(t, tc.down, r.ResolveBatchSize(tc.capacity, false), "%d%% of %d rounded down", tc.percent, tc.capacity)
+		assert.Equal(t, fmt.Sprintf("%d%%", tc.percent), r.BatchSizeGiven())
+	}
+
+	size := int32(2)
+	r := BaseRunner{Opts: &RunnerOpts{BatchSize: &size}}
+	assert.Equal(t, int32(2), r.ResolveBatchSize(60, true))
+}
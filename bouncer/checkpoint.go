@@ -0,0 +1,182 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// ASGCapacity is the capacity of an ASG before bouncer changed anything, and the processes bouncer suspended on it
+type ASGCapacity struct {
+	Name            string `json:"name"`
+	DesiredCapacity int32  `json:"desiredCapacity"`
+	MinSize         int32  `json:"minSize"`
+	MaxSize         int32  `json:"maxSize"`
+	// SuspendedProcesses are the scaling processes bouncer suspended, to be resumed when the run is over
+	SuspendedProcesses []string `json:"suspendedProcesses,omitempty"`
+	// Standby is the instances bouncer moved to Standby, to be brought back if the run is rolled back
+	Standby []string `json:"standby,omitempty"`
+	// Protected is the new instances bouncer protected from scale-in, to be unprotected when the run is over
+	Protected []string `json:"protected,omitempty"`
+}
+
+// Checkpoint is bouncer's record of what it was in the middle of doing, so an interrupted run can be resumed
+type Checkpoint struct {
+	Mode      string        `json:"mode"`
+	ASGs      []ASGCapacity `json:"asgs"`
+	Phase     int           `json:"phase"`
+	UpdatedAt time.Time     `json:"updatedAt"`
+}
+
+func readCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading checkpoint file %s", path)
+	}
+
+	var cp Checkpoint
+	err = json.Unmarshal(data, &cp)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing checkpoint file %s", path)
+	}
+
+	return &cp, nil
+}
+
+// loadCheckpoint reads the checkpoint to resume from, and makes sure it was written by a run of the same mode against the same ASGs
+func (r *BaseRunner) loadCheckpoint() error {
+	if r.Opts.CheckpointFile == "" {
+		return errors.New("resuming requires a checkpoint file")
+	}
+
+	cp, err := readCheckpoint(r.Opts.CheckpointFile)
+	if err != nil {
+		return err
+	}
+
+	if cp.Mode != r.mode {
+		return errors.Errorf("checkpoint was written by a %s run, can't resume it in %s mode", cp.Mode, r.mode)
+	}
+
+	if len(cp.ASGs) != len(r.asgs) {
+		return errors.Errorf("checkpoint has %d ASGs, but %d were given", len(cp.ASGs), len(r.asgs))
+	}
+
+	r.start = make(map[string]ASGCapacity)
+	r.protected = make(map[string]string)
+	for _, asg := range cp.ASGs {
+		r.start[asg.Name] = asg
+		for _, id := range asg.Protected {
+			r.protected[id] = asg.Name
+		}
+	}
+
+	for _, desASG := range r.asgs {
+		if _, ok := r.start[desASG.AsgName]; !ok {
+			return errors.Errorf("checkpoint has no record of ASG %s", desASG.AsgName)
+		}
+	}
+
+	r.checkpoint = cp
+	r.phase = cp.Phase
+
+	log.WithFields(log.Fields{
+		"Mode":      cp.Mode,
+		"Phase":     cp.Phase,
+		"UpdatedAt": cp.UpdatedAt,
+	}).Info("Resuming from checkpoint")
+
+	return nil
+}
+
+// saveCheckpoint records the mode, the starting capacity of each ASG, the instances protected from scale-in, and the
+// current phase
+func (r *BaseRunner) saveCheckpoint() error {
+	if r.Opts.CheckpointFile == "" || r.Opts.Noop {
+		return nil
+	}
+
+	cp := Checkpoint{
+		Mode:      r.mode,
+		Phase:     r.phase,
+		UpdatedAt: time.Now(),
+	}
+	for _, desASG := range r.asgs {
+		start := r.start[desASG.AsgName]
+		start.Protected = nil
+		for id, asgName := range r.protected {
+			if asgName == desASG.AsgName {
+				start.Protected = append(start.Protected, id)
+			}
+		}
+		slices.Sort(start.Protected)
+		cp.ASGs = append(cp.ASGs, start)
+	}
+
+	data, err := json.MarshalIndent(&cp, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "error serializing checkpoint")
+	}
+
+	// Write then rename, so that being killed mid-write never leaves a truncated checkpoint behind
+	tmp, err := os.CreateTemp(filepath.Dir(r.Opts.CheckpointFile), ".bouncer-checkpoint-*")
+	if err != nil {
+		return errors.Wrap(err, "error creating checkpoint file")
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "error writing checkpoint file")
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return errors.Wrap(err, "error writing checkpoint file")
+	}
+
+	err = os.Rename(tmp.Name(), r.Opts.CheckpointFile)
+	return errors.Wrapf(err, "error moving checkpoint into place at %s", r.Opts.CheckpointFile)
+}
+
+// RemoveCheckpoint deletes the checkpoint file, call this once a run has finished successfully
+func (r *BaseRunner) RemoveCheckpoint() error {
+	if r.Opts.CheckpointFile == "" || r.Opts.Noop {
+		return nil
+	}
+
+	err := os.Remove(r.Opts.CheckpointFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return errors.Wrapf(err, "error removing checkpoint file %s", r.Opts.CheckpointFile)
+}
+
+// StartingDesiredCapacity returns the desired capacity the ASG had before bouncer started changing it.
+// When resuming, this is the value recorded in the checkpoint rather than whatever it's currently set to
+func (r *BaseRunner) StartingDesiredCapacity(asg *ASG) int32 {
+	if r.checkpoint != nil {
+		return r.start[*asg.ASG.AutoScalingGroupName].DesiredCapacity
+	}
+	return *asg.ASG.DesiredCapacity
+}
@@ -16,23 +16,149 @@ package bouncer
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"io"
+	"os"
 	"os/exec"
+	"slices"
 	"strings"
+	"text/template"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
-func splitCommandString(fullCommand string) (string, []string) {
-	commandArr := strings.Split(fullCommand, " ")
-	command := commandArr[0]
-	var args []string
-	if len(commandArr) > 1 {
-		args = commandArr[1:]
+// CommandContext is what external commands are told about the instance they're run for, both as template
+// variables in their arguments, e.g. {{.InstanceID}}, and as BOUNCER_* environment variables.  It's also
+// what webhooks are sent about the instance
+type CommandContext struct {
+	InstanceID string `json:"instanceId"`
+	PrivateIP  string `json:"privateIp"`
+	ASG        string `json:"asg"`
+	AZ         string `json:"az"`
+	LaunchTime string `json:"launchTime"`
+}
+
+func newCommandContext(inst *Instance) CommandContext {
+	var launchTime string
+	if inst.EC2Instance.LaunchTime != nil {
+		launchTime = inst.EC2Instance.LaunchTime.UTC().Format(time.RFC3339)
+	}
+
+	return CommandContext{
+		InstanceID: aws.ToString(inst.ASGInstance.InstanceId),
+		PrivateIP:  aws.ToString(inst.EC2Instance.PrivateIpAddress),
+		ASG:        aws.ToString(inst.AutoscalingGroup.AutoScalingGroupName),
+		AZ:         aws.ToString(inst.ASGInstance.AvailabilityZone),
+		LaunchTime: launchTime,
+	}
+}
+
+func (c CommandContext) env() []string {
+	return []string{
+		"BOUNCER_INSTANCE_ID=" + c.InstanceID,
+		"BOUNCER_PRIVATE_IP=" + c.PrivateIP,
+		"BOUNCER_ASG=" + c.ASG,
+		"BOUNCER_AZ=" + c.AZ,
+		"BOUNCER_LAUNCH_TIME=" + c.LaunchTime,
 	}
-	return command, args
+}
+
+// splitCommandString splits a command into its argv the way a shell would, honoring single and double quotes
+// and backslash escapes, but without any expansion.  A blank command has no argv
+func splitCommandString(fullCommand string) ([]string, error) {
+	var argv []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+
+	for _, c := range fullCommand {
+		switch {
+		case escaped:
+			// Inside double quotes, a backslash only escapes what a shell would let it
+			if quote == '"' && !strings.ContainsRune(`"\$`+"`", c) {
+				arg.WriteRune('\\')
+			}
+			arg.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				argv = append(argv, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+
+	if escaped {
+		return nil, errors.Errorf("command '%s' ends with an unfinished escape", fullCommand)
+	}
+	if quote != 0 {
+		return nil, errors.Errorf("command '%s' has an unterminated %c quote", fullCommand, quote)
+	}
+	if inArg {
+		argv = append(argv, arg.String())
+	}
+
+	return argv, nil
+}
+
+// parseCommandTemplates parses each argument of argv as a template against CommandContext
+func parseCommandTemplates(argv []string) ([]*template.Template, error) {
+	tmpls := make([]*template.Template, len(argv))
+	for i, arg := range argv {
+		tmpl, err := template.New("arg").Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing argument '%s' of command", arg)
+		}
+		tmpls[i] = tmpl
+	}
+	return tmpls, nil
+}
+
+// usesTemplates reports whether any argument of argv uses a template variable, like {{.InstanceID}}
+func usesTemplates(argv []string) bool {
+	return slices.ContainsFunc(argv, func(arg string) bool {
+		return strings.Contains(arg, "{{")
+	})
+}
+
+// renderCommand fills in the template variables in each argument of argv
+func renderCommand(argv []string, cmdCtx CommandContext) ([]string, error) {
+	tmpls, err := parseCommandTemplates(argv)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered := make([]string, len(argv))
+	for i, tmpl := range tmpls {
+		var buf bytes.Buffer
+		err = tmpl.Execute(&buf, cmdCtx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error filling in argument '%s' of command", argv[i])
+		}
+		rendered[i] = buf.String()
+	}
+	return rendered, nil
 }
 
 func bufferResults(cmd *exec.Cmd, r io.Reader, inputType string) {
@@ -57,8 +183,9 @@ func bufferResults(cmd *exec.Cmd, r io.Reader, inputType string) {
 	// }
 }
 
-func getCmd(command string, args []string) (*exec.Cmd, error) {
+func getCmd(command string, args []string, env []string) (*exec.Cmd, error) {
 	cmd := exec.Command(command, args...)
+	cmd.Env = append(os.Environ(), env...)
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
@@ -75,13 +202,24 @@ func getCmd(command string, args []string) (*exec.Cmd, error) {
 	return cmd, nil
 }
 
-func (r *BaseRunner) executeExternalCommand(ctx context.Context, fullCommand string) error {
+// executeExternalCommand runs argv for inst until it exits or ctx is done, kind being what the command is for in log
+// messages.  Template variables in argv are filled in from inst, which is also described in BOUNCER_* env vars
+func (r *BaseRunner) executeExternalCommand(ctx context.Context, kind string, argv []string, inst *Instance) error {
 	tmout := r.Opts.ItemTimeout
-	command, args := splitCommandString(fullCommand)
-	log.Infof("Executing pre-terminate command '%s' with args '%s'", command, args)
-	r.noopCheck()
+	cmdCtx := newCommandContext(inst)
+	argv, err := renderCommand(argv, cmdCtx)
+	if err != nil {
+		return err
+	}
+
+	command, args := argv[0], argv[1:]
+	log.Infof("Executing %s command '%s' with args '%s'", kind, command, args)
+	if r.Opts.Noop {
+		log.Warnf("NOOP only - not actually executing %s command", kind)
+		return nil
+	}
 
-	cmd, err := getCmd(command, args)
+	cmd, err := getCmd(command, args, cmdCtx.env())
 	if err != nil {
 		return errors.Wrap(err, "error initializing cmd")
 	}
@@ -0,0 +1,83 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	et "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitCommandString(t *testing.T) {
+	for command, want := range map[string][]string{
+		"":                                      nil,
+		"echo hi":                               {"echo", "hi"},
+		"  echo   hi  ":                         {"echo", "hi"},
+		`/opt/my scripts/run`:                   {"/opt/my", "scripts/run"},
+		`'/opt/my scripts/run' --flag`:          {"/opt/my scripts/run", "--flag"},
+		`"/opt/my scripts/run" "a \"b\" \c"`:    {"/opt/my scripts/run", `a "b" \c`},
+		`/opt/my\ scripts/run 'it'"'"'s' ''`:    {"/opt/my scripts/run", "it's", ""},
+		`vault-step-down --node {{.PrivateIP}}`: {"vault-step-down", "--node", "{{.PrivateIP}}"},
+	} {
+		argv, err := splitCommandString(command)
+		require.NoError(t, err, command)
+		assert.Equal(t, want, argv, command)
+	}
+
+	for _, command := range []string{`echo 'hi`, `echo "hi`, `echo hi\`} {
+		_, err := splitCommandString(command)
+		assert.Error(t, err, command)
+	}
+}
+
+func TestRenderCommand(t *testing.T) {
+	launchTime := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	cmdCtx := newCommandContext(&Instance{
+		EC2Instance: &et.Instance{
+			PrivateIpAddress: aws.String("10.0.1.23"),
+			LaunchTime:       &launchTime,
+		},
+		ASGInstance: &at.Instance{
+			InstanceId:       aws.String("i-0123456789abcdef0"),
+			AvailabilityZone: aws.String("us-east-1a"),
+		},
+		AutoscalingGroup: &at.AutoScalingGroup{
+			AutoScalingGroupName: aws.String("test-asg"),
+		},
+	})
+
+	argv, err := renderCommand([]string{"step-down", "--node={{.InstanceID}}@{{.PrivateIP}}", "{{.ASG}}/{{.AZ}}", "{{.LaunchTime}}"}, cmdCtx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"step-down", "--node=i-0123456789abcdef0@10.0.1.23", "test-asg/us-east-1a", "2017-06-01T12:00:00Z"}, argv)
+
+	assert.Equal(t, []string{
+		"BOUNCER_INSTANCE_ID=i-0123456789abcdef0",
+		"BOUNCER_PRIVATE_IP=10.0.1.23",
+		"BOUNCER_ASG=test-asg",
+		"BOUNCER_AZ=us-east-1a",
+		"BOUNCER_LAUNCH_TIME=2017-06-01T12:00:00Z",
+	}, cmdCtx.env())
+
+	_, err = renderCommand([]string{"echo", "{{.Hostname}}"}, cmdCtx)
+	assert.Error(t, err)
+
+	_, err = parseCommandTemplates([]string{"echo", "{{.InstanceID"})
+	assert.Error(t, err)
+}
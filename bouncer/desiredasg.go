@@ -28,12 +28,12 @@ const desiredCapSeparator = ":"
 type DesiredASG struct {
 	AsgName         string
 	DesiredCapacity int32
-	// PreTerminateCmd is the external process that needs to be run before terminating an instance in this ASG
-	PreTerminateCmd *string
+	// PreTerminateCmd is the argv of the external process that needs to be run before terminating an instance in this ASG
+	PreTerminateCmd []string
 }
 
 // ExtractDesiredASG takes in a separator-separated string of asgname and desired capacity, and returns a DesiredASG pointer
-func ExtractDesiredASG(asgItem string, defaultDesired *int32, preTerminateCmd *string) (*DesiredASG, error) {
+func ExtractDesiredASG(asgItem string, defaultDesired *int32, preTerminateCmd []string) (*DesiredASG, error) {
 	asgItems := strings.Split(asgItem, desiredCapSeparator)
 	var desiredCapacity int32
 
@@ -0,0 +1,272 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// StdoutFile is the file name that sends events or the summary to stdout rather than to a file
+const StdoutFile = "-"
+
+// EventType is the kind of progress a runner reports
+type EventType string
+
+const (
+	// EventRunStarted is emitted once the runner has been set up
+	EventRunStarted EventType = "RunStarted"
+	// EventPhaseChanged is emitted when the runner starts acting on the ASGs again after they last settled
+	EventPhaseChanged EventType = "PhaseChanged"
+	// EventCapacitySet is emitted after the desired capacity of an ASG is changed
+	EventCapacitySet EventType = "CapacitySet"
+	// EventInstanceSelected is emitted when an instance is picked to be killed
+	EventInstanceSelected EventType = "InstanceSelected"
+	// EventCommandExecuted is emitted after the pre-terminate command has run, successfully or not
+	EventCommandExecuted EventType = "CommandExecuted"
+	// EventInstanceValidated is emitted after the validation command has run against a new instance, successfully or not
+	EventInstanceValidated EventType = "InstanceValidated"
+	// EventInstanceTerminated is emitted after an instance is terminated, or its lifecycle hook abandoned
+	EventInstanceTerminated EventType = "InstanceTerminated"
+	// EventInstanceRefreshStarted is emitted after an instance refresh is started
+	EventInstanceRefreshStarted EventType = "InstanceRefreshStarted"
+	// EventInstanceRefreshProgress is emitted when an instance refresh's status or percentage complete changes
+	EventInstanceRefreshProgress EventType = "InstanceRefreshProgress"
+	// EventWebhookCalled is emitted after a webhook has been called, including any retries, successfully or not
+	EventWebhookCalled EventType = "WebhookCalled"
+	// EventWaitingForSettle is emitted when the runner starts waiting for the ASGs to reach the state it wants
+	EventWaitingForSettle EventType = "WaitingForSettle"
+	// EventRunFinished is emitted when the run succeeds
+	EventRunFinished EventType = "RunFinished"
+	// EventRunFailed is emitted when the run errors out
+	EventRunFailed EventType = "RunFailed"
+)
+
+// Event is a single line of the event stream
+type Event struct {
+	Time            time.Time `json:"time"`
+	Type            EventType `json:"type"`
+	Mode            string    `json:"mode,omitempty"`
+	Noop            bool      `json:"noop,omitempty"`
+	Phase           int       `json:"phase,omitempty"`
+	ASG             string    `json:"asg,omitempty"`
+	InstanceID      string    `json:"instanceId,omitempty"`
+	DesiredCapacity *int32    `json:"desiredCapacity,omitempty"`
+	Decrement       bool      `json:"decrement,omitempty"`
+	Hook            string    `json:"hook,omitempty"`
+	Command         string    `json:"command,omitempty"`
+	DurationSeconds float64   `json:"durationSeconds,omitempty"`
+	RefreshID       string    `json:"refreshId,omitempty"`
+	Status          string    `json:"status,omitempty"`
+	PercentComplete *int32    `json:"percentComplete,omitempty"`
+	Webhook         string    `json:"webhook,omitempty"`
+	URL             string    `json:"url,omitempty"`
+	StatusCode      int       `json:"statusCode,omitempty"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// ReplacedInstance is an old instance that bouncer terminated
+type ReplacedInstance struct {
+	ASG        string `json:"asg"`
+	InstanceID string `json:"instanceId"`
+	// OldVersion and NewVersion are launch template versions, or launch configuration names for ASGs that use those
+	OldVersion   string    `json:"oldVersion"`
+	NewVersion   string    `json:"newVersion"`
+	Phase        int       `json:"phase"`
+	TerminatedAt time.Time `json:"terminatedAt"`
+}
+
+// PhaseDuration is how long a phase took, from its first action until the next phase started or the run ended
+type PhaseDuration struct {
+	Phase           int       `json:"phase"`
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	DurationSeconds float64   `json:"durationSeconds"`
+}
+
+// Summary is the end-of-run report
+type Summary struct {
+	Mode            string             `json:"mode"`
+	Noop            bool               `json:"noop"`
+	Success         bool               `json:"success"`
+	Error           string             `json:"error,omitempty"`
+	Start           time.Time          `json:"start"`
+	End             time.Time          `json:"end"`
+	DurationSeconds float64            `json:"durationSeconds"`
+	Replaced        []ReplacedInstance `json:"replaced"`
+	Phases          []PhaseDuration    `json:"phases"`
+}
+
+func openOutput(path string) (io.WriteCloser, error) {
+	if path == StdoutFile {
+		return os.Stdout, nil
+	}
+	// Append, so that a resumed run carries on the stream of the run it's resuming
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	return f, errors.Wrapf(err, "error opening %s", path)
+}
+
+// emit writes an event to the events file, if there is one
+func (r *BaseRunner) emit(event Event) {
+	if r.events == nil {
+		return
+	}
+
+	event.Time = time.Now()
+	err := r.events.Encode(&event)
+	if err != nil {
+		log.Error(errors.Wrap(err, "error writing event"))
+	}
+}
+
+// startPhase is called on the first action after the ASGs last settled
+func (r *BaseRunner) startPhase() {
+	now := time.Now()
+	r.closePhase(now)
+	r.phases = append(r.phases, PhaseDuration{Phase: r.phase + 1, Start: now})
+	r.metrics.phase.Set(float64(r.phase + 1))
+	r.emit(Event{Type: EventPhaseChanged, Phase: r.phase + 1})
+}
+
+func (r *BaseRunner) closePhase(end time.Time) {
+	if len(r.phases) == 0 {
+		return
+	}
+	last := &r.phases[len(r.phases)-1]
+	if last.End.IsZero() {
+		last.End = end
+		last.DurationSeconds = end.Sub(last.Start).Seconds()
+	}
+}
+
+// recordReplaced notes an old instance that's just been terminated, for the summary
+func (r *BaseRunner) recordReplaced(ctx context.Context, inst *Instance) {
+	replaced := ReplacedInstance{
+		ASG:          *inst.AutoscalingGroup.AutoScalingGroupName,
+		InstanceID:   *inst.ASGInstance.InstanceId,
+		Phase:        r.phase + 1,
+		TerminatedAt: time.Now(),
+	}
+
+	if inst.ASGInstance.LaunchTemplate != nil && inst.ASGInstance.LaunchTemplate.Version != nil {
+		replaced.OldVersion = *inst.ASGInstance.LaunchTemplate.Version
+	} else if inst.ASGInstance.LaunchConfigurationName != nil {
+		replaced.OldVersion = *inst.ASGInstance.LaunchConfigurationName
+	}
+
+	if inst.AutoscalingGroup.LaunchConfigurationName != nil {
+		replaced.NewVersion = *inst.AutoscalingGroup.LaunchConfigurationName
+	} else {
+		version, err := r.awsClients.ASGLTplVersionToEC2LTplVersion(ctx, r.awsClients.GetLaunchTemplateSpec(inst.AutoscalingGroup))
+		if err != nil {
+			log.Warn(errors.Wrap(err, "error resolving new launch template version for run summary"))
+		} else if version != nil {
+			replaced.NewVersion = *version
+		}
+	}
+
+	r.replaced = append(r.replaced, replaced)
+}
+
+// Finish records the outcome of the run in the event stream and writes the summary file, if either was asked for.
+// Only the first call does anything, so it's safe to also call from an exit handler
+func (r *BaseRunner) Finish(runErr error) {
+	if r.finished {
+		return
+	}
+	r.finished = true
+
+	r.resumeProcesses()
+	r.unprotectNewInstances()
+
+	end := time.Now()
+	r.closePhase(end)
+
+	event := Event{Type: EventRunFinished, Phase: r.phase}
+	if runErr != nil {
+		event.Type = EventRunFailed
+		event.Error = runErr.Error()
+	}
+
+	// The run's own context may be what ended it, so the webhook gets one of its own
+	success := runErr == nil
+	ctx, cancel := context.WithTimeout(context.Background(), r.Opts.ItemTimeout)
+	defer cancel()
+	err := r.callWebhook(ctx, WebhookRunFinished, WebhookPayload{Success: &success, Error: event.Error})
+	if err != nil {
+		log.Error(err)
+	}
+
+	r.emit(event)
+	r.metrics.shutdown()
+
+	if r.eventsFile != nil && r.eventsFile != os.Stdout {
+		err := r.eventsFile.Close()
+		if err != nil {
+			log.Error(errors.Wrap(err, "error closing events file"))
+		}
+	}
+
+	if r.Opts.SummaryFile == "" {
+		return
+	}
+
+	summary := Summary{
+		Mode:            r.mode,
+		Noop:            r.Opts.Noop,
+		Success:         runErr == nil,
+		Start:           r.startTime,
+		End:             end,
+		DurationSeconds: end.Sub(r.startTime).Seconds(),
+		Replaced:        r.replaced,
+		Phases:          r.phases,
+	}
+	if runErr != nil {
+		summary.Error = runErr.Error()
+	}
+	if summary.Replaced == nil {
+		summary.Replaced = []ReplacedInstance{}
+	}
+	if summary.Phases == nil {
+		summary.Phases = []PhaseDuration{}
+	}
+
+	err = writeSummary(r.Opts.SummaryFile, &summary)
+	if err != nil {
+		log.Error(errors.Wrap(err, "error writing run summary"))
+	}
+}
+
+func writeSummary(path string, summary *Summary) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "error serializing summary")
+	}
+	data = append(data, '\n')
+
+	if path == StdoutFile {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	err = os.WriteFile(path, data, 0644)
+	return errors.Wrapf(err, "error writing %s", path)
+}
@@ -15,13 +15,11 @@
 package bouncer
 
 import (
-	"context"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
 	et "github.com/aws/aws-sdk-go-v2/service/ec2/types"
-	"github.com/palantir/bouncer/aws"
-	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -32,33 +30,23 @@ type Instance struct {
 	AutoscalingGroup *at.AutoScalingGroup
 	IsOld            bool
 	IsHealthy        bool
-	PreTerminateCmd  *string
+	// IsProtected is whether the instance is protected from scale-in, so AWS won't pick it when desired capacity drops
+	IsProtected     bool
+	PreTerminateCmd []string
 }
 
-// NewInstance returns a new bouncer.Instance object
-func NewInstance(ctx context.Context, ac *aws.Clients, asg *at.AutoScalingGroup, asgInst at.Instance, force bool, startTime time.Time, preTerminateCmd *string) (*Instance, error) {
-	ec2Inst, err := ac.ASGInstToEC2Inst(ctx, asgInst)
-	if err != nil {
-		return nil, errors.Wrapf(err, "error converting ASG Inst to EC2 inst for %s", *asgInst.InstanceId)
-	}
-
-	lts := ac.GetLaunchTemplateSpec(asg)
-
-	ec2LTplVersion, err := ac.ASGLTplVersionToEC2LTplVersion(ctx, lts)
-	if err != nil {
-		return nil, errors.Wrapf(err, "error resolving LaunchTemplate %s Version to actual version number", *lts.LaunchTemplateId)
-	}
-
-	inst := Instance{
+// NewInstance returns a new bouncer.Instance object.  The EC2 instance, and the version the ASG's launch template
+// spec resolves to, are looked up by the caller, so they can be fetched once for the whole ASG
+func NewInstance(asg *at.AutoScalingGroup, asgInst at.Instance, ec2Inst *et.Instance, lts *at.LaunchTemplateSpecification, ec2LTplVersion *string, force bool, startTime time.Time, preTerminateCmd []string) *Instance {
+	return &Instance{
 		EC2Instance:      ec2Inst,
 		ASGInstance:      &asgInst,
 		AutoscalingGroup: asg,
 		IsOld:            isInstanceOld(&asgInst, ec2Inst, asg.LaunchConfigurationName, lts, ec2LTplVersion, force, startTime),
 		IsHealthy:        isInstanceHealthy(&asgInst, ec2Inst),
+		IsProtected:      aws.ToBool(asgInst.ProtectedFromScaleIn),
 		PreTerminateCmd:  preTerminateCmd,
 	}
-
-	return &inst, nil
 }
 
 func isInstanceOld(asgInst *at.Instance, ec2Inst *et.Instance, asgLCName *string, asgLT *at.LaunchTemplateSpecification, asgLTVer *string, force bool, startTime time.Time) bool {
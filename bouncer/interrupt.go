@@ -0,0 +1,80 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrInterrupted is returned by a run that was stopped by Opts.Interrupt
+var ErrInterrupted = errors.New("bouncer was interrupted")
+
+// Interrupted returns whether Opts.Interrupt has been closed
+func (r *BaseRunner) Interrupted() bool {
+	select {
+	case <-r.Opts.Interrupt:
+		return true
+	default:
+		return false
+	}
+}
+
+// stopForInterrupt is called in place of building the next ASGSet once the run's been interrupted, so no more
+// instances are terminated.  It either waits for the changes already in flight to settle, or, with
+// Opts.RestoreOnInterrupt, puts each ASG back at the desired capacity it started at
+func (r *BaseRunner) stopForInterrupt() error {
+	ctx, cancel := r.NewContext()
+	defer cancel()
+
+	if r.Opts.RestoreOnInterrupt {
+		log.Warn("Interrupted, restoring the starting desired capacity of each ASG")
+		err := r.restoreStartingCapacity(ctx, false)
+		if err != nil {
+			return errors.Wrap(err, "error restoring desired capacity after interrupt")
+		}
+		return ErrInterrupted
+	}
+
+	log.Warn("Interrupted, waiting for changes in flight to finish")
+	for {
+		asgSet, err := newASGSet(ctx, r.awsClients, r.asgs, r.Opts.Force, r.Opts.LBHealth, r.killed, r.startTime)
+		if err != nil {
+			return errors.Wrap(err, "error building ASGSet after interrupt")
+		}
+
+		if !asgSet.IsTransient() {
+			return ErrInterrupted
+		}
+
+		if r.Opts.Noop {
+			// Nothing is actually in flight
+			return ErrInterrupted
+		}
+
+		sleep := waitBetweenChecks
+		if r.Opts.CheckInterval != 0 {
+			sleep = r.Opts.CheckInterval
+		}
+
+		select {
+		case <-time.After(sleep):
+		case <-ctx.Done():
+			return errors.Wrap(ErrInterrupted, "timed out waiting for changes in flight to finish")
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"context"
+	"fmt"
+
+	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	tt "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	"github.com/palantir/bouncer/aws"
+	"github.com/pkg/errors"
+)
+
+const elbInService = "InService"
+
+// DrainingTarget is a target still being deregistered from one of an ASG's target groups
+type DrainingTarget struct {
+	TargetGroupARN string
+	TargetID       string
+}
+
+// lbStatus is how an ASG's instances look to the target groups and classic ELBs attached to it
+type lbStatus struct {
+	// unhealthy maps each instance that isn't healthy in every load balancer to why
+	unhealthy map[string]string
+	// draining is only the targets bouncer is responsible for, since target groups are often shared with other ASGs
+	draining []DrainingTarget
+}
+
+// getLBStatus checks the health of the ASG's instances in every target group and classic ELB attached to it.
+// An instance that isn't registered with one of them at all counts as unhealthy.  Draining targets are only kept if
+// they're the ASG's instances or were terminated by this run, in killed.  Targets can only be matched to instances in
+// instance-type target groups, so any other type is an error
+func getLBStatus(ctx context.Context, ac *aws.Clients, asg *at.AutoScalingGroup, killed map[string]bool) (*lbStatus, error) {
+	health := lbStatus{
+		unhealthy: make(map[string]string),
+	}
+
+	members := make(map[string]bool)
+	for _, inst := range asg.Instances {
+		members[*inst.InstanceId] = true
+	}
+
+	if len(asg.TargetGroupARNs) > 0 {
+		groups, err := ac.GetTargetGroups(ctx, asg.TargetGroupARNs)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error getting target groups for ASG %s", *asg.AutoScalingGroupName)
+		}
+		for _, group := range groups {
+			if group.TargetType != tt.TargetTypeEnumInstance {
+				return nil, errors.Errorf("target group %s of ASG %s has %s targets, but health can only be checked in instance target groups",
+					*group.TargetGroupArn, *asg.AutoScalingGroupName, group.TargetType)
+			}
+		}
+	}
+
+	for _, tgARN := range asg.TargetGroupARNs {
+		descs, err := ac.GetTargetHealth(ctx, tgARN)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error getting target health for ASG %s", *asg.AutoScalingGroupName)
+		}
+
+		healthy := make(map[string]bool)
+		for _, desc := range descs {
+			if desc.Target == nil || desc.Target.Id == nil || desc.TargetHealth == nil {
+				continue
+			}
+			id := *desc.Target.Id
+			state := desc.TargetHealth.State
+
+			if (state == tt.TargetHealthStateEnumDraining || state == tt.TargetHealthStateEnumUnhealthyDraining) && (members[id] || killed[id]) {
+				health.draining = append(health.draining, DrainingTarget{TargetGroupARN: tgARN, TargetID: id})
+			}
+
+			// An instance registered on several ports is only healthy if it's healthy on all of them
+			isHealthy, seen := healthy[id]
+			healthy[id] = state == tt.TargetHealthStateEnumHealthy && (!seen || isHealthy)
+			if !healthy[id] {
+				health.markUnhealthy(id, fmt.Sprintf("target is %s in %s", state, tgARN))
+			}
+		}
+
+		for _, inst := range asg.Instances {
+			if _, ok := healthy[*inst.InstanceId]; !ok {
+				health.markUnhealthy(*inst.InstanceId, fmt.Sprintf("not registered with %s", tgARN))
+			}
+		}
+	}
+
+	for _, lbName := range asg.LoadBalancerNames {
+		states, err := ac.GetELBInstanceHealth(ctx, lbName)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error getting ELB instance health for ASG %s", *asg.AutoScalingGroupName)
+		}
+
+		registered := make(map[string]bool)
+		for _, state := range states {
+			if state.InstanceId == nil {
+				continue
+			}
+			registered[*state.InstanceId] = true
+
+			if state.State == nil || *state.State != elbInService {
+				health.markUnhealthy(*state.InstanceId, fmt.Sprintf("not InService in ELB %s", lbName))
+			}
+		}
+
+		for _, inst := range asg.Instances {
+			if !registered[*inst.InstanceId] {
+				health.markUnhealthy(*inst.InstanceId, fmt.Sprintf("not registered with ELB %s", lbName))
+			}
+		}
+	}
+
+	return &health, nil
+}
+
+// markUnhealthy keeps the first reason an instance was found unhealthy
+func (h *lbStatus) markUnhealthy(instanceID string, reason string) {
+	if _, ok := h.unhealthy[instanceID]; !ok {
+		h.unhealthy[instanceID] = reason
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+const metricsNamespace = "bouncer"
+
+// metrics are the Prometheus metrics for a single run, kept in their own registry rather than the global one
+type metrics struct {
+	registry *prometheus.Registry
+	server   *http.Server
+
+	oldInstances         *prometheus.GaugeVec
+	newInstances         *prometheus.GaugeVec
+	healthyInstances     *prometheus.GaugeVec
+	unhealthyInstances   *prometheus.GaugeVec
+	desiredCapacity      *prometheus.GaugeVec
+	finalDesiredCapacity *prometheus.GaugeVec
+	phase                prometheus.Gauge
+	terminations         *prometheus.CounterVec
+	abandons             *prometheus.CounterVec
+	commandFailures      *prometheus.CounterVec
+	commandSeconds       *prometheus.CounterVec
+	refreshPercent       *prometheus.GaugeVec
+	validateFailures     *prometheus.CounterVec
+	webhookFailures      *prometheus.CounterVec
+}
+
+func newMetrics() *metrics {
+	asgGauge := func(name, help string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{Namespace: metricsNamespace, Name: name, Help: help}, []string{"asg"})
+	}
+	asgCounter := func(name, help string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: metricsNamespace, Name: name, Help: help}, []string{"asg"})
+	}
+
+	m := metrics{
+		registry:             prometheus.NewRegistry(),
+		oldInstances:         asgGauge("old_instances", "Instances in the ASG that need to be replaced"),
+		newInstances:         asgGauge("new_instances", "Instances in the ASG that are already up to date"),
+		healthyInstances:     asgGauge("healthy_instances", "Instances in the ASG that are running and InService"),
+		unhealthyInstances:   asgGauge("unhealthy_instances", "Instances in the ASG that aren't running and InService"),
+		desiredCapacity:      asgGauge("desired_capacity", "Current desired capacity of the ASG"),
+		finalDesiredCapacity: asgGauge("final_desired_capacity", "Desired capacity the ASG will be left at once the run finishes"),
+		phase: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "phase",
+			Help:      "Current phase of the run, a phase being every action taken before waiting for the ASGs to settle",
+		}),
+		terminations:     asgCounter("terminations_total", "Instances terminated"),
+		abandons:         asgCounter("lifecycle_abandons_total", "Lifecycle hooks issued an ABANDON"),
+		commandFailures:  asgCounter("pre_terminate_command_failures_total", "Pre-terminate commands that failed"),
+		commandSeconds:   asgCounter("pre_terminate_command_seconds_total", "Time spent running pre-terminate commands"),
+		validateFailures: asgCounter("validate_command_failures_total", "New instances that failed the validation command"),
+		refreshPercent:   asgGauge("instance_refresh_percent_complete", "Percentage complete of the ASG's instance refresh, in instance-refresh mode"),
+		webhookFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "webhook_failures_total",
+			Help:      "Webhooks that failed, after any retries",
+		}, []string{"webhook"}),
+	}
+
+	m.registry.MustRegister(
+		m.oldInstances,
+		m.newInstances,
+		m.healthyInstances,
+		m.unhealthyInstances,
+		m.desiredCapacity,
+		m.finalDesiredCapacity,
+		m.phase,
+		m.terminations,
+		m.abandons,
+		m.commandFailures,
+		m.commandSeconds,
+		m.refreshPercent,
+		m.validateFailures,
+		m.webhookFailures,
+	)
+
+	return &m
+}
+
+// serve starts serving the metrics on addr in the background
+func (m *metrics) serve(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrapf(err, "error listening on %s", addr)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	m.server = &http.Server{Handler: mux}
+
+	log.WithFields(log.Fields{
+		"Address": listener.Addr().String(),
+	}).Info("Serving metrics")
+
+	go func() {
+		err := m.server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			log.Error(errors.Wrap(err, "error serving metrics"))
+		}
+	}()
+
+	return nil
+}
+
+func (m *metrics) shutdown() {
+	if m.server == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := m.server.Shutdown(ctx)
+	if err != nil {
+		log.Error(errors.Wrap(err, "error shutting down metrics server"))
+	}
+}
+
+// observeASGs sets the per-ASG gauges from the latest view of the ASGs
+func (m *metrics) observeASGs(asgSet *ASGSet) {
+	for _, asg := range asgSet.ASGs {
+		name := *asg.ASG.AutoScalingGroupName
+
+		var old, healthy int
+		for _, inst := range asg.Instances {
+			if inst.IsOld {
+				old++
+			}
+			if inst.IsHealthy {
+				healthy++
+			}
+		}
+
+		m.oldInstances.WithLabelValues(name).Set(float64(old))
+		m.newInstances.WithLabelValues(name).Set(float64(len(asg.Instances) - old))
+		m.healthyInstances.WithLabelValues(name).Set(float64(healthy))
+		m.unhealthyInstances.WithLabelValues(name).Set(float64(len(asg.Instances) - healthy))
+		m.desiredCapacity.WithLabelValues(name).Set(float64(*asg.ASG.DesiredCapacity))
+		m.finalDesiredCapacity.WithLabelValues(name).Set(float64(asg.DesiredASG.DesiredCapacity))
+	}
+}
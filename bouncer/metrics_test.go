@@ -0,0 +1,54 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserveASGs(t *testing.T) {
+	m := newMetrics()
+
+	asgSet := &ASGSet{
+		ASGs: []*ASG{
+			{
+				ASG: &at.AutoScalingGroup{
+					AutoScalingGroupName: aws.String("test-asg"),
+					DesiredCapacity:      aws.Int32(4),
+				},
+				DesiredASG: &DesiredASG{AsgName: "test-asg", DesiredCapacity: 3},
+				Instances: []*Instance{
+					{IsOld: true, IsHealthy: true},
+					{IsOld: true, IsHealthy: true},
+					{IsOld: false, IsHealthy: true},
+					{IsOld: false, IsHealthy: false},
+				},
+			},
+		},
+	}
+	m.observeASGs(asgSet)
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.oldInstances.WithLabelValues("test-asg")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.newInstances.WithLabelValues("test-asg")))
+	assert.Equal(t, float64(3), testutil.ToFloat64(m.healthyInstances.WithLabelValues("test-asg")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.unhealthyInstances.WithLabelValues("test-asg")))
+	assert.Equal(t, float64(4), testutil.ToFloat64(m.desiredCapacity.WithLabelValues("test-asg")))
+	assert.Equal(t, float64(3), testutil.ToFloat64(m.finalDesiredCapacity.WithLabelValues("test-asg")))
+}
@@ -0,0 +1,135 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"context"
+
+	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/palantir/bouncer/aws"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// launchTemplates is every launch template an ASG's instances can be launched from, with their versions resolved,
+// so they're only looked up once for the whole ASG.  The instances distribution isn't compared, so an on-demand or
+// spot change doesn't make any instance old
+type launchTemplates struct {
+	spec    *at.LaunchTemplateSpecification
+	version *string
+	// byType is the template each instance type overridden in the ASG's mixed instances policy is launched from
+	byType map[string]resolvedTemplate
+	// restrictsTypes is set if the policy lists every instance type it allows, rather than picking some by attributes
+	restrictsTypes bool
+}
+
+type resolvedTemplate struct {
+	spec    *at.LaunchTemplateSpecification
+	version *string
+}
+
+type templateKey struct {
+	id      string
+	version string
+}
+
+// resolveLaunchTemplates looks up the ASG's launch template, and those of any mixed instances policy overrides
+func resolveLaunchTemplates(ctx context.Context, ac *aws.Clients, awsAsg *at.AutoScalingGroup) (*launchTemplates, error) {
+	// Overrides often share a template, which is only resolved once
+	resolved := make(map[templateKey]*string)
+	resolve := func(spec *at.LaunchTemplateSpecification) (*string, error) {
+		if spec == nil {
+			return nil, nil
+		}
+		key := templateKey{id: *spec.LaunchTemplateId}
+		if spec.Version != nil {
+			key.version = *spec.Version
+		}
+		if version, ok := resolved[key]; ok {
+			return version, nil
+		}
+
+		version, err := ac.ASGLTplVersionToEC2LTplVersion(ctx, spec)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error resolving LaunchTemplate %s Version to actual version number", *spec.LaunchTemplateId)
+		}
+		resolved[key] = version
+		return version, nil
+	}
+
+	lts := ac.GetLaunchTemplateSpec(awsAsg)
+	version, err := resolve(lts)
+	if err != nil {
+		return nil, err
+	}
+	templates := launchTemplates{
+		spec:    lts,
+		version: version,
+	}
+
+	policy := awsAsg.MixedInstancesPolicy
+	if policy == nil || policy.LaunchTemplate == nil || len(policy.LaunchTemplate.Overrides) == 0 {
+		return &templates, nil
+	}
+
+	templates.byType = make(map[string]resolvedTemplate)
+	templates.restrictsTypes = true
+	for _, override := range policy.LaunchTemplate.Overrides {
+		if override.InstanceType == nil {
+			// Instance types picked by their attributes can't be checked against a list
+			templates.restrictsTypes = false
+			continue
+		}
+
+		t := resolvedTemplate{spec: lts, version: version}
+		if override.LaunchTemplateSpecification != nil {
+			t.spec = override.LaunchTemplateSpecification
+			t.version, err = resolve(t.spec)
+			if err != nil {
+				return nil, err
+			}
+		}
+		templates.byType[*override.InstanceType] = t
+	}
+
+	return &templates, nil
+}
+
+// forInstance returns the launch template the instance should have been launched from, and the version it resolves to,
+// which for an overridden instance type is the override's
+func (l *launchTemplates) forInstance(asgInst *at.Instance) (*at.LaunchTemplateSpecification, *string) {
+	if asgInst.InstanceType != nil {
+		if t, ok := l.byType[*asgInst.InstanceType]; ok {
+			return t.spec, t.version
+		}
+	}
+	return l.spec, l.version
+}
+
+// allowsType returns whether the ASG's mixed instances policy still allows the instance's type
+func (l *launchTemplates) allowsType(asgInst *at.Instance) bool {
+	if !l.restrictsTypes || asgInst.InstanceType == nil {
+		return true
+	}
+
+	if _, ok := l.byType[*asgInst.InstanceType]; !ok {
+		log.WithFields(log.Fields{
+			"InstanceID":   *asgInst.InstanceId,
+			"InstanceType": *asgInst.InstanceType,
+		}).Debug("Instance marked as old because its instance type is no longer in the ASG's mixed instances policy")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,209 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"context"
+
+	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	et "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/palantir/bouncer/aws"
+	"github.com/palantir/bouncer/simulator"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxNoopChecks bounds how many times a noop run will re-check the projected ASGs before giving up,
+// since there's no wall-clock wait between checks to eventually trip the timeout
+const maxNoopChecks = 10000
+
+// ActionKind is the type of mutating call bouncer makes against AWS
+type ActionKind string
+
+const (
+	// ActionSetDesiredCapacity is a call to SetDesiredCapacity
+	ActionSetDesiredCapacity ActionKind = "SetDesiredCapacity"
+	// ActionTerminateInstance is a call to TerminateInstanceInAutoScalingGroup
+	ActionTerminateInstance ActionKind = "TerminateInstance"
+	// ActionAbandonLifecycle is a call to CompleteLifecycleAction with ABANDON
+	ActionAbandonLifecycle ActionKind = "AbandonLifecycle"
+	// ActionPreTerminateCommand is the execution of the user-supplied pre-terminate command
+	ActionPreTerminateCommand ActionKind = "PreTerminateCommand"
+	// ActionPreTerminateWebhook is the call to the user-supplied pre-terminate webhook
+	ActionPreTerminateWebhook ActionKind = "PreTerminateWebhook"
+	// ActionStartInstanceRefresh is a call to StartInstanceRefresh
+	ActionStartInstanceRefresh ActionKind = "StartInstanceRefresh"
+	// ActionStopInstanceRefresh is a call to CancelInstanceRefresh, or RollbackInstanceRefresh if Rollback is set
+	ActionStopInstanceRefresh ActionKind = "StopInstanceRefresh"
+	// ActionRemoveScaleInProtection is a call to SetInstanceProtection to unprotect an old instance about to be terminated
+	ActionRemoveScaleInProtection ActionKind = "RemoveScaleInProtection"
+	// ActionEnterStandby is a call to EnterStandby for one instance
+	ActionEnterStandby ActionKind = "EnterStandby"
+	// ActionExitStandby is a call to ExitStandby for one instance
+	ActionExitStandby ActionKind = "ExitStandby"
+)
+
+// Action records a single mutating step bouncer took, or in noop mode, would have taken
+type Action struct {
+	// Phase is incremented every time bouncer waits for the ASGs to settle after acting on them
+	Phase           int
+	Kind            ActionKind
+	ASG             string
+	InstanceID      string
+	DesiredCapacity int32
+	Decrement       bool
+	Hook            string
+	Command         string
+	URL             string
+	Rollback        bool
+}
+
+// newNoopClients snapshots the current state of the given ASGs into a simulator, so that a noop run
+// can walk its whole plan against a projection of the ASGs instead of stopping at its first mutation.
+// The projection assumes new instances come up healthy and terminated ones go away
+func newNoopClients(ctx context.Context, ac *aws.Clients, desiredASGs []*DesiredASG) (*aws.Clients, error) {
+	sim := simulator.New()
+
+	for _, desASG := range desiredASGs {
+		asg, err := ac.GetASG(ctx, desASG.AsgName)
+		if err != nil {
+			return nil, errors.Wrap(err, "error getting AWS ASG object")
+		}
+
+		var warm []at.Instance
+		if asg.WarmPoolConfiguration != nil {
+			warm, err = ac.GetWarmPool(ctx, desASG.AsgName)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		ids := instanceIDs(asg)
+		for _, asgInst := range warm {
+			ids = append(ids, *asgInst.InstanceId)
+		}
+		described, err := ac.GetEC2Instances(ctx, ids)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error describing EC2 instances of ASG %s", desASG.AsgName)
+		}
+
+		var ec2Insts []*et.Instance
+		for _, id := range ids {
+			ec2Insts = append(ec2Insts, described[id])
+		}
+
+		// Overrides in a mixed instances policy can each have their own launch template
+		specs := []*at.LaunchTemplateSpecification{ac.GetLaunchTemplateSpec(asg)}
+		if asg.MixedInstancesPolicy != nil && asg.MixedInstancesPolicy.LaunchTemplate != nil {
+			for _, override := range asg.MixedInstancesPolicy.LaunchTemplate.Overrides {
+				specs = append(specs, override.LaunchTemplateSpecification)
+			}
+		}
+
+		var lts []*et.LaunchTemplate
+		seen := make(map[string]bool)
+		for _, spec := range specs {
+			if spec == nil || seen[*spec.LaunchTemplateId] {
+				continue
+			}
+			seen[*spec.LaunchTemplateId] = true
+
+			lt, err := ac.GetLaunchTemplate(ctx, spec)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error getting LaunchTemplate %s", *spec.LaunchTemplateId)
+			}
+			lts = append(lts, lt)
+		}
+
+		err = sim.LoadASG(asg, warm, ec2Insts, lts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error projecting state of ASG %s", desASG.AsgName)
+		}
+	}
+
+	return sim.Clients(), nil
+}
+
+// recordAction must be called before the action is taken, so the checkpoint is on disk before anything changes
+func (r *BaseRunner) recordAction(action Action) error {
+	first := len(r.actions) == 0
+	if first {
+		err := r.suspendProcesses()
+		if err != nil {
+			return errors.Wrap(err, "error suspending scaling processes")
+		}
+	}
+	if !r.actedThisPhase {
+		r.startPhase()
+	}
+	r.waiting = false
+
+	action.Phase = r.phase
+	r.actions = append(r.actions, action)
+	r.actedThisPhase = true
+
+	if first {
+		return errors.Wrap(r.saveCheckpoint(), "error writing checkpoint")
+	}
+	return nil
+}
+
+// Actions returns every mutating step taken so far, in order
+func (r *BaseRunner) Actions() []Action {
+	return r.actions
+}
+
+// LogNoopPlan prints every step a noop run would have taken, in order
+func (r *BaseRunner) LogNoopPlan() {
+	if len(r.actions) == 0 {
+		log.Warn("NOOP only - no actions would have been taken")
+		return
+	}
+
+	log.Warnf("NOOP only - the full run would have taken the following %d actions", len(r.actions))
+	for i, action := range r.actions {
+		fields := log.Fields{
+			"Step":  i + 1,
+			"Phase": action.Phase,
+			"ASG":   action.ASG,
+		}
+
+		switch action.Kind {
+		case ActionSetDesiredCapacity:
+			fields["NewDesiredCap"] = action.DesiredCapacity
+		case ActionTerminateInstance:
+			fields["InstanceID"] = action.InstanceID
+			fields["Decrement"] = action.Decrement
+		case ActionAbandonLifecycle:
+			fields["InstanceID"] = action.InstanceID
+			fields["Hook"] = action.Hook
+		case ActionPreTerminateCommand:
+			fields["InstanceID"] = action.InstanceID
+			fields["Command"] = action.Command
+		case ActionPreTerminateWebhook:
+			fields["InstanceID"] = action.InstanceID
+			fields["URL"] = action.URL
+		case ActionRemoveScaleInProtection, ActionExitStandby:
+			fields["InstanceID"] = action.InstanceID
+		case ActionEnterStandby:
+			fields["InstanceID"] = action.InstanceID
+			fields["Decrement"] = action.Decrement
+		case ActionStopInstanceRefresh:
+			fields["Rollback"] = action.Rollback
+		}
+
+		log.WithFields(fields).Warn(string(action.Kind))
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+// PlanPhase summarises what a run does to one ASG in one phase, where a phase is every action bouncer
+// takes before it next waits for the ASGs to settle
+type PlanPhase struct {
+	Phase int    `json:"phase"`
+	ASG   string `json:"asg"`
+	// DesiredCapacity is the ASG's desired capacity once this phase's actions have been taken
+	DesiredCapacity int32    `json:"desiredCapacity"`
+	Terminate       []string `json:"terminate"`
+	Decrement       bool     `json:"decrement"`
+	// Standby is the instances moved to Standby this phase, and Restore those brought back out of it
+	Standby []string `json:"standby,omitempty"`
+	Restore []string `json:"restore,omitempty"`
+	// PeakInService and MinInService are the extremes of healthy instances from the start of this phase until the next one
+	PeakInService int32 `json:"peakInService"`
+	MinInService  int32 `json:"minInService"`
+}
+
+type phaseASG struct {
+	phase int
+	asg   string
+}
+
+type inServiceRange struct {
+	peak int32
+	min  int32
+}
+
+// observe records the capacity each ASG starts at, and the number of healthy instances each
+// ASG has while waiting on the most recent phase
+func (r *BaseRunner) observe(asgSet *ASGSet) {
+	if r.start == nil {
+		r.start = make(map[string]ASGCapacity)
+	}
+	if r.initialDesired == nil {
+		r.initialDesired = make(map[string]int32)
+		r.inService = make(map[phaseASG]*inServiceRange)
+		r.alreadySuspended = make(map[string][]string)
+	}
+
+	for _, asg := range asgSet.ASGs {
+		name := *asg.ASG.AutoScalingGroupName
+
+		if len(r.actions) == 0 {
+			r.initialDesired[name] = *asg.ASG.DesiredCapacity
+			r.alreadySuspended[name] = suspendedProcessNames(asg.ASG)
+
+			// When resuming, the starting capacity comes from the checkpoint instead
+			if r.checkpoint == nil {
+				r.start[name] = ASGCapacity{
+					Name:            name,
+					DesiredCapacity: *asg.ASG.DesiredCapacity,
+					MinSize:         *asg.ASG.MinSize,
+					MaxSize:         *asg.ASG.MaxSize,
+				}
+			}
+			continue
+		}
+
+		var healthy int32
+		for _, inst := range asg.Instances {
+			if inst.IsHealthy {
+				healthy++
+			}
+		}
+
+		key := phaseASG{phase: r.actions[len(r.actions)-1].Phase, asg: name}
+		if rng, ok := r.inService[key]; ok {
+			rng.peak = max(rng.peak, healthy)
+			rng.min = min(rng.min, healthy)
+		} else {
+			r.inService[key] = &inServiceRange{peak: healthy, min: healthy}
+		}
+	}
+}
+
+// Plan groups the actions taken so far into phases, per ASG
+func (r *BaseRunner) Plan() []PlanPhase {
+	var phases []PlanPhase
+	desired := make(map[string]int32)
+	for name, capacity := range r.initialDesired {
+		desired[name] = capacity
+	}
+
+	for _, action := range r.actions {
+		var cur *PlanPhase
+		for i := range phases {
+			if phases[i].Phase == action.Phase+1 && phases[i].ASG == action.ASG {
+				cur = &phases[i]
+			}
+		}
+
+		if cur == nil {
+			phases = append(phases, PlanPhase{
+				Phase:     action.Phase + 1,
+				ASG:       action.ASG,
+				Terminate: []string{},
+			})
+			cur = &phases[len(phases)-1]
+
+			if rng, ok := r.inService[phaseASG{phase: action.Phase, asg: action.ASG}]; ok {
+				cur.PeakInService = rng.peak
+				cur.MinInService = rng.min
+			}
+		}
+
+		switch action.Kind {
+		case ActionSetDesiredCapacity:
+			desired[action.ASG] = action.DesiredCapacity
+		case ActionTerminateInstance:
+			cur.Terminate = append(cur.Terminate, action.InstanceID)
+			if action.Decrement {
+				cur.Decrement = true
+				desired[action.ASG]--
+			}
+		case ActionAbandonLifecycle:
+			cur.Terminate = append(cur.Terminate, action.InstanceID)
+		case ActionEnterStandby:
+			cur.Standby = append(cur.Standby, action.InstanceID)
+			if action.Decrement {
+				cur.Decrement = true
+				desired[action.ASG]--
+			}
+		case ActionExitStandby:
+			cur.Restore = append(cur.Restore, action.InstanceID)
+			desired[action.ASG]++
+		}
+
+		cur.DesiredCapacity = desired[action.ASG]
+	}
+
+	return phases
+}
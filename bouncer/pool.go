@@ -0,0 +1,257 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// PoolCapacity sums the current and final desired capacities of every ASG in the set, for runners that bounce
+// several ASGs as one pool
+func (a *ASGSet) PoolCapacity() (current int32, final int32) {
+	for _, asg := range a.ASGs {
+		current += *asg.ASG.DesiredCapacity
+		final += asg.DesiredASG.DesiredCapacity
+	}
+	return current, final
+}
+
+// PoolMaxSize sums the max sizes of every ASG in the set
+func (a *ASGSet) PoolMaxSize() int32 {
+	var size int32
+	for _, asg := range a.ASGs {
+		size += *asg.ASG.MaxSize
+	}
+	return size
+}
+
+// PoolMinSize sums the min sizes of every ASG in the set
+func (a *ASGSet) PoolMinSize() int32 {
+	var size int32
+	for _, asg := range a.ASGs {
+		size += *asg.ASG.MinSize
+	}
+	return size
+}
+
+// GetASG returns the ASG in the set with the given name, or nil if there isn't one
+func (a *ASGSet) GetASG(name string) *ASG {
+	for _, asg := range a.ASGs {
+		if *asg.ASG.AutoScalingGroupName == name {
+			return asg
+		}
+	}
+	return nil
+}
+
+// SpreadCapacity works out the desired capacity of each ASG in the set, keyed by name, after adding extra to the
+// pool.  ASGs below their final capacity are topped up first.  The rest is handed out one at a time to the ASG whose
+// surge is smallest relative to its max size, so the surge ends up spread in proportion to max sizes, but ASGs with
+// more old instances than surge are preferred, since surge anywhere else can't be used to replace anything.
+// No ASG's desired capacity is ever lowered
+func (a *ASGSet) SpreadCapacity(extra int32) (map[string]int32, error) {
+	capacities := make(map[string]int32)
+	oldCounts := make(map[string]int32)
+	for _, asg := range a.ASGs {
+		name := *asg.ASG.AutoScalingGroupName
+		capacities[name] = *asg.ASG.DesiredCapacity
+		for _, inst := range asg.Instances {
+			if inst.IsOld && !inst.InStandby() {
+				oldCounts[name]++
+			}
+		}
+	}
+
+	for ; extra > 0; extra-- {
+		var best *ASG
+		bestUseful := false
+		for _, asg := range a.ASGs {
+			name := *asg.ASG.AutoScalingGroupName
+			if capacities[name] >= *asg.ASG.MaxSize {
+				continue
+			}
+			if capacities[name] < asg.DesiredASG.DesiredCapacity {
+				best = asg
+				break
+			}
+
+			useful := capacities[name]-asg.DesiredASG.DesiredCapacity < oldCounts[name]
+			if best == nil || (useful && !bestUseful) ||
+				(useful == bestUseful && surgeBelow(asg, capacities[name], best, capacities[*best.ASG.AutoScalingGroupName])) {
+				best = asg
+				bestUseful = useful
+			}
+		}
+
+		if best == nil {
+			return nil, errors.Errorf("not enough room under the max sizes of the ASGs for %d more instances", extra)
+		}
+		capacities[*best.ASG.AutoScalingGroupName]++
+	}
+
+	return capacities, nil
+}
+
+// surgeBelow returns whether ASG a, at capacity aCap, has less surge for its max size than ASG b at bCap,
+// favoring the bigger ASG on a tie
+func surgeBelow(a *ASG, aCap int32, b *ASG, bCap int32) bool {
+	aSurge := int64(aCap - a.DesiredASG.DesiredCapacity)
+	bSurge := int64(bCap - b.DesiredASG.DesiredCapacity)
+	aMax := int64(*a.ASG.MaxSize)
+	bMax := int64(*b.ASG.MaxSize)
+
+	// aSurge/aMax < bSurge/bMax, without the division
+	if aSurge*bMax != bSurge*aMax {
+		return aSurge*bMax < bSurge*aMax
+	}
+	return aMax > bMax
+}
+
+// SetPoolCapacity sets the desired capacity of each ASG in the set to what's given for it, skipping any already there
+func (r *BaseRunner) SetPoolCapacity(ctx context.Context, asgSet *ASGSet, capacities map[string]int32) error {
+	for _, asg := range asgSet.ASGs {
+		capacity, ok := capacities[*asg.ASG.AutoScalingGroupName]
+		if !ok || capacity == *asg.ASG.DesiredCapacity {
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"ASG":                      *asg.ASG.AutoScalingGroupName,
+			"Current desired capacity": *asg.ASG.DesiredCapacity,
+			"New desired capacity":     capacity,
+		}).Debug("Setting pool member's desired capacity")
+
+		err := r.SetDesiredCapacity(ctx, asg, &capacity)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScaleInPool brings each ASG in the set above the capacity given for it back down by terminating its surplus
+// instances with decrement, picked by AZ balance, rather than lowering desired capacity and leaving AWS to pick,
+// which it won't do among instances protected from scale-in
+func (r *BaseRunner) ScaleInPool(ctx context.Context, asgSet *ASGSet, capacities map[string]int32) error {
+	for _, asg := range asgSet.ASGs {
+		capacity, ok := capacities[*asg.ASG.AutoScalingGroupName]
+		if !ok || capacity >= *asg.ASG.DesiredCapacity {
+			continue
+		}
+
+		var candidates []*Instance
+		for _, inst := range asg.Instances {
+			if !isTerminatingState(inst.ASGInstance.LifecycleState) && !inst.InStandby() {
+				candidates = append(candidates, inst)
+			}
+		}
+
+		surplus := min(int(*asg.ASG.DesiredCapacity-capacity), len(candidates))
+		for _, inst := range asgSet.OrderByAZBalance(candidates)[:surplus] {
+			decrement := true
+			err := r.KillInstance(ctx, inst, &decrement)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ValidatePoolPrereqs checks that every ASG in the set is at its given desired capacity and no lower than its min
+// size, then resolves the batch size for the pool.  The batch is a surge, so a percentage rounds up, and it defaults
+// to replacing the whole pool in one batch
+func (r *BaseRunner) ValidatePoolPrereqs(asgSet *ASGSet) (int32, error) {
+	for _, actualAsg := range asgSet.ASGs {
+		if actualAsg.DesiredASG.DesiredCapacity != r.StartingDesiredCapacity(actualAsg) {
+			log.WithFields(log.Fields{
+				"desired capacity given":  actualAsg.DesiredASG.DesiredCapacity,
+				"desired capacity actual": r.StartingDesiredCapacity(actualAsg),
+			}).Error("Desired capacity given must be equal to starting desired_capacity of ASG")
+			return 0, errors.New("error validating ASG state")
+		}
+
+		if actualAsg.DesiredASG.DesiredCapacity < *actualAsg.ASG.MinSize {
+			log.WithFields(log.Fields{
+				"min size":         *actualAsg.ASG.MinSize,
+				"max size":         *actualAsg.ASG.MaxSize,
+				"desired capacity": actualAsg.DesiredASG.DesiredCapacity,
+			}).Error("Desired capacity given must be greater than or equal to min ASG size")
+			return 0, errors.New("error validating ASG state")
+		}
+	}
+
+	_, finDesiredCapacity := asgSet.PoolCapacity()
+	batchSize := r.ResolveBatchSize(finDesiredCapacity, true)
+	if batchSize == 0 {
+		batchSize = finDesiredCapacity
+	}
+	log.WithFields(log.Fields{
+		"batch size given":    r.BatchSizeGiven(),
+		"desired capacity":    finDesiredCapacity,
+		"resolved batch size": batchSize,
+	}).Info("Resolved batch size")
+
+	// The batch is surged across the whole pool, so it only has to fit under the max sizes between them
+	if asgSet.PoolMaxSize() < (finDesiredCapacity + batchSize) {
+		log.WithFields(log.Fields{
+			"max size":         asgSet.PoolMaxSize(),
+			"desired capacity": finDesiredCapacity,
+			"batch size":       batchSize,
+		}).Error("Max capacity of the ASGs must be >= desired capacity + batch size")
+		return 0, errors.New("error validating ASG state")
+	}
+
+	return batchSize, nil
+}
+
+// PickPoolVictims picks up to count of the given old instances to take out of the pool, split by whether their ASG
+// should be decremented.  Only decrement an ASG while it still has surge of its own, otherwise the pool ends up
+// lopsided.  Old instances in ASGs with surge left go first, since they can be removed rather than replaced
+func (a *ASGSet) PickPoolVictims(old []*Instance, count int32) (withDecrement []*Instance, withoutDecrement []*Instance) {
+	capacities := make(map[string]int32)
+	for _, asg := range a.ASGs {
+		capacities[*asg.ASG.AutoScalingGroupName] = *asg.ASG.DesiredCapacity
+	}
+	picked := make(map[*Instance]bool)
+
+	// Within each pass, take from the AZs with the most healthy capacity first, so no one AZ is drained
+	victims := a.OrderByAZBalance(old)
+
+	for _, needSurge := range []bool{true, false} {
+		for _, oi := range victims {
+			if int32(len(picked)) == count {
+				return withDecrement, withoutDecrement
+			}
+
+			asg := a.GetASG(*oi.AutoscalingGroup.AutoScalingGroupName)
+			decrement := capacities[*asg.ASG.AutoScalingGroupName] > asg.DesiredASG.DesiredCapacity
+			if picked[oi] || (needSurge && !decrement) {
+				continue
+			}
+			picked[oi] = true
+			if decrement {
+				capacities[*asg.ASG.AutoScalingGroupName]--
+				withDecrement = append(withDecrement, oi)
+			} else {
+				withoutDecrement = append(withoutDecrement, oi)
+			}
+		}
+	}
+	return withDecrement, withoutDecrement
+}
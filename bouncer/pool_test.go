@@ -0,0 +1,94 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	et "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPoolASG(name string, desired, final, maxSize int32, oldCount int) *ASG {
+	asg := &ASG{
+		ASG: &at.AutoScalingGroup{
+			AutoScalingGroupName: aws.String(name),
+			DesiredCapacity:      aws.Int32(desired),
+			MaxSize:              aws.Int32(maxSize),
+		},
+		DesiredASG: &DesiredASG{AsgName: name, DesiredCapacity: final},
+	}
+	for i := 0; i < oldCount; i++ {
+		asg.Instances = append(asg.Instances, &Instance{
+			AutoscalingGroup: asg.ASG,
+			EC2Instance:      &et.Instance{LaunchTime: aws.Time(time.Unix(int64(i), 0))},
+			ASGInstance:      &at.Instance{LifecycleState: at.LifecycleStateInService},
+			IsOld:            true,
+		})
+	}
+	return asg
+}
+
+func TestSpreadCapacity(t *testing.T) {
+	asgSet := &ASGSet{ASGs: []*ASG{
+		testPoolASG("a", 2, 2, 4, 2),
+		testPoolASG("b", 2, 2, 4, 2),
+		testPoolASG("c", 2, 2, 8, 2),
+	}}
+
+	// Spread in proportion to max sizes
+	capacities, err := asgSet.SpreadCapacity(4)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int32{"a": 3, "b": 3, "c": 4}, capacities)
+
+	// But not past what's worth surging for the old instances, while there's anywhere else for it
+	capacities, err = asgSet.SpreadCapacity(6)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int32{"a": 4, "b": 4, "c": 4}, capacities)
+
+	_, err = asgSet.SpreadCapacity(11)
+	assert.Error(t, err)
+
+	// ASGs below their final capacity are topped up first
+	asgSet = &ASGSet{ASGs: []*ASG{
+		testPoolASG("a", 2, 2, 4, 2),
+		testPoolASG("b", 1, 2, 4, 2),
+	}}
+	capacities, err = asgSet.SpreadCapacity(1)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int32{"a": 2, "b": 2}, capacities)
+}
+
+func TestPickPoolVictims(t *testing.T) {
+	a := testPoolASG("a", 3, 2, 4, 2)
+	b := testPoolASG("b", 2, 2, 4, 2)
+	asgSet := &ASGSet{ASGs: []*ASG{a, b}}
+	old := append(slices.Clone(a.Instances), b.Instances...)
+
+	// Only a has surge, so one of its old instances goes with decrement, and the rest without
+	withDecrement, withoutDecrement := asgSet.PickPoolVictims(old, 3)
+	assert.Equal(t, []*Instance{a.Instances[0]}, withDecrement)
+	assert.ElementsMatch(t, []*Instance{a.Instances[1], b.Instances[0]}, withoutDecrement)
+
+	// Never more than there are
+	withDecrement, withoutDecrement = asgSet.PickPoolVictims(old, 10)
+	assert.Len(t, withDecrement, 1)
+	assert.Len(t, withoutDecrement, 3)
+}
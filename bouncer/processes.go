@@ -0,0 +1,138 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"context"
+	"slices"
+
+	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultSuspendProcesses are the scaling processes suspended when suspending is asked for without naming any.
+// Each of them can change an ASG's instances or desired capacity out from under bouncer
+var DefaultSuspendProcesses = []string{"AZRebalance", "AlarmNotification", "ScheduledActions"}
+
+// suspendableProcesses are the scaling processes that can be suspended for a run.  Launch and Terminate aren't
+// among them, since bouncer needs the ASG to launch replacements and finish off the instances it terminates
+var suspendableProcesses = []string{
+	"AddToLoadBalancer",
+	"AlarmNotification",
+	"AZRebalance",
+	"HealthCheck",
+	"InstanceRefresh",
+	"ReplaceUnhealthy",
+	"ScheduledActions",
+}
+
+func validateSuspendProcesses(processes []string) error {
+	for _, process := range processes {
+		if !slices.Contains(suspendableProcesses, process) {
+			return errors.Errorf("can't suspend process %q, must be one of %v", process, suspendableProcesses)
+		}
+	}
+	return nil
+}
+
+// suspendedProcessNames returns the names of the processes suspended on the ASG
+func suspendedProcessNames(asg *at.AutoScalingGroup) []string {
+	var names []string
+	for _, process := range asg.SuspendedProcesses {
+		if process.ProcessName != nil {
+			names = append(names, *process.ProcessName)
+		}
+	}
+	return names
+}
+
+// suspendProcesses suspends Opts.SuspendProcesses on every ASG before the first change is made to any of them.
+// Which are suspended already is decided from the live ASGs rather than the checkpoint, since a failed run resumes
+// its processes without updating it.  Processes that were already suspended when bouncer started are left out, so
+// they aren't resumed at the end, and the ones bouncer did suspend are kept with the starting capacity so a resumed
+// run resumes them too
+func (r *BaseRunner) suspendProcesses() error {
+	if len(r.Opts.SuspendProcesses) == 0 {
+		return nil
+	}
+
+	ctx, cancel := r.NewContext()
+	defer cancel()
+
+	for _, desASG := range r.asgs {
+		start := r.start[desASG.AsgName]
+
+		var toSuspend []string
+		for _, process := range r.Opts.SuspendProcesses {
+			if slices.Contains(r.alreadySuspended[desASG.AsgName], process) {
+				continue
+			}
+			toSuspend = append(toSuspend, process)
+		}
+
+		log.WithFields(log.Fields{
+			"ASG":               desASG.AsgName,
+			"Already suspended": r.alreadySuspended[desASG.AsgName],
+			"Suspending":        toSuspend,
+		}).Info("Suspending scaling processes for the run")
+
+		if len(toSuspend) == 0 {
+			continue
+		}
+
+		err := r.awsClients.SuspendProcesses(ctx, desASG.AsgName, toSuspend)
+		if err != nil {
+			return err
+		}
+
+		for _, process := range toSuspend {
+			if !slices.Contains(start.SuspendedProcesses, process) {
+				start.SuspendedProcesses = append(start.SuspendedProcesses, process)
+			}
+		}
+		r.start[desASG.AsgName] = start
+	}
+
+	return nil
+}
+
+// resumeProcesses resumes every process suspendProcesses suspended.  It's called once the run is over, however it
+// ended, so it gets its own context and logs errors rather than returning them
+func (r *BaseRunner) resumeProcesses() {
+	ctx, cancel := context.WithTimeout(context.Background(), r.Opts.ItemTimeout)
+	defer cancel()
+
+	for _, desASG := range r.asgs {
+		start, ok := r.start[desASG.AsgName]
+		if !ok || len(start.SuspendedProcesses) == 0 {
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"ASG":       desASG.AsgName,
+			"Processes": start.SuspendedProcesses,
+		}).Info("Resuming scaling processes suspended for the run")
+
+		err := r.awsClients.ResumeProcesses(ctx, desASG.AsgName, start.SuspendedProcesses)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+
+		start.SuspendedProcesses = nil
+		r.start[desASG.AsgName] = start
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"context"
+
+	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// unprotectInstance removes scale-in protection from an instance about to be terminated
+func (r *BaseRunner) unprotectInstance(ctx context.Context, inst *Instance) error {
+	log.WithFields(log.Fields{
+		"ASG":        *inst.AutoscalingGroup.AutoScalingGroupName,
+		"InstanceID": *inst.ASGInstance.InstanceId,
+	}).Info("Removing scale-in protection")
+	err := r.recordAction(Action{
+		Kind:       ActionRemoveScaleInProtection,
+		ASG:        *inst.AutoscalingGroup.AutoScalingGroupName,
+		InstanceID: *inst.ASGInstance.InstanceId,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = r.awsClients.SetInstanceProtection(ctx, *inst.AutoscalingGroup.AutoScalingGroupName, []string{*inst.ASGInstance.InstanceId}, false)
+	if err != nil {
+		return err
+	}
+	inst.IsProtected = false
+	return nil
+}
+
+// protectNewInstances protects every InService new instance that isn't already from scale-in, so AWS never picks
+// one while bouncer is changing desired capacity.  It isn't recorded as an action, since it doesn't change what
+// the ASG is doing, only what AWS may do to it, but the instances are kept in the checkpoint so a resumed run still
+// unprotects them
+func (r *BaseRunner) protectNewInstances(ctx context.Context, asgSet *ASGSet) error {
+	if !r.Opts.ProtectNew {
+		return nil
+	}
+	if r.protected == nil {
+		r.protected = make(map[string]string)
+	}
+
+	for _, asg := range asgSet.ASGs {
+		var toProtect []*Instance
+		for _, inst := range asg.Instances {
+			if !inst.IsOld && !inst.IsProtected && inst.ASGInstance.LifecycleState == at.LifecycleStateInService {
+				toProtect = append(toProtect, inst)
+			}
+		}
+		if len(toProtect) == 0 {
+			continue
+		}
+
+		var ids []string
+		for _, inst := range toProtect {
+			ids = append(ids, *inst.ASGInstance.InstanceId)
+		}
+
+		log.WithFields(log.Fields{
+			"ASG":         *asg.ASG.AutoScalingGroupName,
+			"InstanceIDs": ids,
+		}).Info("Protecting new instances from scale-in")
+		err := r.awsClients.SetInstanceProtection(ctx, *asg.ASG.AutoScalingGroupName, ids, true)
+		if err != nil {
+			return err
+		}
+
+		for _, inst := range toProtect {
+			inst.IsProtected = true
+			r.protected[*inst.ASGInstance.InstanceId] = *asg.ASG.AutoScalingGroupName
+		}
+
+		// Before the first action, the checkpoint written for it picks these up
+		if len(r.actions) > 0 {
+			err = r.saveCheckpoint()
+			if err != nil {
+				return errors.Wrap(err, "error writing checkpoint")
+			}
+		}
+	}
+
+	return nil
+}
+
+// unprotectNewInstances removes the scale-in protection protectNewInstances added, from every instance still in
+// its ASG.  It's called once the run is over, however it ended, so it gets its own context and logs errors rather
+// than returning them
+func (r *BaseRunner) unprotectNewInstances() {
+	if len(r.protected) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.Opts.ItemTimeout)
+	defer cancel()
+
+	for _, desASG := range r.asgs {
+		asg, err := r.awsClients.GetASG(ctx, desASG.AsgName)
+		if err != nil {
+			log.Error(errors.Wrap(err, "error getting ASG to remove scale-in protection"))
+			continue
+		}
+
+		var ids []string
+		for _, inst := range asg.Instances {
+			if r.protected[*inst.InstanceId] == desASG.AsgName && !isTerminatingState(inst.LifecycleState) {
+				ids = append(ids, *inst.InstanceId)
+			}
+		}
+		if len(ids) == 0 {
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"ASG":         desASG.AsgName,
+			"InstanceIDs": ids,
+		}).Info("Removing scale-in protection added for the run")
+		err = r.awsClients.SetInstanceProtection(ctx, desASG.AsgName, ids, false)
+		if err != nil {
+			log.Error(err)
+		}
+	}
+
+	r.protected = nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	bouncerAWS "github.com/palantir/bouncer/aws"
+	log "github.com/sirupsen/logrus"
+)
+
+// refreshProgress is the last status and percentage complete seen for an instance refresh
+type refreshProgress struct {
+	status  at.InstanceRefreshStatus
+	percent int32
+}
+
+// StartInstanceRefresh starts an instance refresh of the ASG and returns its ID.  It replaces every instance if Force is set,
+// and otherwise only those not already on the ASG's launch template or configuration
+func (r *BaseRunner) StartInstanceRefresh(ctx context.Context, asg *ASG) (string, error) {
+	prefs := at.RefreshPreferences{
+		SkipMatching:          aws.Bool(!r.Opts.Force),
+		MinHealthyPercentage:  r.Opts.MinHealthyPercentage,
+		InstanceWarmup:        r.Opts.InstanceWarmup,
+		CheckpointPercentages: r.Opts.CheckpointPercentages,
+		CheckpointDelay:       r.Opts.CheckpointDelay,
+	}
+
+	log.WithFields(log.Fields{
+		"ASG":                   *asg.ASG.AutoScalingGroupName,
+		"SkipMatching":          *prefs.SkipMatching,
+		"MinHealthyPercentage":  aws.ToInt32(prefs.MinHealthyPercentage),
+		"CheckpointPercentages": prefs.CheckpointPercentages,
+	}).Info("Starting instance refresh")
+	err := r.recordAction(Action{
+		Kind: ActionStartInstanceRefresh,
+		ASG:  *asg.ASG.AutoScalingGroupName,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	refreshID, err := r.awsClients.StartInstanceRefresh(ctx, asg.ASG.AutoScalingGroupName, &prefs)
+	if err != nil {
+		return "", err
+	}
+
+	r.emit(Event{
+		Type:      EventInstanceRefreshStarted,
+		Phase:     r.phase + 1,
+		ASG:       *asg.ASG.AutoScalingGroupName,
+		RefreshID: *refreshID,
+	})
+	return *refreshID, nil
+}
+
+// GetInstanceRefresh returns the current state of an instance refresh, logging its status and percentage complete whenever they change
+func (r *BaseRunner) GetInstanceRefresh(ctx context.Context, asgName string, refreshID string) (*at.InstanceRefresh, error) {
+	refresh, err := r.awsClients.GetInstanceRefresh(ctx, &asgName, &refreshID)
+	if err != nil {
+		return nil, err
+	}
+
+	progress := refreshProgress{
+		status:  refresh.Status,
+		percent: aws.ToInt32(refresh.PercentageComplete),
+	}
+	r.metrics.refreshPercent.WithLabelValues(asgName).Set(float64(progress.percent))
+
+	if r.refreshes == nil {
+		r.refreshes = make(map[string]refreshProgress)
+	}
+	if last, ok := r.refreshes[refreshID]; ok && last == progress {
+		return refresh, nil
+	}
+	r.refreshes[refreshID] = progress
+
+	log.WithFields(log.Fields{
+		"ASG":                asgName,
+		"RefreshID":          refreshID,
+		"Status":             refresh.Status,
+		"PercentageComplete": progress.percent,
+		"InstancesToUpdate":  aws.ToInt32(refresh.InstancesToUpdate),
+		"StatusReason":       aws.ToString(refresh.StatusReason),
+	}).Info("Instance refresh progress")
+	r.emit(Event{
+		Type:            EventInstanceRefreshProgress,
+		Phase:           r.phase,
+		ASG:             asgName,
+		RefreshID:       refreshID,
+		Status:          string(refresh.Status),
+		PercentComplete: &progress.percent,
+	})
+
+	return refresh, nil
+}
+
+// ActiveInstanceRefresh returns the ASG's instance refresh that's still going, or nil if there isn't one
+func (r *BaseRunner) ActiveInstanceRefresh(ctx context.Context, asgName string) (*at.InstanceRefresh, error) {
+	refreshes, err := r.awsClients.GetInstanceRefreshes(ctx, &asgName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, refresh := range refreshes {
+		if bouncerAWS.IsInstanceRefreshActive(refresh.Status) {
+			return &refresh, nil
+		}
+	}
+	return nil, nil
+}
+
+// StopInstanceRefresh cancels the ASG's active instance refresh, or rolls it back if Rollback is set
+func (r *BaseRunner) StopInstanceRefresh(ctx context.Context, asgName string) error {
+	msg := "Cancelling instance refresh"
+	if r.Opts.Rollback {
+		msg = "Rolling back instance refresh"
+	}
+	log.WithFields(log.Fields{
+		"ASG": asgName,
+	}).Warn(msg)
+
+	err := r.recordAction(Action{
+		Kind:     ActionStopInstanceRefresh,
+		ASG:      asgName,
+		Rollback: r.Opts.Rollback,
+	})
+	if err != nil {
+		return err
+	}
+
+	if r.Opts.Rollback {
+		return r.awsClients.RollbackInstanceRefresh(ctx, &asgName)
+	}
+	return r.awsClients.CancelInstanceRefresh(ctx, &asgName)
+}
@@ -0,0 +1,245 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"context"
+	"slices"
+	"sort"
+
+	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// RollbackExitCode is what bouncer exits with after rolling back, so callers can tell it apart from other failures
+const RollbackExitCode = 3
+
+// RollbackError is returned by a run that rolled its new instances back
+type RollbackError struct {
+	// Reason is why the run was rolled back
+	Reason error
+}
+
+func (e *RollbackError) Error() string {
+	return "rolled back new instances: " + e.Reason.Error()
+}
+
+// Unwrap returns the reason for the rollback
+func (e *RollbackError) Unwrap() error {
+	return e.Reason
+}
+
+// IsRollback returns whether err comes from a run that was rolled back
+func IsRollback(err error) bool {
+	var rbErr *RollbackError
+	return errors.As(err, &rbErr)
+}
+
+// trackFailedReplacements counts new instances that have gone away without bouncer killing them, which is
+// what happens to instances that never become healthy, and sets the rollback reason once there are too many
+func (r *BaseRunner) trackFailedReplacements(asgSet *ASGSet) {
+	if r.seenNew == nil {
+		r.seenNew = make(map[string]bool)
+	}
+
+	current := make(map[string]bool)
+	for _, inst := range asgSet.GetNewInstances() {
+		id := *inst.ASGInstance.InstanceId
+		if isTerminatingState(inst.ASGInstance.LifecycleState) {
+			continue
+		}
+		current[id] = true
+		r.seenNew[id] = true
+	}
+
+	for id, counted := range r.seenNew {
+		if counted && !current[id] && !r.killed[id] {
+			log.WithFields(log.Fields{
+				"InstanceID": id,
+			}).Warn("New instance went away without bouncer terminating it")
+			r.failedReplacements++
+			// Only count each instance once
+			r.seenNew[id] = false
+		}
+	}
+
+	if r.Opts.MaxFailedReplacements > 0 && r.failedReplacements >= r.Opts.MaxFailedReplacements && r.rollbackReason == nil {
+		r.rollbackReason = errors.Errorf("%d new instances failed", r.failedReplacements)
+	}
+}
+
+func (r *BaseRunner) markKilled(inst *Instance) {
+	if r.killed == nil {
+		r.killed = make(map[string]bool)
+	}
+	r.killed[*inst.ASGInstance.InstanceId] = true
+}
+
+// WaitOrRollBack is Wait for runners that support auto-rollback.  If AutoRollback is set, and either the timeout is hit
+// or too many new instances have failed, the new instances are rolled back and a *RollbackError returned
+func (r *BaseRunner) WaitOrRollBack(ctx context.Context) error {
+	if r.Opts.AutoRollback && r.rollbackReason != nil {
+		return r.rollBack(r.rollbackReason)
+	}
+
+	err := r.Wait(ctx)
+	if err != nil && r.Opts.AutoRollback {
+		return r.rollBack(err)
+	}
+	return err
+}
+
+// rollBack terminates, with decrement, every new instance that isn't healthy, and then healthy new ones until each
+// ASG is back at the desired capacity it started at.  Old instances are never touched
+func (r *BaseRunner) rollBack(reason error) error {
+	log.WithFields(log.Fields{
+		"Reason": reason,
+	}).Error("Rolling back new instances")
+
+	ctx, cancel := r.NewContext()
+	defer cancel()
+
+	err := r.restoreStartingCapacity(ctx, true)
+	if err != nil {
+		return errors.Wrapf(err, "error rolling back after: %s", reason)
+	}
+
+	return &RollbackError{Reason: reason}
+}
+
+// restoreStartingCapacity terminates new instances with decrement, unhealthy ones first and then the newest, until
+// each ASG is back at the desired capacity it started at.  If killUnhealthy is set, every unhealthy new instance
+// goes, even once the ASG is back at that capacity.  Old instances bouncer moved to Standby are brought back into
+// service first, and otherwise old instances are never touched.  ASGs with no starting capacity recorded yet are left
+// alone
+func (r *BaseRunner) restoreStartingCapacity(ctx context.Context, killUnhealthy bool) error {
+	asgSet, err := newASGSet(ctx, r.awsClients, r.asgs, r.Opts.Force, r.Opts.LBHealth, r.killed, r.startTime)
+	if err != nil {
+		return errors.Wrap(err, "error building ASGSet")
+	}
+
+	for _, asg := range asgSet.ASGs {
+		name := *asg.ASG.AutoScalingGroupName
+		start, ok := r.start[name]
+		if !ok {
+			// The run was stopped before bouncer ever looked at this ASG, so it hasn't changed anything
+			log.WithFields(log.Fields{
+				"ASG": name,
+			}).Info("No starting capacity recorded, so nothing to restore")
+			continue
+		}
+		original := start.DesiredCapacity
+		desired := *asg.ASG.DesiredCapacity
+
+		var victims, standby []*Instance
+		for _, inst := range asg.Instances {
+			if inst.InStandby() {
+				if !slices.Contains(start.Standby, *inst.ASGInstance.InstanceId) {
+					continue
+				}
+				if inst.ASGInstance.LifecycleState != at.LifecycleStateStandby {
+					log.WithFields(log.Fields{
+						"ASG":        name,
+						"InstanceID": *inst.ASGInstance.InstanceId,
+					}).Warn("Instance is still entering standby, so it can't be brought back yet")
+					continue
+				}
+				standby = append(standby, inst)
+				continue
+			}
+			if inst.IsOld || isTerminatingState(inst.ASGInstance.LifecycleState) {
+				continue
+			}
+			if passed, ran := r.validated[*inst.ASGInstance.InstanceId]; ran && !passed {
+				inst.IsHealthy = false
+			}
+			victims = append(victims, inst)
+		}
+
+		// Unhealthy instances first, then the newest
+		sort.SliceStable(victims, func(i, j int) bool {
+			if victims[i].IsHealthy != victims[j].IsHealthy {
+				return !victims[i].IsHealthy
+			}
+			return victims[i].EC2Instance.LaunchTime.After(*victims[j].EC2Instance.LaunchTime)
+		})
+
+		// Coming out of Standby raises desired capacity, so new instances are terminated to make room under the max
+		// size whenever there isn't any
+		for len(standby) > 0 {
+			if room := int(*asg.ASG.MaxSize - desired); room > 0 {
+				n := min(room, len(standby))
+				err = r.exitStandby(ctx, name, standby[:n])
+				if err != nil {
+					return err
+				}
+				desired += int32(n)
+				standby = standby[n:]
+				continue
+			}
+
+			if len(victims) == 0 || desired <= *asg.ASG.MinSize {
+				return errors.Errorf("no room under the max size of ASG %s to bring %d instances out of standby", name, len(standby))
+			}
+			decrement := true
+			err = r.terminateInstanceInASG(ctx, victims[0], &decrement)
+			if err != nil {
+				return err
+			}
+			victims = victims[1:]
+			desired--
+		}
+
+		for _, inst := range victims {
+			if desired <= original && (inst.IsHealthy || !killUnhealthy) {
+				break
+			}
+
+			decrement := desired > *asg.ASG.MinSize
+			if !decrement {
+				log.WithFields(log.Fields{
+					"ASG":        name,
+					"InstanceID": *inst.ASGInstance.InstanceId,
+				}).Warn("ASG is at its min size, so the instance will be replaced rather than removed")
+			}
+
+			err = r.terminateInstanceInASG(ctx, inst, &decrement)
+			if err != nil {
+				return err
+			}
+			if decrement {
+				desired--
+			}
+		}
+
+		if desired != original {
+			err = r.SetDesiredCapacity(ctx, asg, &original)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func isTerminatingState(state at.LifecycleState) bool {
+	switch state {
+	case at.LifecycleStateTerminating, at.LifecycleStateTerminatingWait, at.LifecycleStateTerminatingProceed, at.LifecycleStateTerminated:
+		return true
+	}
+	return false
+}
@@ -16,6 +16,8 @@ package bouncer
 
 import (
 	"context"
+	"encoding/json"
+	"io"
 	"os"
 	"strings"
 	"time"
@@ -28,24 +30,116 @@ import (
 
 // RunnerOpts is user-supplied options to any flavor of runner
 type RunnerOpts struct {
-	Noop            bool
-	Force           bool
-	Fast            bool
-	BatchSize       *int32
-	AsgString       string
-	CommandString   string
+	Noop          bool
+	Force         bool
+	Fast          bool
+	BatchSize     *int32
+	AsgString     string
+	CommandString string
+	// BatchPercent, if set, is the batch size as a percentage of desired capacity, and BatchSize is ignored
+	BatchPercent *int32
+	// ASGs, if set, is used in place of parsing AsgString and CommandString
+	ASGs []*DesiredASG
+	// ASGTags and ASGGlobs select more ASGs to bounce, by key=value tags that must all match and name globs of which one must match
+	ASGTags         []string
+	ASGGlobs        []string
 	DefaultCapacity *int32
 	TerminateHook   string
 	PendingHook     string
 	ItemTimeout     time.Duration
+	// Clients, if set, is used in place of the clients built from ClientOpts
+	Clients    *aws.Clients
+	ClientOpts aws.ClientOpts
+	// CheckInterval, if set, overrides the time slept between checks of the ASGs
+	CheckInterval time.Duration
+	// CheckpointFile, if set, is where bouncer records its progress so an interrupted run can be resumed
+	CheckpointFile string
+	// Resume continues the run recorded in CheckpointFile
+	Resume bool
+	// EventsFile, if set, is where progress events are written as newline-delimited JSON
+	EventsFile string
+	// SummaryFile, if set, is where the end-of-run summary is written
+	SummaryFile string
+	// MetricsAddr, if set, is the address Prometheus metrics are served on for the duration of the run
+	MetricsAddr string
+	// LBHealth gates instance health on the ASG's target groups and classic ELBs, and waits for targets to finish draining
+	LBHealth bool
+	// MinHealthyPercentage, InstanceWarmup, CheckpointPercentages and CheckpointDelay are passed to StartInstanceRefresh
+	// by the instance-refresh runner, which leaves any that are unset to the ASG's defaults
+	MinHealthyPercentage  *int32
+	InstanceWarmup        *int32
+	CheckpointPercentages []int32
+	CheckpointDelay       *int32
+	// Rollback has the instance-refresh runner roll back a refresh that times out or is aborted, rather than cancel it
+	Rollback bool
+	// ValidateCommand, if set, is run against each new instance once it's healthy, with the instance ID, private IP and
+	// ASG name appended, and the instance only counts as healthy once it exits 0
+	ValidateCommand string
+	// AutoRollback has the canary runners roll back their new instances if the timeout is hit, a new instance fails
+	// validation, or MaxFailedReplacements new instances go away without bouncer terminating them
+	AutoRollback          bool
+	MaxFailedReplacements int
+	// Interrupt, if set, is closed to have the runner stop terminating instances and return ErrInterrupted once the
+	// changes already in flight have finished, or, with RestoreOnInterrupt, once the starting capacity is restored
+	Interrupt          <-chan struct{}
+	RestoreOnInterrupt bool
+	// Webhooks are POSTed to before each termination, as each new instance becomes healthy, and when the run finishes
+	Webhooks WebhookOpts
+	// SuspendProcesses are scaling processes to suspend on every ASG before the first change, and resume once the
+	// run is over.  Any of them already suspended when bouncer starts are left alone
+	SuspendProcesses []string
+	// UnprotectOld removes scale-in protection from each old instance right before it's terminated
+	UnprotectOld bool
+	// ProtectNew protects each new instance from scale-in once it's InService, until the run is over
+	ProtectNew bool
+	// BakeTime is how long the standby runner keeps the old instances in Standby once every new instance is healthy
+	BakeTime time.Duration
+	// RefreshWarmPool replaces the old instances in each ASG's warm pool once the rollout is done
+	RefreshWarmPool bool
 }
 
 // BaseRunner is the base struct for any runner
 type BaseRunner struct {
 	Opts       *RunnerOpts
+	ctx        context.Context
+	mode       string
 	startTime  time.Time
 	awsClients *aws.Clients
 	asgs       []*DesiredASG
+
+	actions        []Action
+	phase          int
+	actedThisPhase bool
+	checks         int
+	start          map[string]ASGCapacity
+	initialDesired map[string]int32
+	inService      map[phaseASG]*inServiceRange
+	checkpoint     *Checkpoint
+
+	events     *json.Encoder
+	eventsFile io.WriteCloser
+	waiting    bool
+	phases     []PhaseDuration
+	replaced   []ReplacedInstance
+	finished   bool
+	refreshes  map[string]refreshProgress
+	// validated maps each new instance the validation command has run against to whether it passed
+	validated    map[string]bool
+	validateArgv []string
+	// notifiedHealthy is each new instance the post-new-healthy webhook has been called for
+	notifiedHealthy map[string]bool
+	// alreadySuspended is the scaling processes each ASG had suspended before bouncer changed anything
+	alreadySuspended map[string][]string
+	// protected maps each new instance bouncer protected from scale-in to its ASG
+	protected map[string]string
+
+	// seenNew, killed and failedReplacements track new instances dying on their own, to know when to roll back
+	seenNew            map[string]bool
+	killed             map[string]bool
+	failedReplacements int
+	rollbackReason     error
+
+	metrics *metrics
 }
 
 const (
@@ -56,29 +150,113 @@ const (
 	debugTimeFormat = "2006-01-02 15:04:05 MST"
 )
 
-// NewBaseRunner instantiates a BaseRunner
-func NewBaseRunner(ctx context.Context, opts *RunnerOpts) (*BaseRunner, error) {
-	awsClients, err := aws.GetAWSClients(ctx)
+// NewBaseRunner instantiates a BaseRunner for the named mode
+func NewBaseRunner(ctx context.Context, mode string, opts *RunnerOpts) (*BaseRunner, error) {
+	asgs, err := getASGList(opts)
 	if err != nil {
-		return nil, errors.Wrap(err, "Error getting AWS Creds")
+		return nil, errors.Wrap(err, "error parsing ASG list")
 	}
 
-	asgs, err := getASGList(opts)
+	awsClients := opts.Clients
+	if awsClients == nil {
+		awsClients, err = aws.GetAWSClients(ctx, opts.ClientOpts)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error getting AWS Creds")
+		}
+	}
+
+	if len(opts.ASGTags) > 0 || len(opts.ASGGlobs) > 0 {
+		asgs, err = selectASGs(ctx, awsClients, opts, asgs)
+		if err != nil {
+			return nil, errors.Wrap(err, "error selecting ASGs")
+		}
+	}
+
+	if len(asgs) == 0 {
+		return nil, errors.New("no ASGs given to bounce")
+	}
+
+	for _, desASG := range asgs {
+		_, err = parseCommandTemplates(desASG.PreTerminateCmd)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing external command for %s", desASG.AsgName)
+		}
+	}
+
+	err = validateSuspendProcesses(opts.SuspendProcesses)
 	if err != nil {
-		return nil, errors.Wrap(err, "error parsing ASG list")
+		return nil, err
+	}
+
+	validateArgv, err := splitCommandString(opts.ValidateCommand)
+	if err == nil {
+		_, err = parseCommandTemplates(validateArgv)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing validation command")
+	}
+
+	if opts.Noop {
+		// From here on, every call goes to a projection of the ASGs rather than AWS itself
+		awsClients, err = newNoopClients(ctx, awsClients, asgs)
+		if err != nil {
+			return nil, errors.Wrap(err, "error projecting ASG state for noop")
+		}
 	}
 
 	r := BaseRunner{
-		Opts:       opts,
-		startTime:  time.Now(),
-		awsClients: awsClients,
-		asgs:       asgs,
+		Opts:         opts,
+		ctx:          ctx,
+		mode:         mode,
+		startTime:    time.Now(),
+		awsClients:   awsClients,
+		asgs:         asgs,
+		validateArgv: validateArgv,
+		metrics:      newMetrics(),
+	}
+
+	if opts.Resume {
+		err = r.loadCheckpoint()
+		if err != nil {
+			return nil, errors.Wrap(err, "error loading checkpoint")
+		}
+	} else if opts.CheckpointFile != "" && !opts.Noop {
+		if _, err := os.Stat(opts.CheckpointFile); err == nil {
+			log.WithFields(log.Fields{
+				"CheckpointFile": opts.CheckpointFile,
+			}).Warn("Found checkpoint from a previous run, it will be overwritten since we're not resuming")
+		}
 	}
 
+	if opts.EventsFile != "" {
+		r.eventsFile, err = openOutput(opts.EventsFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "error opening events file")
+		}
+		r.events = json.NewEncoder(r.eventsFile)
+	}
+	if opts.MetricsAddr != "" {
+		err = r.metrics.serve(opts.MetricsAddr)
+		if err != nil {
+			return nil, errors.Wrap(err, "error serving metrics")
+		}
+	}
+
+	r.emit(Event{Type: EventRunStarted, Mode: mode, Noop: opts.Noop, Phase: r.phase})
+
 	return &r, nil
 }
 
 func getASGList(opts *RunnerOpts) ([]*DesiredASG, error) {
+	if len(opts.ASGs) > 0 {
+		return opts.ASGs, nil
+	}
+
+	// Only selecting ASGs by tag or name
+	if opts.AsgString == "" {
+		return nil, nil
+	}
+
 	var asgs []*DesiredASG
 	var cmdStringItems []string
 
@@ -92,12 +270,14 @@ func getASGList(opts *RunnerOpts) ([]*DesiredASG, error) {
 	}
 
 	for i, asgItem := range asgStringItems {
-		var command *string
+		var command []string
 
 		if len(cmdStringItems) > 0 {
-			command = &cmdStringItems[i]
-		} else {
-			command = nil
+			var err error
+			command, err = splitCommandString(cmdStringItems[i])
+			if err != nil {
+				return nil, errors.Wrap(err, "error parsing external command")
+			}
 		}
 
 		curAsg, err := ExtractDesiredASG(asgItem, opts.DefaultCapacity, command)
@@ -110,13 +290,6 @@ func getASGList(opts *RunnerOpts) ([]*DesiredASG, error) {
 	return asgs, nil
 }
 
-func (r *BaseRunner) noopCheck() {
-	if r.Opts.Noop {
-		log.Warn("NOOP only - not actually performing previous action, and exiting script with success")
-		os.Exit(0)
-	}
-}
-
 func (r *BaseRunner) abandonLifecycle(ctx context.Context, inst *Instance, hook *string) error {
 	log.WithFields(log.Fields{
 		"InstanceID":     *inst.ASGInstance.InstanceId,
@@ -124,18 +297,54 @@ func (r *BaseRunner) abandonLifecycle(ctx context.Context, inst *Instance, hook
 		"LifecycleState": inst.ASGInstance.LifecycleState,
 	}).Warn("Issuing ABANDON to hook instead of terminating")
 	result := "ABANDON"
-	r.noopCheck()
-	err := r.awsClients.CompleteLifecycleAction(ctx, inst.AutoscalingGroup.AutoScalingGroupName, inst.ASGInstance.InstanceId, hook, &result)
-	return errors.Wrap(err, "error completing lifecycle action")
+	err := r.recordAction(Action{
+		Kind:       ActionAbandonLifecycle,
+		ASG:        *inst.AutoscalingGroup.AutoScalingGroupName,
+		InstanceID: *inst.ASGInstance.InstanceId,
+		Hook:       *hook,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = r.awsClients.CompleteLifecycleAction(ctx, inst.AutoscalingGroup.AutoScalingGroupName, inst.ASGInstance.InstanceId, hook, &result)
+	if err != nil {
+		return errors.Wrap(err, "error completing lifecycle action")
+	}
+	r.markKilled(inst)
+
+	r.emit(Event{
+		Type:       EventInstanceTerminated,
+		Phase:      r.phase + 1,
+		ASG:        *inst.AutoscalingGroup.AutoScalingGroupName,
+		InstanceID: *inst.ASGInstance.InstanceId,
+		Hook:       *hook,
+	})
+	r.metrics.abandons.WithLabelValues(*inst.AutoscalingGroup.AutoScalingGroupName).Inc()
+	if inst.IsOld {
+		r.recordReplaced(ctx, inst)
+	}
+	return nil
 }
 
 // KillInstance calls TerminateInstanceInAutoscalingGroup, or, if the instance is stuck
-// in a lifecycle hook, issues an ABANDON to it, killing it more forcefully
+// in a lifecycle hook, issues an ABANDON to it, killing it more forcefully.  Once the run's been interrupted, it
+// stops instead, so the rest of a batch isn't terminated
 func (r *BaseRunner) KillInstance(ctx context.Context, inst *Instance, decrement *bool) error {
+	if r.Interrupted() {
+		return r.stopForInterrupt()
+	}
+
 	log.WithFields(log.Fields{
 		"ASG":        *inst.AutoscalingGroup.AutoScalingGroupName,
 		"InstanceID": *inst.ASGInstance.InstanceId,
 	}).Info("Picked instance to die next")
+	r.emit(Event{
+		Type:       EventInstanceSelected,
+		Phase:      r.phase + 1,
+		ASG:        *inst.AutoscalingGroup.AutoScalingGroupName,
+		InstanceID: *inst.ASGInstance.InstanceId,
+	})
 	var hook string
 
 	if inst.ASGInstance.LifecycleState == at.LifecycleStatePendingWait {
@@ -151,12 +360,64 @@ func (r *BaseRunner) KillInstance(ctx context.Context, inst *Instance, decrement
 		return errors.Wrapf(err, "error abandoning hook %s", hook)
 	}
 
-	if inst.PreTerminateCmd != nil {
-		err := r.executeExternalCommand(ctx, *inst.PreTerminateCmd)
+	if len(inst.PreTerminateCmd) > 0 {
+		err := r.recordAction(Action{
+			Kind:       ActionPreTerminateCommand,
+			ASG:        *inst.AutoscalingGroup.AutoScalingGroupName,
+			InstanceID: *inst.ASGInstance.InstanceId,
+			Command:    strings.Join(inst.PreTerminateCmd, " "),
+		})
+		if err != nil {
+			return err
+		}
+
+		cmdStart := time.Now()
+		err = r.executeExternalCommand(ctx, "pre-terminate", inst.PreTerminateCmd, inst)
+
+		event := Event{
+			Type:            EventCommandExecuted,
+			Phase:           r.phase + 1,
+			ASG:             *inst.AutoscalingGroup.AutoScalingGroupName,
+			InstanceID:      *inst.ASGInstance.InstanceId,
+			Command:         strings.Join(inst.PreTerminateCmd, " "),
+			DurationSeconds: time.Since(cmdStart).Seconds(),
+		}
+		r.metrics.commandSeconds.WithLabelValues(event.ASG).Add(event.DurationSeconds)
+		if err != nil {
+			event.Error = err.Error()
+			r.metrics.commandFailures.WithLabelValues(event.ASG).Inc()
+		}
+		r.emit(event)
+
 		if err != nil {
 			return errors.Wrap(err, "error executing pre-terminate command")
 		}
 	}
+	if r.Opts.Webhooks.PreTerminate != "" {
+		err := r.recordAction(Action{
+			Kind:       ActionPreTerminateWebhook,
+			ASG:        *inst.AutoscalingGroup.AutoScalingGroupName,
+			InstanceID: *inst.ASGInstance.InstanceId,
+			URL:        r.Opts.Webhooks.PreTerminate,
+		})
+		if err != nil {
+			return err
+		}
+
+		cmdCtx := newCommandContext(inst)
+		err = r.callWebhook(ctx, WebhookPreTerminate, WebhookPayload{Instance: &cmdCtx})
+		if err != nil {
+			return err
+		}
+	}
+
+	if r.Opts.UnprotectOld && inst.IsOld && inst.IsProtected {
+		err := r.unprotectInstance(ctx, inst)
+		if err != nil {
+			return err
+		}
+	}
+
 	err := r.terminateInstanceInASG(ctx, inst, decrement)
 	return errors.Wrap(err, "error terminating instance")
 }
@@ -166,11 +427,34 @@ func (r *BaseRunner) terminateInstanceInASG(ctx context.Context, inst *Instance,
 		"ASG":        *inst.AutoscalingGroup.AutoScalingGroupName,
 		"InstanceID": *inst.ASGInstance.InstanceId,
 	}).Info("Terminating instance")
-	r.noopCheck()
-
-	err := r.awsClients.TerminateInstanceInASG(ctx, inst.ASGInstance.InstanceId, decrement)
+	err := r.recordAction(Action{
+		Kind:       ActionTerminateInstance,
+		ASG:        *inst.AutoscalingGroup.AutoScalingGroupName,
+		InstanceID: *inst.ASGInstance.InstanceId,
+		Decrement:  *decrement,
+	})
+	if err != nil {
+		return err
+	}
 
-	return err
+	err = r.awsClients.TerminateInstanceInASG(ctx, inst.ASGInstance.InstanceId, decrement)
+	if err != nil {
+		return err
+	}
+	r.markKilled(inst)
+
+	r.emit(Event{
+		Type:       EventInstanceTerminated,
+		Phase:      r.phase + 1,
+		ASG:        *inst.AutoscalingGroup.AutoScalingGroupName,
+		InstanceID: *inst.ASGInstance.InstanceId,
+		Decrement:  *decrement,
+	})
+	r.metrics.terminations.WithLabelValues(*inst.AutoscalingGroup.AutoScalingGroupName).Inc()
+	if inst.IsOld {
+		r.recordReplaced(ctx, inst)
+	}
+	return nil
 }
 
 // SetDesiredCapacity Updates desired capacity of ASG
@@ -184,16 +468,37 @@ func (r *BaseRunner) SetDesiredCapacity(ctx context.Context, asg *ASG, desiredCa
 		"CurDesiredCap": *asg.ASG.DesiredCapacity,
 		"NewDesiredCap": *desiredCapacity,
 	}).Info("Changing desired capacity")
-	r.noopCheck()
+	err := r.recordAction(Action{
+		Kind:            ActionSetDesiredCapacity,
+		ASG:             *asg.ASG.AutoScalingGroupName,
+		DesiredCapacity: *desiredCapacity,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = r.awsClients.SetDesiredCapacity(ctx, asg.ASG, desiredCapacity)
+	if err != nil {
+		return errors.Wrapf(err, "error setting desired capacity of ASG")
+	}
 
-	err := r.awsClients.SetDesiredCapacity(ctx, asg.ASG, desiredCapacity)
+	r.emit(Event{
+		Type:            EventCapacitySet,
+		Phase:           r.phase + 1,
+		ASG:             *asg.ASG.AutoScalingGroupName,
+		DesiredCapacity: desiredCapacity,
+	})
+	return nil
+}
 
-	return errors.Wrapf(err, "error setting desired capacity of ASG")
+// DesiredASGs returns the ASGs this runner was asked to bounce, and the state they should be left in
+func (r *BaseRunner) DesiredASGs() []*DesiredASG {
+	return r.asgs
 }
 
-// NewContext generates a context with the ItemTimeout from the parent context given
+// NewContext generates a context with the ItemTimeout from the context the runner was created with
 func (r *BaseRunner) NewContext() (context.Context, context.CancelFunc) {
-	ctx, cancel := context.WithTimeout(context.Background(), r.Opts.ItemTimeout)
+	ctx, cancel := context.WithTimeout(r.ctx, r.Opts.ItemTimeout)
 	dn, _ := ctx.Deadline()
 
 	l := log.WithFields(log.Fields{
@@ -212,22 +517,92 @@ func getHumanCurrentTime() string {
 
 // Sleep makes us sleep for the constant time - call this when waiting for an AWS change
 func (r *BaseRunner) Sleep(ctx context.Context) {
+	err := r.Wait(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Wait is Sleep for runners that need to clean up before giving up, returning an error instead of exiting once ctx is done
+func (r *BaseRunner) Wait(ctx context.Context) error {
+	if r.actedThisPhase {
+		r.phase++
+		r.actedThisPhase = false
+
+		err := r.saveCheckpoint()
+		if err != nil {
+			log.Error(errors.Wrap(err, "error updating checkpoint, continuing without it"))
+		}
+	}
+
+	if !r.waiting {
+		r.waiting = true
+		r.emit(Event{Type: EventWaitingForSettle, Phase: r.phase})
+	}
+
+	if r.Opts.Noop {
+		// The projection settles on every check, so there's no point waiting on the wall clock
+		r.checks++
+		if r.checks > maxNoopChecks {
+			return errors.Errorf("noop projection didn't finish after %d checks, something is probably wrong with the rollout", maxNoopChecks)
+		}
+		if ctx.Err() != nil {
+			return errors.New("timeout exceeded, something is probably wrong with the rollout")
+		}
+		return nil
+	}
+
+	sleep := waitBetweenChecks
+	if r.Opts.CheckInterval != 0 {
+		sleep = r.Opts.CheckInterval
+	}
+
 	l := log.WithFields(log.Fields{
-		"Sleep Duration": waitBetweenChecks,
+		"Sleep Duration": sleep,
 		"Current time":   getHumanCurrentTime(),
 	})
 
 	l.Debug("Sleeping between checks")
 
 	select {
-	case <-time.After(waitBetweenChecks):
-		return
+	case <-time.After(sleep):
+		return nil
+	case <-r.Opts.Interrupt:
+		// The next ASGSet will stop the run
+		return nil
 	case <-ctx.Done():
-		log.Fatal("timeout exceeded, something is probably wrong with the rollout")
+		return errors.New("timeout exceeded, something is probably wrong with the rollout")
 	}
 }
 
 // NewASGSet returns an ASGSet pointer
 func (r *BaseRunner) NewASGSet(ctx context.Context) (*ASGSet, error) {
-	return newASGSet(ctx, r.awsClients, r.asgs, r.Opts.Force, r.startTime)
+	if r.Interrupted() {
+		return nil, r.stopForInterrupt()
+	}
+
+	asgSet, err := newASGSet(ctx, r.awsClients, r.asgs, r.Opts.Force, r.Opts.LBHealth, r.killed, r.startTime)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.validateNewInstances(ctx, asgSet)
+	if err != nil {
+		return nil, err
+	}
+	r.trackFailedReplacements(asgSet)
+
+	err = r.notifyNewHealthy(ctx, asgSet)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.protectNewInstances(ctx, asgSet)
+	if err != nil {
+		return nil, err
+	}
+
+	r.observe(asgSet)
+	r.metrics.observeASGs(asgSet)
+	return asgSet, nil
 }
@@ -0,0 +1,135 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/palantir/bouncer/aws"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const tagSeparator = "="
+
+type asgTag struct {
+	key   string
+	value string
+}
+
+func parseASGTags(tagStrings []string) ([]asgTag, error) {
+	var tags []asgTag
+	for _, tagString := range tagStrings {
+		key, value, found := strings.Cut(tagString, tagSeparator)
+		if !found || key == "" {
+			return nil, errors.Errorf("Error parsing tag '%s'.  Must be in format '%s%s%s'", tagString, "KEY", tagSeparator, "VALUE")
+		}
+		tags = append(tags, asgTag{key: key, value: value})
+	}
+	return tags, nil
+}
+
+// matchesSelectors returns whether the ASG has every tag given, and if any globs are given, whether its name matches one of them
+func matchesSelectors(asg *at.AutoScalingGroup, tags []asgTag, globs []string) bool {
+	for _, tag := range tags {
+		value := aws.GetASGTagValue(asg, tag.key)
+		if value == nil || *value != tag.value {
+			return false
+		}
+	}
+
+	if len(globs) == 0 {
+		return true
+	}
+
+	for _, glob := range globs {
+		// Patterns are validated up front, so there's no error to check here
+		if matched, _ := path.Match(glob, *asg.AutoScalingGroupName); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// selectASGs adds every ASG matching the tag and name-glob selectors to the ASGs given explicitly.
+// Explicitly given ASGs keep the desired capacity they were given, selected ones use their current desired capacity
+func selectASGs(ctx context.Context, ac *aws.Clients, opts *RunnerOpts, asgs []*DesiredASG) ([]*DesiredASG, error) {
+	tags, err := parseASGTags(opts.ASGTags)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, glob := range opts.ASGGlobs {
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, errors.Wrapf(err, "error parsing ASG name glob '%s'", glob)
+		}
+	}
+
+	// With no explicit ASGs to line commands up against, a single command applies to every selected ASG
+	var command []string
+	if opts.AsgString == "" && opts.CommandString != "" {
+		if strings.Contains(opts.CommandString, asgSeparator) {
+			return nil, errors.New("When selecting ASGs by tag or name, only one external command can be given, and it's run for all of them")
+		}
+		var err error
+		command, err = splitCommandString(opts.CommandString)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing external command")
+		}
+	}
+
+	given := make(map[string]bool)
+	for _, desASG := range asgs {
+		given[desASG.AsgName] = true
+	}
+
+	allASGs, err := ac.GetAllASGs(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing ASGs")
+	}
+
+	var selected int
+	for _, asg := range allASGs {
+		if !matchesSelectors(asg, tags, opts.ASGGlobs) {
+			continue
+		}
+
+		selected++
+		if given[*asg.AutoScalingGroupName] {
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"ASG":             *asg.AutoScalingGroupName,
+			"DesiredCapacity": *asg.DesiredCapacity,
+		}).Info("Selected ASG")
+
+		asgs = append(asgs, &DesiredASG{
+			AsgName:         *asg.AutoScalingGroupName,
+			DesiredCapacity: *asg.DesiredCapacity,
+			PreTerminateCmd: command,
+		})
+	}
+
+	if selected == 0 {
+		return nil, errors.Errorf("no ASGs matched tags %v and name globs %v", opts.ASGTags, opts.ASGGlobs)
+	}
+
+	return asgs, nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/palantir/bouncer/simulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectASGs(t *testing.T) {
+	ctx := context.Background()
+	sim := simulator.New()
+	for _, cfg := range []simulator.ASGConfig{
+		{Name: "hashi-stag-server-a", MaxSize: 6, DesiredCapacity: 3, Tags: map[string]string{"cluster": "hashi-stag-server", "env": "stag"}},
+		{Name: "hashi-stag-server-b", MaxSize: 6, DesiredCapacity: 2, Tags: map[string]string{"cluster": "hashi-stag-server", "env": "stag"}},
+		{Name: "hashi-stag-worker", MaxSize: 6, DesiredCapacity: 4, Tags: map[string]string{"cluster": "hashi-stag-worker", "env": "stag"}},
+	} {
+		require.NoError(t, sim.AddASG(cfg))
+	}
+
+	names := func(asgs []*DesiredASG) map[string]int32 {
+		m := make(map[string]int32)
+		for _, asg := range asgs {
+			m[asg.AsgName] = asg.DesiredCapacity
+		}
+		return m
+	}
+
+	asgs, err := selectASGs(ctx, sim.Clients(), &RunnerOpts{ASGTags: []string{"cluster=hashi-stag-server"}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int32{"hashi-stag-server-a": 3, "hashi-stag-server-b": 2}, names(asgs))
+
+	asgs, err = selectASGs(ctx, sim.Clients(), &RunnerOpts{ASGTags: []string{"env=stag"}, ASGGlobs: []string{"*-worker", "*-b"}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int32{"hashi-stag-server-b": 2, "hashi-stag-worker": 4}, names(asgs))
+
+	// Explicitly given ASGs keep the capacity they were given
+	given := []*DesiredASG{{AsgName: "hashi-stag-server-a", DesiredCapacity: 5}}
+	asgs, err = selectASGs(ctx, sim.Clients(), &RunnerOpts{AsgString: "hashi-stag-server-a:5", ASGGlobs: []string{"hashi-stag-server-*"}}, given)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int32{"hashi-stag-server-a": 5, "hashi-stag-server-b": 2}, names(asgs))
+
+	// A single command applies to every selected ASG
+	asgs, err = selectASGs(ctx, sim.Clients(), &RunnerOpts{CommandString: "consul leave", ASGGlobs: []string{"hashi-stag-server-*"}}, nil)
+	require.NoError(t, err)
+	for _, asg := range asgs {
+		assert.Equal(t, []string{"consul", "leave"}, asg.PreTerminateCmd)
+	}
+
+	_, err = selectASGs(ctx, sim.Clients(), &RunnerOpts{ASGTags: []string{"cluster=nope"}}, nil)
+	assert.Error(t, err)
+
+	_, err = selectASGs(ctx, sim.Clients(), &RunnerOpts{ASGTags: []string{"cluster"}}, nil)
+	assert.Error(t, err)
+
+	_, err = selectASGs(ctx, sim.Clients(), &RunnerOpts{ASGGlobs: []string{"hashi-["}}, nil)
+	assert.Error(t, err)
+}
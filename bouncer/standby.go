@@ -0,0 +1,137 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"context"
+	"slices"
+
+	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// InStandby returns whether the instance is in, or on its way to, Standby, where it doesn't count towards its ASG's
+// desired capacity and gets no traffic from its load balancers, but is still running
+func (i *Instance) InStandby() bool {
+	return isStandbyState(i.ASGInstance.LifecycleState)
+}
+
+func isStandbyState(state at.LifecycleState) bool {
+	return state == at.LifecycleStateEnteringStandby || state == at.LifecycleStateStandby
+}
+
+// EnterStandby moves the given instances to Standby, optionally decrementing their ASGs' desired capacity so they
+// aren't replaced.  They're written to the checkpoint first, so they can be brought back even after a resume.  Once
+// the run's been interrupted, it stops before the next ASG
+func (r *BaseRunner) EnterStandby(ctx context.Context, insts []*Instance, decrement bool) error {
+	var names []string
+	byASG := make(map[string][]string)
+	for _, inst := range insts {
+		name := *inst.AutoscalingGroup.AutoScalingGroupName
+		if _, ok := byASG[name]; !ok {
+			names = append(names, name)
+		}
+		byASG[name] = append(byASG[name], *inst.ASGInstance.InstanceId)
+	}
+
+	for _, name := range names {
+		if r.Interrupted() {
+			return r.stopForInterrupt()
+		}
+
+		ids := byASG[name]
+		for _, id := range ids {
+			log.WithFields(log.Fields{
+				"ASG":        name,
+				"InstanceID": id,
+				"Decrement":  decrement,
+			}).Info("Moving instance to standby")
+			err := r.recordAction(Action{
+				Kind:       ActionEnterStandby,
+				ASG:        name,
+				InstanceID: id,
+				Decrement:  decrement,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		start := r.start[name]
+		start.Standby = append(start.Standby, ids...)
+		r.start[name] = start
+		err := r.saveCheckpoint()
+		if err != nil {
+			return errors.Wrap(err, "error writing checkpoint")
+		}
+
+		err = r.awsClients.EnterStandby(ctx, name, ids, decrement)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// StandbyInstances returns the instances bouncer moved to Standby that are still there
+func (r *BaseRunner) StandbyInstances(asgSet *ASGSet) []*Instance {
+	var instances []*Instance
+	for _, asg := range asgSet.ASGs {
+		parked := r.start[*asg.ASG.AutoScalingGroupName].Standby
+		for _, inst := range asg.Instances {
+			if inst.InStandby() && slices.Contains(parked, *inst.ASGInstance.InstanceId) {
+				instances = append(instances, inst)
+			}
+		}
+	}
+	return instances
+}
+
+// exitStandby moves the given instances of the ASG, which bouncer put in Standby, back into service, which raises
+// its desired capacity by as many
+func (r *BaseRunner) exitStandby(ctx context.Context, asgName string, insts []*Instance) error {
+	var ids []string
+	for _, inst := range insts {
+		id := *inst.ASGInstance.InstanceId
+		ids = append(ids, id)
+
+		log.WithFields(log.Fields{
+			"ASG":        asgName,
+			"InstanceID": id,
+		}).Info("Moving instance out of standby")
+		err := r.recordAction(Action{
+			Kind:       ActionExitStandby,
+			ASG:        asgName,
+			InstanceID: id,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err := r.awsClients.ExitStandby(ctx, asgName, ids)
+	if err != nil {
+		return err
+	}
+
+	start := r.start[asgName]
+	start.Standby = slices.DeleteFunc(start.Standby, func(id string) bool {
+		return slices.Contains(ids, id)
+	})
+	r.start[asgName] = start
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// validateNewInstances runs the validation command once against each new instance, as soon as it's otherwise healthy.
+// The instance ID, private IP and ASG name are appended to the command, unless it asks for what it needs with template
+// variables.  Instances only count as healthy once the command has passed, and one failing stops the run
+func (r *BaseRunner) validateNewInstances(ctx context.Context, asgSet *ASGSet) error {
+	if len(r.validateArgv) == 0 {
+		return nil
+	}
+	if r.validated == nil {
+		r.validated = make(map[string]bool)
+	}
+
+	for _, inst := range asgSet.GetNewInstances() {
+		id := *inst.ASGInstance.InstanceId
+		passed, ran := r.validated[id]
+		if ran {
+			inst.IsHealthy = inst.IsHealthy && passed
+			continue
+		}
+		if !inst.IsHealthy {
+			continue
+		}
+
+		asgName := *inst.AutoscalingGroup.AutoScalingGroupName
+		argv := r.validateArgv
+		if !usesTemplates(argv) {
+			argv = append(slices.Clone(argv), id, aws.ToString(inst.EC2Instance.PrivateIpAddress), asgName)
+		}
+
+		cmdStart := time.Now()
+		err := r.executeExternalCommand(ctx, "validation", argv, inst)
+		r.validated[id] = err == nil
+
+		event := Event{
+			Type:            EventInstanceValidated,
+			Phase:           r.phase,
+			ASG:             asgName,
+			InstanceID:      id,
+			Command:         strings.Join(argv, " "),
+			DurationSeconds: time.Since(cmdStart).Seconds(),
+		}
+		if err != nil {
+			event.Error = err.Error()
+			r.metrics.validateFailures.WithLabelValues(asgName).Inc()
+		}
+		r.emit(event)
+
+		if err != nil {
+			inst.IsHealthy = false
+			log.WithFields(log.Fields{
+				"ASG":        asgName,
+				"InstanceID": id,
+			}).Error("New instance failed validation")
+
+			err = errors.Wrapf(err, "new instance %s failed validation", id)
+			if r.Opts.AutoRollback {
+				// Leave it to the runner to roll back the next time it waits
+				r.rollbackReason = err
+				continue
+			}
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"ASG":        asgName,
+			"InstanceID": id,
+		}).Info("New instance passed validation")
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// isWarmedState returns whether the lifecycle state is one of a warm pool instance's, all of which start with Warmed:
+func isWarmedState(state at.LifecycleState) bool {
+	return strings.HasPrefix(string(state), "Warmed:")
+}
+
+// GetWarmPoolInstances returns every instance in the ASGs' warm pools
+func (a *ASGSet) GetWarmPoolInstances() []*Instance {
+	var instances []*Instance
+	for _, asg := range a.ASGs {
+		instances = append(instances, asg.WarmPool...)
+	}
+	return instances
+}
+
+// GetOldWarmPoolInstances returns the warm pool instances which are on an outdated launch configuration, and not
+// already on their way out
+func (a *ASGSet) GetOldWarmPoolInstances() []*Instance {
+	var instances []*Instance
+	for _, inst := range a.GetWarmPoolInstances() {
+		if inst.IsOld && !isWarmTransientState(inst.ASGInstance.LifecycleState) {
+			instances = append(instances, inst)
+		}
+	}
+	return instances
+}
+
+// IsWarmPoolTransient prints all warm pool instances still being launched or terminated and returns true/false
+// whether it found any.  The main rollout doesn't wait on these, since the warm pool doesn't count towards desired capacity
+func (a *ASGSet) IsWarmPoolTransient() bool {
+	isTransient := false
+
+	for _, inst := range a.GetWarmPoolInstances() {
+		if isWarmTransientState(inst.ASGInstance.LifecycleState) {
+			log.WithFields(log.Fields{
+				"ASG":        *inst.AutoscalingGroup.AutoScalingGroupName,
+				"InstanceID": *inst.ASGInstance.InstanceId,
+				"State":      inst.ASGInstance.LifecycleState,
+			}).Info("Warm pool instance is in transient state")
+			isTransient = true
+		}
+	}
+
+	return isTransient
+}
+
+func isWarmTransientState(state at.LifecycleState) bool {
+	switch state {
+	case at.LifecycleStateWarmedPending, at.LifecycleStateWarmedPendingWait, at.LifecycleStateWarmedPendingProceed,
+		at.LifecycleStateWarmedTerminating, at.LifecycleStateWarmedTerminatingWait, at.LifecycleStateWarmedTerminatingProceed:
+		return true
+	}
+	return false
+}
+
+// RefreshWarmPool terminates every old instance in the ASGs' warm pools, if asked to, once the main rollout is done.
+// AWS refills the pools from the current launch template or configuration, and the refresh waits for that to settle
+func (r *BaseRunner) RefreshWarmPool() error {
+	if !r.Opts.RefreshWarmPool {
+		return nil
+	}
+
+	// The whole refresh counts as one item against the timeout
+	ctx, cancel := r.NewContext()
+	defer cancel()
+
+	for {
+		asgSet, err := r.NewASGSet(ctx)
+		if err != nil {
+			return err
+		}
+
+		if asgSet.IsWarmPoolTransient() {
+			err = r.Wait(ctx)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		old := asgSet.GetOldWarmPoolInstances()
+		if len(old) == 0 {
+			log.Info("No old instances left in any warm pool")
+			return nil
+		}
+
+		for _, inst := range old {
+			err = r.terminateInstanceInASG(ctx, inst, aws.Bool(false))
+			if err != nil {
+				return err
+			}
+		}
+
+		err = r.Wait(ctx)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Webhook is the point in the run a webhook is called at
+type Webhook string
+
+const (
+	// WebhookPreTerminate is called for each instance right before it's terminated, after any pre-terminate command
+	WebhookPreTerminate Webhook = "pre-terminate"
+	// WebhookNewHealthy is called once for each new instance, when it first becomes healthy and has passed validation
+	WebhookNewHealthy Webhook = "post-new-healthy"
+	// WebhookRunFinished is called once the run has finished, successfully or not
+	WebhookRunFinished Webhook = "run-finished"
+)
+
+// webhookRetryDelay is how long to wait between attempts, multiplied by the attempt number
+var webhookRetryDelay = 2 * time.Second
+
+// maxWebhookErrorBody is how much of a failed response's body makes it into the error
+const maxWebhookErrorBody = 1024
+
+// WebhookOpts are the URLs bouncer POSTs to as the run goes, and how hard it tries
+type WebhookOpts struct {
+	PreTerminate string
+	NewHealthy   string
+	RunFinished  string
+	// Retries is how many more times a webhook is tried after its first attempt fails
+	Retries int
+	// Timeout is how long each attempt gets
+	Timeout time.Duration
+}
+
+func (w WebhookOpts) url(hook Webhook) string {
+	switch hook {
+	case WebhookPreTerminate:
+		return w.PreTerminate
+	case WebhookNewHealthy:
+		return w.NewHealthy
+	case WebhookRunFinished:
+		return w.RunFinished
+	}
+	return ""
+}
+
+// WebhookPayload is the JSON body POSTed to webhooks
+type WebhookPayload struct {
+	Webhook Webhook   `json:"webhook"`
+	Time    time.Time `json:"time"`
+	Mode    string    `json:"mode"`
+	Noop    bool      `json:"noop,omitempty"`
+	// Instance is set for pre-terminate and post-new-healthy
+	Instance *CommandContext `json:"instance,omitempty"`
+	// Success and Error are set for run-finished
+	Success *bool  `json:"success,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// callWebhook POSTs payload to the URL configured for hook, if there is one, retrying until it gets a 2xx response
+func (r *BaseRunner) callWebhook(ctx context.Context, hook Webhook, payload WebhookPayload) error {
+	url := r.Opts.Webhooks.url(hook)
+	if url == "" {
+		return nil
+	}
+
+	payload.Webhook = hook
+	payload.Time = time.Now()
+	payload.Mode = r.mode
+	payload.Noop = r.Opts.Noop
+	body, err := json.Marshal(&payload)
+	if err != nil {
+		return errors.Wrap(err, "error serializing webhook payload")
+	}
+
+	l := log.WithFields(log.Fields{
+		"Webhook": hook,
+		"URL":     url,
+	})
+	if payload.Instance != nil {
+		l = l.WithField("InstanceID", payload.Instance.InstanceID)
+	}
+
+	if r.Opts.Noop {
+		l.Warn("NOOP only - not actually calling webhook")
+		return nil
+	}
+
+	event := Event{
+		Type:    EventWebhookCalled,
+		Phase:   r.phase,
+		Webhook: string(hook),
+		URL:     url,
+	}
+	if payload.Instance != nil {
+		event.ASG = payload.Instance.ASG
+		event.InstanceID = payload.Instance.InstanceID
+	}
+
+	start := time.Now()
+	for attempt := 0; ; attempt++ {
+		l.WithField("Attempt", attempt+1).Info("Calling webhook")
+		event.StatusCode, err = r.postWebhook(ctx, url, body)
+		if err == nil {
+			break
+		}
+
+		l.WithField("Attempt", attempt+1).Warn(err)
+		if attempt >= r.Opts.Webhooks.Retries {
+			err = errors.Wrapf(err, "%s webhook failed after %d attempts", hook, attempt+1)
+			break
+		}
+
+		select {
+		case <-time.After(time.Duration(attempt+1) * webhookRetryDelay):
+			continue
+		case <-ctx.Done():
+		}
+		err = errors.Wrapf(err, "%s webhook gave up on timeout", hook)
+		break
+	}
+
+	event.DurationSeconds = time.Since(start).Seconds()
+	if err != nil {
+		event.Error = err.Error()
+		r.metrics.webhookFailures.WithLabelValues(string(hook)).Inc()
+	}
+	r.emit(event)
+
+	return err
+}
+
+// postWebhook makes a single attempt at a webhook, returning the response's status code
+func (r *BaseRunner) postWebhook(ctx context.Context, url string, body []byte) (int, error) {
+	timeout := r.Opts.Webhooks.Timeout
+	if timeout == 0 {
+		timeout = r.Opts.ItemTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, errors.Wrap(err, "error building webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "bouncer")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "error calling webhook")
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookErrorBody))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, errors.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	return resp.StatusCode, nil
+}
+
+// notifyNewHealthy calls the post-new-healthy webhook once for each new instance that's healthy
+func (r *BaseRunner) notifyNewHealthy(ctx context.Context, asgSet *ASGSet) error {
+	if r.Opts.Webhooks.NewHealthy == "" {
+		return nil
+	}
+	if r.notifiedHealthy == nil {
+		r.notifiedHealthy = make(map[string]bool)
+	}
+
+	for _, inst := range asgSet.GetNewInstances() {
+		id := *inst.ASGInstance.InstanceId
+		if !inst.IsHealthy || r.notifiedHealthy[id] {
+			continue
+		}
+
+		cmdCtx := newCommandContext(inst)
+		err := r.callWebhook(ctx, WebhookNewHealthy, WebhookPayload{Instance: &cmdCtx})
+		if err != nil {
+			return err
+		}
+		r.notifiedHealthy[id] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bouncer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallWebhook(t *testing.T) {
+	webhookRetryDelay = time.Millisecond
+
+	for _, tc := range []struct {
+		name     string
+		failures int
+		retries  int
+		ok       bool
+	}{
+		{name: "succeeds", failures: 0, retries: 0, ok: true},
+		{name: "succeeds on retry", failures: 2, retries: 2, ok: true},
+		{name: "runs out of retries", failures: 3, retries: 2, ok: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+				attempts++
+				if attempts <= tc.failures {
+					http.Error(w, "drain service unavailable", http.StatusServiceUnavailable)
+				}
+			}))
+			defer server.Close()
+
+			r := BaseRunner{
+				Opts: &RunnerOpts{
+					ItemTimeout: time.Minute,
+					Webhooks:    WebhookOpts{RunFinished: server.URL, Retries: tc.retries},
+				},
+				metrics: newMetrics(),
+			}
+			err := r.callWebhook(context.Background(), WebhookRunFinished, WebhookPayload{})
+
+			if tc.ok {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.failures+1, attempts)
+			} else {
+				// The error detail from the response makes it through
+				assert.ErrorContains(t, err, "drain service unavailable")
+				assert.Equal(t, tc.retries+1, attempts)
+			}
+		})
+	}
+}
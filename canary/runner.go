@@ -22,6 +22,9 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// Mode is the name this runner is invoked by
+const Mode = "canary"
+
 // Runner holds data for a particular canary run
 // Note that in the canary case, asgs will always be of length 1
 type Runner struct {
@@ -30,7 +33,7 @@ type Runner struct {
 
 // NewRunner instantiates a new canary runner
 func NewRunner(ctx context.Context, opts *bouncer.RunnerOpts) (*Runner, error) {
-	br, err := bouncer.NewBaseRunner(ctx, opts)
+	br, err := bouncer.NewBaseRunner(ctx, Mode, opts)
 	if err != nil {
 		return nil, errors.Wrap(err, "error getting base runner")
 	}
@@ -56,11 +59,11 @@ func (r *Runner) ValidatePrereqs(ctx context.Context) error {
 	}
 
 	for _, actualAsg := range asgSet.ASGs {
-		if actualAsg.DesiredASG.DesiredCapacity != *actualAsg.ASG.DesiredCapacity {
+		if actualAsg.DesiredASG.DesiredCapacity != r.StartingDesiredCapacity(actualAsg) {
 			log.WithFields(log.Fields{
 				"ASG":                     *actualAsg.ASG.AutoScalingGroupName,
 				"desired_capacity given":  actualAsg.DesiredASG.DesiredCapacity,
-				"desired_capacity actual": *actualAsg.ASG.DesiredCapacity,
+				"desired_capacity actual": r.StartingDesiredCapacity(actualAsg),
 			}).Error("Desired capacity given must be equal to starting desired_capacity of ASG")
 			return errors.New("error validating ASG state")
 		}
@@ -106,7 +109,10 @@ func (r *Runner) Run() error {
 
 		// See if we're still waiting on a change we made previously to finish or settle
 		if asgSet.IsTransient() {
-			r.Sleep(ctx)
+			err = r.WaitOrRollBack(ctx)
+			if err != nil {
+				return err
+			}
 			continue
 		}
 
@@ -127,7 +133,10 @@ func (r *Runner) Run() error {
 				// Only wait for terminating instances to finish terminating once all
 				// terminate commands have been issued
 				if asgSet.IsTerminating() {
-					r.Sleep(ctx)
+					err = r.WaitOrRollBack(ctx)
+					if err != nil {
+						return err
+					}
 					continue
 				} else {
 					log.WithFields(log.Fields{
@@ -163,7 +172,10 @@ func (r *Runner) Run() error {
 			}
 			ctx, cancel = r.NewContext()
 			defer cancel()
-			r.Sleep(ctx)
+			err = r.WaitOrRollBack(ctx)
+			if err != nil {
+				return err
+			}
 
 			continue
 		}
@@ -172,7 +184,10 @@ func (r *Runner) Run() error {
 		// The IsCountMismatch check is here and not where IsNewUnhealthy is, because we don't want it
 		// to fire when bad nodes are in the process of terminating, since we issue terminates to them one at a time
 		if asgSet.IsTerminating() || asgSet.IsCountMismatch() {
-			r.Sleep(ctx)
+			err = r.WaitOrRollBack(ctx)
+			if err != nil {
+				return err
+			}
 			continue
 		}
 
@@ -205,7 +220,10 @@ func (r *Runner) Run() error {
 
 		ctx, cancel = r.NewContext()
 		defer cancel()
-		r.Sleep(ctx)
+		err = r.WaitOrRollBack(ctx)
+		if err != nil {
+			return err
+		}
 
 		continue
 	}
@@ -0,0 +1,442 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package canary
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	tt "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	"github.com/palantir/bouncer/bouncer"
+	"github.com/palantir/bouncer/simulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRunner returns a runner against the simulator which, unless opts say otherwise, checks it every millisecond
+// and gives each change a minute
+func newTestRunner(t *testing.T, sim *simulator.Simulator, opts bouncer.RunnerOpts) *Runner {
+	t.Helper()
+	opts.Clients = sim.Clients()
+	if opts.CheckInterval == 0 {
+		opts.CheckInterval = time.Millisecond
+	}
+	if opts.ItemTimeout == 0 {
+		opts.ItemTimeout = time.Minute
+	}
+
+	r, err := NewRunner(context.Background(), &opts)
+	require.NoError(t, err)
+	return r
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	sim, err := simulator.NewWithOldASGs(simulator.ASGConfig{
+		Name:            "test-asg",
+		MinSize:         3,
+		MaxSize:         6,
+		DesiredCapacity: 3,
+		PendingHook:     "pending-hook",
+		TerminateHook:   "terminate-hook",
+	})
+	require.NoError(t, err)
+
+	r := newTestRunner(t, sim, bouncer.RunnerOpts{
+		AsgString:     "test-asg:3",
+		TerminateHook: "terminate-hook",
+		PendingHook:   "pending-hook",
+	})
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	require.NoError(t, r.Run())
+
+	assert.Equal(t, 0, sim.OldInstanceCount("test-asg"))
+	assert.Len(t, sim.InstanceStates("test-asg"), 3)
+	assert.Equal(t, int32(3), sim.DesiredCapacity("test-asg"))
+	assert.Equal(t, simulator.Stats{MaxInstances: 6, MinInService: 3}, sim.Stats("test-asg"))
+}
+
+func TestRunLBHealth(t *testing.T) {
+	for _, lbHealth := range []bool{false, true} {
+		ctx := context.Background()
+		sim, err := simulator.NewWithOldASGs(simulator.ASGConfig{
+			Name:              "test-asg",
+			MinSize:           3,
+			MaxSize:           6,
+			DesiredCapacity:   3,
+			TargetGroupARNs:   []string{"arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/test-tg/0123456789abcdef"},
+			LoadBalancerNames: []string{"test-elb"},
+			LBHealthyAfter:    3,
+			DrainingTicks:     2,
+		})
+		require.NoError(t, err)
+
+		r := newTestRunner(t, sim, bouncer.RunnerOpts{
+			AsgString: "test-asg:3",
+			LBHealth:  lbHealth,
+		})
+		require.NoError(t, r.ValidatePrereqs(ctx))
+		require.NoError(t, r.Run())
+
+		assert.Equal(t, 0, sim.OldInstanceCount("test-asg"))
+		assert.Equal(t, int32(3), sim.DesiredCapacity("test-asg"))
+		if lbHealth {
+			assert.Equal(t, int32(3), sim.Stats("test-asg").MinInService)
+		} else {
+			// Without waiting on the load balancers, old instances go before the new ones take traffic
+			assert.Less(t, sim.Stats("test-asg").MinInService, int32(3))
+		}
+	}
+}
+
+func TestRunLBHealthSharedTargetGroup(t *testing.T) {
+	ctx := context.Background()
+	tgARN := "arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/test-tg/0123456789abcdef"
+	sim, err := simulator.NewWithOldASGs(simulator.ASGConfig{
+		Name:            "test-asg",
+		MinSize:         3,
+		MaxSize:         6,
+		DesiredCapacity: 3,
+		TargetGroupARNs: []string{tgARN},
+		DrainingTicks:   2,
+	}, simulator.ASGConfig{
+		// Another ASG behind the same target group has a target that won't finish draining during the run
+		Name:            "other-asg",
+		MinSize:         0,
+		MaxSize:         1,
+		DesiredCapacity: 1,
+		TargetGroupARNs: []string{tgARN},
+		DrainingTicks:   1000000,
+	})
+	require.NoError(t, err)
+	for id := range sim.InstanceStates("other-asg") {
+		_, err := sim.Clients().ASGClient.TerminateInstanceInAutoScalingGroup(ctx, &autoscaling.TerminateInstanceInAutoScalingGroupInput{
+			InstanceId:                     aws.String(id),
+			ShouldDecrementDesiredCapacity: aws.Bool(true),
+		})
+		require.NoError(t, err)
+	}
+
+	r := newTestRunner(t, sim, bouncer.RunnerOpts{
+		AsgString:   "test-asg:3",
+		ItemTimeout: 5 * time.Second,
+		LBHealth:    true,
+	})
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	require.NoError(t, r.Run())
+
+	assert.Equal(t, 0, sim.OldInstanceCount("test-asg"))
+	assert.Equal(t, int32(3), sim.DesiredCapacity("test-asg"))
+}
+
+func TestRunLBHealthIPTargetGroup(t *testing.T) {
+	ctx := context.Background()
+	sim, err := simulator.NewWithOldASGs(simulator.ASGConfig{
+		Name:            "test-asg",
+		MinSize:         3,
+		MaxSize:         6,
+		DesiredCapacity: 3,
+		TargetGroupARNs: []string{"arn:aws:elasticloadbalancing:us-east-1:123456789012:targetgroup/test-tg/0123456789abcdef"},
+		TargetType:      tt.TargetTypeEnumIp,
+	})
+	require.NoError(t, err)
+
+	// Targets registered by IP can't be matched to instances, so this fails up front rather than never going healthy
+	r := newTestRunner(t, sim, bouncer.RunnerOpts{
+		AsgString: "test-asg:3",
+		LBHealth:  true,
+	})
+	err = r.ValidatePrereqs(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "has ip targets")
+	assert.Equal(t, 3, sim.OldInstanceCount("test-asg"))
+}
+
+func TestRunValidateNew(t *testing.T) {
+	// A command with template variables only gets what it asks for, not the instance appended as well
+	for _, command := range []string{"true", "false", "sh -c 'test $# -eq 1' validate {{.InstanceID}}"} {
+		ctx := context.Background()
+		sim, err := simulator.NewWithOldASGs(simulator.ASGConfig{
+			Name:            "test-asg",
+			MinSize:         3,
+			MaxSize:         6,
+			DesiredCapacity: 3,
+		})
+		require.NoError(t, err)
+
+		r := newTestRunner(t, sim, bouncer.RunnerOpts{
+			AsgString:       "test-asg:3",
+			ValidateCommand: command,
+		})
+		require.NoError(t, r.ValidatePrereqs(ctx))
+		err = r.Run()
+
+		if command != "false" {
+			require.NoError(t, err)
+			assert.Equal(t, 0, sim.OldInstanceCount("test-asg"))
+		} else {
+			// The canary fails validation, so no old instance may be touched
+			assert.Error(t, err)
+			assert.Equal(t, 3, sim.OldInstanceCount("test-asg"))
+		}
+	}
+}
+
+func TestRunAutoRollback(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config simulator.ASGConfig
+		opts   bouncer.RunnerOpts
+	}{
+		{
+			name: "validation",
+			opts: bouncer.RunnerOpts{ValidateCommand: "false"},
+		},
+		{
+			name: "timeout",
+			// The new instance never takes traffic
+			config: simulator.ASGConfig{LoadBalancerNames: []string{"test-elb"}, LBHealthyAfter: 1000000},
+			opts:   bouncer.RunnerOpts{ItemTimeout: 50 * time.Millisecond, LBHealth: true},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := tc.config
+			cfg.Name = "test-asg"
+			cfg.MinSize = 3
+			cfg.MaxSize = 6
+			cfg.DesiredCapacity = 3
+			sim, err := simulator.NewWithOldASGs(cfg)
+			require.NoError(t, err)
+			oldStates := sim.InstanceStates("test-asg")
+
+			opts := tc.opts
+			opts.AsgString = "test-asg:3"
+			opts.AutoRollback = true
+			opts.MaxFailedReplacements = 3
+			r := newTestRunner(t, sim, opts)
+			require.NoError(t, r.ValidatePrereqs(ctx))
+			err = r.Run()
+
+			require.Error(t, err)
+			assert.True(t, bouncer.IsRollback(err))
+			for i := 0; i < 10; i++ {
+				sim.Tick()
+			}
+
+			// Only the old instances are left, untouched
+			assert.Equal(t, int32(3), sim.DesiredCapacity("test-asg"))
+			assert.Equal(t, oldStates, sim.InstanceStates("test-asg"))
+		})
+	}
+}
+
+func TestRunInterrupt(t *testing.T) {
+	for _, restore := range []bool{false, true} {
+		ctx := context.Background()
+		sim, err := simulator.NewWithOldASGs(simulator.ASGConfig{
+			Name:            "test-asg",
+			MinSize:         3,
+			MaxSize:         6,
+			DesiredCapacity: 3,
+		})
+		require.NoError(t, err)
+		oldStates := sim.InstanceStates("test-asg")
+
+		interrupt := make(chan struct{})
+		r := newTestRunner(t, sim, bouncer.RunnerOpts{
+			AsgString:          "test-asg:3",
+			CheckInterval:      10 * time.Millisecond,
+			Interrupt:          interrupt,
+			RestoreOnInterrupt: restore,
+		})
+		require.NoError(t, r.ValidatePrereqs(ctx))
+
+		// Interrupt as soon as the canary's been added
+		go func() {
+			for sim.DesiredCapacity("test-asg") == 3 {
+				time.Sleep(time.Millisecond)
+			}
+			close(interrupt)
+		}()
+
+		err = r.Run()
+		assert.True(t, errors.Is(err, bouncer.ErrInterrupted))
+		assert.Equal(t, 3, sim.OldInstanceCount("test-asg"))
+		if restore {
+			for i := 0; i < 10; i++ {
+				sim.Tick()
+			}
+			assert.Equal(t, int32(3), sim.DesiredCapacity("test-asg"))
+			assert.Equal(t, oldStates, sim.InstanceStates("test-asg"))
+		} else {
+			// The canary is left to finish coming up
+			assert.Equal(t, int32(4), sim.DesiredCapacity("test-asg"))
+			assert.Len(t, sim.InstanceStates("test-asg"), 4)
+		}
+	}
+}
+
+func TestRunInterruptBeforeStart(t *testing.T) {
+	ctx := context.Background()
+	sim, err := simulator.NewWithOldASGs(simulator.ASGConfig{
+		Name:            "test-asg",
+		MinSize:         3,
+		MaxSize:         6,
+		DesiredCapacity: 3,
+	})
+	require.NoError(t, err)
+
+	// Nothing's been looked at, let alone changed, so there's nothing to restore
+	interrupt := make(chan struct{})
+	close(interrupt)
+	r := newTestRunner(t, sim, bouncer.RunnerOpts{
+		AsgString:          "test-asg:3",
+		CheckInterval:      10 * time.Millisecond,
+		Interrupt:          interrupt,
+		RestoreOnInterrupt: true,
+	})
+	err = r.ValidatePrereqs(ctx)
+	assert.True(t, errors.Is(err, bouncer.ErrInterrupted))
+	assert.Equal(t, int32(3), sim.DesiredCapacity("test-asg"))
+}
+
+func TestRunNoop(t *testing.T) {
+	ctx := context.Background()
+	sim, err := simulator.NewWithOldASGs(simulator.ASGConfig{
+		Name:            "test-asg",
+		MinSize:         3,
+		MaxSize:         6,
+		DesiredCapacity: 3,
+	})
+	require.NoError(t, err)
+	oldStates := sim.InstanceStates("test-asg")
+
+	r := newTestRunner(t, sim, bouncer.RunnerOpts{
+		Noop:      true,
+		AsgString: "test-asg:3",
+	})
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	require.NoError(t, r.Run())
+
+	var kinds []bouncer.ActionKind
+	var terminated []string
+	for _, action := range r.Actions() {
+		kinds = append(kinds, action.Kind)
+		if action.Kind == bouncer.ActionTerminateInstance {
+			assert.True(t, action.Decrement)
+			terminated = append(terminated, action.InstanceID)
+		}
+	}
+	assert.Equal(t, []bouncer.ActionKind{
+		bouncer.ActionSetDesiredCapacity,
+		bouncer.ActionSetDesiredCapacity,
+		bouncer.ActionTerminateInstance,
+		bouncer.ActionTerminateInstance,
+		bouncer.ActionTerminateInstance,
+	}, kinds)
+	assert.Equal(t, int32(4), r.Actions()[0].DesiredCapacity)
+	assert.Equal(t, int32(6), r.Actions()[1].DesiredCapacity)
+	for _, id := range terminated {
+		assert.Contains(t, oldStates, id)
+	}
+
+	// The real ASG must be untouched
+	assert.Equal(t, oldStates, sim.InstanceStates("test-asg"))
+	assert.Equal(t, int32(3), sim.DesiredCapacity("test-asg"))
+}
+
+func TestRunResume(t *testing.T) {
+	ctx := context.Background()
+	sim, err := simulator.NewWithOldASGs(simulator.ASGConfig{
+		Name:            "test-asg",
+		MinSize:         3,
+		MaxSize:         6,
+		DesiredCapacity: 3,
+	})
+	require.NoError(t, err)
+
+	// Interrupted after the canary phase bumped desired capacity to 4
+	desired := int32(4)
+	_, err = sim.SetDesiredCapacity(ctx, &autoscaling.SetDesiredCapacityInput{
+		AutoScalingGroupName: aws.String("test-asg"),
+		DesiredCapacity:      &desired,
+	})
+	require.NoError(t, err)
+
+	checkpointFile := filepath.Join(t.TempDir(), "checkpoint.json")
+	data, err := json.Marshal(&bouncer.Checkpoint{
+		Mode:  Mode,
+		ASGs:  []bouncer.ASGCapacity{{Name: "test-asg", DesiredCapacity: 3, MinSize: 3, MaxSize: 6}},
+		Phase: 1,
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(checkpointFile, data, 0600))
+
+	opts := bouncer.RunnerOpts{
+		AsgString:      "test-asg:3",
+		CheckpointFile: checkpointFile,
+	}
+
+	// Without --resume the raised desired capacity is refused
+	r := newTestRunner(t, sim, opts)
+	require.Error(t, r.ValidatePrereqs(ctx))
+
+	opts.Resume = true
+	r = newTestRunner(t, sim, opts)
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	require.NoError(t, r.Run())
+	require.NoError(t, r.RemoveCheckpoint())
+
+	assert.Equal(t, 0, sim.OldInstanceCount("test-asg"))
+	assert.Len(t, sim.InstanceStates("test-asg"), 3)
+	assert.Equal(t, int32(3), sim.DesiredCapacity("test-asg"))
+	assert.NoFileExists(t, checkpointFile)
+}
+
+func TestResumeWrongMode(t *testing.T) {
+	ctx := context.Background()
+	sim := simulator.New()
+	require.NoError(t, sim.AddASG(simulator.ASGConfig{
+		Name:            "test-asg",
+		MinSize:         3,
+		MaxSize:         6,
+		DesiredCapacity: 3,
+	}))
+
+	checkpointFile := filepath.Join(t.TempDir(), "checkpoint.json")
+	data, err := json.Marshal(&bouncer.Checkpoint{
+		Mode: "batch-canary",
+		ASGs: []bouncer.ASGCapacity{{Name: "test-asg", DesiredCapacity: 3, MinSize: 3, MaxSize: 6}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(checkpointFile, data, 0600))
+
+	_, err = NewRunner(ctx, &bouncer.RunnerOpts{
+		AsgString:      "test-asg:3",
+		ItemTimeout:    time.Minute,
+		Clients:        sim.Clients(),
+		CheckpointFile: checkpointFile,
+		Resume:         true,
+	})
+	assert.Error(t, err)
+}
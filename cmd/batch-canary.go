@@ -16,6 +16,7 @@ package cmd
 
 import (
 	"context"
+	"os"
 
 	"github.com/palantir/bouncer/batchcanary"
 	"github.com/palantir/bouncer/bouncer"
@@ -39,35 +40,67 @@ var batchCanaryCmd = &cobra.Command{
 		}
 
 		asgString := viper.GetString("batchcanary.asg")
-		if asgString == "" {
-			log.Fatal("You must specify ASG to cycle nodes from")
+		asgTags := viper.GetStringSlice("asg-tag")
+		asgGlobs := viper.GetStringSlice("asg-glob")
+		if asgString == "" && len(asgTags) == 0 && len(asgGlobs) == 0 {
+			log.Fatal("You must specify ASG to cycle nodes from, or select them with --asg-tag or --asg-glob")
 		}
 
 		commandString := viper.GetString("batchcanary.command")
 		noop := viper.GetBool("batchcanary.noop")
 		force := viper.GetBool("batchcanary.force")
-		batchSize := viper.GetInt32("batchcanary.batchsize")
+		checkpointFile := viper.GetString("batchcanary.checkpoint-file")
+		resume := viper.GetBool("batchcanary.resume")
+		batchSize, batchPercent, err := bouncer.ParseBatchSize(viper.GetString("batchcanary.batchsize"))
+		if err != nil {
+			log.Fatal(err)
+		}
 		termHook := viper.GetString("terminate-hook")
 		pendHook := viper.GetString("pending-hook")
+		eventsFile := viper.GetString("events-file")
+		summaryFile := viper.GetString("summary-file")
+		metricsAddr := viper.GetString("metrics-addr")
+		lbHealth := viper.GetBool("lb-health")
+		autoRollback := viper.GetBool("batch-canary.auto-rollback")
+		maxFailed := viper.GetInt("batch-canary.max-failed-replacements")
+		validateCommand := viper.GetString("validate-new")
+		restoreOnInterrupt := viper.GetBool("restore-on-interrupt")
 		timeout := timeoutFromViper()
-
-		if batchSize < 0 {
-			log.Fatalf("Batch size must be >= 0, got %d", batchSize)
-		}
+		clientOpts := awsClientOptsFromViper()
 
 		log.Debugf("Binding vars, got %+v %+v %+v %+v", asgString, noop, version, commandString)
 
 		log.Info("Beginning bouncer batch canary run")
 
 		opts := bouncer.RunnerOpts{
-			Noop:          noop,
-			BatchSize:     &batchSize,
-			Force:         force,
-			AsgString:     asgString,
-			CommandString: commandString,
-			TerminateHook: termHook,
-			PendingHook:   pendHook,
-			ItemTimeout:   timeout,
+			Noop:                  noop,
+			BatchSize:             &batchSize,
+			BatchPercent:          batchPercent,
+			Force:                 force,
+			AsgString:             asgString,
+			ASGTags:               asgTags,
+			ASGGlobs:              asgGlobs,
+			CommandString:         commandString,
+			TerminateHook:         termHook,
+			PendingHook:           pendHook,
+			ItemTimeout:           timeout,
+			ClientOpts:            clientOpts,
+			EventsFile:            eventsFile,
+			SummaryFile:           summaryFile,
+			MetricsAddr:           metricsAddr,
+			LBHealth:              lbHealth,
+			ValidateCommand:       validateCommand,
+			Interrupt:             handleInterrupts(),
+			RestoreOnInterrupt:    restoreOnInterrupt,
+			Webhooks:              webhookOptsFromViper(),
+			SuspendProcesses:      viper.GetStringSlice("suspend-processes"),
+			UnprotectOld:          viper.GetBool("unprotect-old"),
+			ProtectNew:            viper.GetBool("protect-new"),
+			RefreshWarmPool:       viper.GetBool("refresh-warm-pool"),
+			AutoRollback:          autoRollback,
+			MaxFailedReplacements: maxFailed,
+			CheckpointFile:        checkpointFile,
+			Resume:                resume,
 		}
 
 		ctx, cancel := context.WithCancel(context.Background())
@@ -78,16 +111,37 @@ var batchCanaryCmd = &cobra.Command{
 		if err != nil {
 			log.Fatal(errors.Wrap(err, "error initializing runner"))
 		}
+		log.RegisterExitHandler(func() {
+			r.Finish(errors.New("bouncer exited on a fatal error"))
+		})
 
 		err = r.ValidatePrereqs(ctx)
 		if err != nil {
+			r.Finish(err)
 			log.Fatal(err)
 		}
 
 		err = r.Run()
+		if err == nil {
+			err = r.RefreshWarmPool()
+		}
+		r.Finish(err)
+		if bouncer.IsRollback(err) {
+			log.Error(err)
+			os.Exit(bouncer.RollbackExitCode)
+		}
 		if err != nil {
 			log.Fatal(errors.Wrap(err, "error in run"))
 		}
+
+		if noop {
+			r.LogNoopPlan()
+		}
+
+		err = r.RemoveCheckpoint()
+		if err != nil {
+			log.Fatal(err)
+		}
 	},
 }
 
@@ -106,7 +160,7 @@ func init() {
 		log.Fatal(errors.Wrap(err, "Binding PFlag 'asg' to viper var 'batchcanary.asg' failed: %s"))
 	}
 
-	batchCanaryCmd.Flags().Int32P("batchsize", "b", 0, "Max number of nodes to refresh at a time after the single canary. Defaults to all remaining nodes.")
+	batchCanaryCmd.Flags().StringP("batchsize", "b", "0", "Max number of nodes to refresh at a time after the single canary, or a percentage of desired capacity like 25%, rounded up. Defaults to all remaining nodes.")
 	err = viper.BindPFlag("batchcanary.batchsize", batchCanaryCmd.Flags().Lookup("batchsize"))
 	if err != nil {
 		log.Fatal(errors.Wrap(err, "Binding PFlag 'batchsize' to viper var 'batchcanary.batchsize' failed: %s"))
@@ -118,9 +172,33 @@ func init() {
 		log.Fatal(errors.Wrap(err, "Binding PFlag 'command' to viper var 'batchcanary.command' failed: %s"))
 	}
 
-	batchCanaryCmd.Flags().BoolP("force", "f", false, "Force all nodes to be recycled, even if they're running the latest launch config")
+	batchCanaryCmd.Flags().BoolP("force", "f", false, "Force all nodes to be recycled, even if they're running the latest launch config; needed to roll out an on-demand or spot distribution change, which doesn't make any node old")
 	err = viper.BindPFlag("batchcanary.force", batchCanaryCmd.Flags().Lookup("force"))
 	if err != nil {
 		log.Fatal(errors.Wrap(err, "Binding PFlag 'force' to viper var 'batchcanary.force' failed: %s"))
 	}
+
+	batchCanaryCmd.Flags().StringP("checkpoint-file", "", "", "File to record progress in, so an interrupted run can be resumed with --resume")
+	err = viper.BindPFlag("batchcanary.checkpoint-file", batchCanaryCmd.Flags().Lookup("checkpoint-file"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'checkpoint-file' to viper var 'batchcanary.checkpoint-file' failed: %s"))
+	}
+
+	batchCanaryCmd.Flags().BoolP("resume", "", false, "Resume an interrupted run from the state recorded in --checkpoint-file")
+	err = viper.BindPFlag("batchcanary.resume", batchCanaryCmd.Flags().Lookup("resume"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'resume' to viper var 'batchcanary.resume' failed: %s"))
+	}
+
+	batchCanaryCmd.Flags().BoolP("auto-rollback", "", false, "If the canary fails, terminate the new instances and restore the original desired capacity, then exit 3")
+	err = viper.BindPFlag("batch-canary.auto-rollback", batchCanaryCmd.Flags().Lookup("auto-rollback"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'auto-rollback' to viper var 'batch-canary.auto-rollback' failed: %s"))
+	}
+
+	batchCanaryCmd.Flags().IntP("max-failed-replacements", "", 3, "With --auto-rollback, roll back once this many new instances have gone away without becoming healthy")
+	err = viper.BindPFlag("batch-canary.max-failed-replacements", batchCanaryCmd.Flags().Lookup("max-failed-replacements"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'max-failed-replacements' to viper var 'batch-canary.max-failed-replacements' failed: %s"))
+	}
 }
@@ -39,19 +39,33 @@ var batchSerialCmd = &cobra.Command{
 		}
 
 		asgsString := viper.GetString("batchserial.asgs")
-		if asgsString == "" {
-			log.Fatal("You must specify ASGs to cycle nodes from (in a comma-delimited list)")
+		asgTags := viper.GetStringSlice("asg-tag")
+		asgGlobs := viper.GetStringSlice("asg-glob")
+		if asgsString == "" && len(asgTags) == 0 && len(asgGlobs) == 0 {
+			log.Fatal("You must specify ASGs to cycle nodes from (in a comma-delimited list), or select them with --asg-tag or --asg-glob")
 		}
 
 		commandString := viper.GetString("batchserial.command")
 		noop := viper.GetBool("batchserial.noop")
 		force := viper.GetBool("batchserial.force")
-		batchSize := viper.GetInt32("batchserial.batchsize")
+		checkpointFile := viper.GetString("batchserial.checkpoint-file")
+		resume := viper.GetBool("batchserial.resume")
+		batchSize, batchPercent, err := bouncer.ParseBatchSize(viper.GetString("batchserial.batchsize"))
+		if err != nil {
+			log.Fatal(err)
+		}
 		termHook := viper.GetString("terminate-hook")
 		pendHook := viper.GetString("pending-hook")
+		eventsFile := viper.GetString("events-file")
+		summaryFile := viper.GetString("summary-file")
+		metricsAddr := viper.GetString("metrics-addr")
+		lbHealth := viper.GetBool("lb-health")
+		validateCommand := viper.GetString("validate-new")
+		restoreOnInterrupt := viper.GetBool("restore-on-interrupt")
 		timeout := timeoutFromViper()
+		clientOpts := awsClientOptsFromViper()
 
-		if batchSize < 1 {
+		if batchPercent == nil && batchSize < 1 {
 			log.Fatalf("Batch size must be >= 1, got %d", batchSize)
 		}
 
@@ -61,15 +75,33 @@ var batchSerialCmd = &cobra.Command{
 
 		var defCap int32 = 1
 		opts := bouncer.RunnerOpts{
-			Noop:            noop,
-			BatchSize:       &batchSize,
-			Force:           force,
-			AsgString:       asgsString,
-			CommandString:   commandString,
-			DefaultCapacity: &defCap,
-			TerminateHook:   termHook,
-			PendingHook:     pendHook,
-			ItemTimeout:     timeout,
+			Noop:               noop,
+			BatchSize:          &batchSize,
+			BatchPercent:       batchPercent,
+			Force:              force,
+			AsgString:          asgsString,
+			ASGTags:            asgTags,
+			ASGGlobs:           asgGlobs,
+			CommandString:      commandString,
+			DefaultCapacity:    &defCap,
+			TerminateHook:      termHook,
+			PendingHook:        pendHook,
+			ItemTimeout:        timeout,
+			ClientOpts:         clientOpts,
+			EventsFile:         eventsFile,
+			SummaryFile:        summaryFile,
+			MetricsAddr:        metricsAddr,
+			LBHealth:           lbHealth,
+			ValidateCommand:    validateCommand,
+			Interrupt:          handleInterrupts(),
+			RestoreOnInterrupt: restoreOnInterrupt,
+			Webhooks:           webhookOptsFromViper(),
+			SuspendProcesses:   viper.GetStringSlice("suspend-processes"),
+			UnprotectOld:       viper.GetBool("unprotect-old"),
+			ProtectNew:         viper.GetBool("protect-new"),
+			RefreshWarmPool:    viper.GetBool("refresh-warm-pool"),
+			CheckpointFile:     checkpointFile,
+			Resume:             resume,
 		}
 
 		ctx, cancel := context.WithCancel(context.Background())
@@ -80,16 +112,33 @@ var batchSerialCmd = &cobra.Command{
 		if err != nil {
 			log.Fatal(errors.Wrap(err, "error initializing runner"))
 		}
+		log.RegisterExitHandler(func() {
+			r.Finish(errors.New("bouncer exited on a fatal error"))
+		})
 
 		err = r.ValidatePrereqs(ctx)
 		if err != nil {
+			r.Finish(err)
 			log.Fatal(err)
 		}
 
 		err = r.Run()
+		if err == nil {
+			err = r.RefreshWarmPool()
+		}
+		r.Finish(err)
 		if err != nil {
 			log.Fatal(errors.Wrap(err, "error in run"))
 		}
+
+		if noop {
+			r.LogNoopPlan()
+		}
+
+		err = r.RemoveCheckpoint()
+		if err != nil {
+			log.Fatal(err)
+		}
 	},
 }
 
@@ -108,7 +157,7 @@ func init() {
 		log.Fatal(errors.Wrap(err, "Binding PFlag 'asgs' to viper var 'batchserial.asgs' failed: %s"))
 	}
 
-	batchSerialCmd.Flags().Int32P("batchsize", "b", 1, "Max number of nodes to terminate at a time after the single canary. Defaults to all remaining nodes.")
+	batchSerialCmd.Flags().StringP("batchsize", "b", "1", "Max number of nodes to terminate at a time after the single canary, or a percentage of desired capacity like 25%, rounded down.")
 	err = viper.BindPFlag("batchserial.batchsize", batchSerialCmd.Flags().Lookup("batchsize"))
 	if err != nil {
 		log.Fatal(errors.Wrap(err, "Binding PFlag 'batchsize' to viper var 'batchserial.batchsize' failed: %s"))
@@ -120,9 +169,21 @@ func init() {
 		log.Fatal(errors.Wrap(err, "Binding PFlag 'command' to viper var 'batchserial.command' failed: %s"))
 	}
 
-	batchSerialCmd.Flags().BoolP("force", "f", false, "Force all nodes to be recycled, even if they're running the latest launch config")
+	batchSerialCmd.Flags().BoolP("force", "f", false, "Force all nodes to be recycled, even if they're running the latest launch config; needed to roll out an on-demand or spot distribution change, which doesn't make any node old")
 	err = viper.BindPFlag("batchserial.force", batchSerialCmd.Flags().Lookup("force"))
 	if err != nil {
 		log.Fatal(errors.Wrap(err, "Binding PFlag 'force' to viper var 'batchserial.force' failed: %s"))
 	}
+
+	batchSerialCmd.Flags().StringP("checkpoint-file", "", "", "File to record progress in, so an interrupted run can be resumed with --resume")
+	err = viper.BindPFlag("batchserial.checkpoint-file", batchSerialCmd.Flags().Lookup("checkpoint-file"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'checkpoint-file' to viper var 'batchserial.checkpoint-file' failed: %s"))
+	}
+
+	batchSerialCmd.Flags().BoolP("resume", "", false, "Resume an interrupted run from the state recorded in --checkpoint-file")
+	err = viper.BindPFlag("batchserial.resume", batchSerialCmd.Flags().Lookup("resume"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'resume' to viper var 'batchserial.resume' failed: %s"))
+	}
 }
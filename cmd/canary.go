@@ -16,6 +16,7 @@ package cmd
 
 import (
 	"context"
+	"os"
 
 	"github.com/palantir/bouncer/bouncer"
 	"github.com/palantir/bouncer/canary"
@@ -39,30 +40,62 @@ var canaryCmd = &cobra.Command{
 		}
 
 		asgString := viper.GetString("canary.asg")
-		if asgString == "" {
-			log.Fatal("You must specify ASG to cycle nodes from")
+		asgTags := viper.GetStringSlice("asg-tag")
+		asgGlobs := viper.GetStringSlice("asg-glob")
+		if asgString == "" && len(asgTags) == 0 && len(asgGlobs) == 0 {
+			log.Fatal("You must specify ASG to cycle nodes from, or select them with --asg-tag or --asg-glob")
 		}
 
 		commandString := viper.GetString("canary.command")
 		noop := viper.GetBool("canary.noop")
 		force := viper.GetBool("canary.force")
+		checkpointFile := viper.GetString("canary.checkpoint-file")
+		resume := viper.GetBool("canary.resume")
 		termHook := viper.GetString("terminate-hook")
 		pendHook := viper.GetString("pending-hook")
+		eventsFile := viper.GetString("events-file")
+		summaryFile := viper.GetString("summary-file")
+		metricsAddr := viper.GetString("metrics-addr")
+		lbHealth := viper.GetBool("lb-health")
+		autoRollback := viper.GetBool("canary.auto-rollback")
+		maxFailed := viper.GetInt("canary.max-failed-replacements")
+		validateCommand := viper.GetString("validate-new")
+		restoreOnInterrupt := viper.GetBool("restore-on-interrupt")
 		timeout := timeoutFromViper()
+		clientOpts := awsClientOptsFromViper()
 
 		log.Debugf("Binding vars, got %+v %+v %+v %+v", asgString, noop, version, commandString)
 
 		log.Info("Beginning bouncer canary run")
 
 		opts := bouncer.RunnerOpts{
-			Noop:            noop,
-			Force:           force,
-			AsgString:       asgString,
-			CommandString:   commandString,
-			DefaultCapacity: nil,
-			TerminateHook:   termHook,
-			PendingHook:     pendHook,
-			ItemTimeout:     timeout,
+			Noop:                  noop,
+			Force:                 force,
+			AsgString:             asgString,
+			ASGTags:               asgTags,
+			ASGGlobs:              asgGlobs,
+			CommandString:         commandString,
+			DefaultCapacity:       nil,
+			TerminateHook:         termHook,
+			PendingHook:           pendHook,
+			ItemTimeout:           timeout,
+			ClientOpts:            clientOpts,
+			EventsFile:            eventsFile,
+			SummaryFile:           summaryFile,
+			MetricsAddr:           metricsAddr,
+			LBHealth:              lbHealth,
+			ValidateCommand:       validateCommand,
+			Interrupt:             handleInterrupts(),
+			RestoreOnInterrupt:    restoreOnInterrupt,
+			Webhooks:              webhookOptsFromViper(),
+			SuspendProcesses:      viper.GetStringSlice("suspend-processes"),
+			UnprotectOld:          viper.GetBool("unprotect-old"),
+			ProtectNew:            viper.GetBool("protect-new"),
+			RefreshWarmPool:       viper.GetBool("refresh-warm-pool"),
+			AutoRollback:          autoRollback,
+			MaxFailedReplacements: maxFailed,
+			CheckpointFile:        checkpointFile,
+			Resume:                resume,
 		}
 
 		ctx, cancel := context.WithCancel(context.Background())
@@ -73,16 +106,37 @@ var canaryCmd = &cobra.Command{
 		if err != nil {
 			log.Fatal(errors.Wrap(err, "error initializing runner"))
 		}
+		log.RegisterExitHandler(func() {
+			r.Finish(errors.New("bouncer exited on a fatal error"))
+		})
 
 		err = r.ValidatePrereqs(ctx)
 		if err != nil {
+			r.Finish(err)
 			log.Fatal(err)
 		}
 
 		err = r.Run()
+		if err == nil {
+			err = r.RefreshWarmPool()
+		}
+		r.Finish(err)
+		if bouncer.IsRollback(err) {
+			log.Error(err)
+			os.Exit(bouncer.RollbackExitCode)
+		}
 		if err != nil {
 			log.Fatal(errors.Wrap(err, "error in run"))
 		}
+
+		if noop {
+			r.LogNoopPlan()
+		}
+
+		err = r.RemoveCheckpoint()
+		if err != nil {
+			log.Fatal(err)
+		}
 	},
 }
 
@@ -107,9 +161,33 @@ func init() {
 		log.Fatal(errors.Wrap(err, "Binding PFlag 'command' to viper var 'canary.command' failed: %s"))
 	}
 
-	canaryCmd.Flags().BoolP("force", "f", false, "Force all nodes to be recycled, even if they're running the latest launch config")
+	canaryCmd.Flags().BoolP("force", "f", false, "Force all nodes to be recycled, even if they're running the latest launch config; needed to roll out an on-demand or spot distribution change, which doesn't make any node old")
 	err = viper.BindPFlag("canary.force", canaryCmd.Flags().Lookup("force"))
 	if err != nil {
 		log.Fatal(errors.Wrap(err, "Binding PFlag 'force' to viper var 'canary.force' failed: %s"))
 	}
+
+	canaryCmd.Flags().StringP("checkpoint-file", "", "", "File to record progress in, so an interrupted run can be resumed with --resume")
+	err = viper.BindPFlag("canary.checkpoint-file", canaryCmd.Flags().Lookup("checkpoint-file"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'checkpoint-file' to viper var 'canary.checkpoint-file' failed: %s"))
+	}
+
+	canaryCmd.Flags().BoolP("resume", "", false, "Resume an interrupted run from the state recorded in --checkpoint-file")
+	err = viper.BindPFlag("canary.resume", canaryCmd.Flags().Lookup("resume"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'resume' to viper var 'canary.resume' failed: %s"))
+	}
+
+	canaryCmd.Flags().BoolP("auto-rollback", "", false, "If the canary fails, terminate the new instances and restore the original desired capacity, then exit 3")
+	err = viper.BindPFlag("canary.auto-rollback", canaryCmd.Flags().Lookup("auto-rollback"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'auto-rollback' to viper var 'canary.auto-rollback' failed: %s"))
+	}
+
+	canaryCmd.Flags().IntP("max-failed-replacements", "", 3, "With --auto-rollback, roll back once this many new instances have gone away without becoming healthy")
+	err = viper.BindPFlag("canary.max-failed-replacements", canaryCmd.Flags().Lookup("max-failed-replacements"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'max-failed-replacements' to viper var 'canary.max-failed-replacements' failed: %s"))
+	}
 }
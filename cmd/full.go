@@ -39,8 +39,10 @@ var fullCmd = &cobra.Command{
 		}
 
 		asgsString := viper.GetString("full.asgs")
-		if asgsString == "" {
-			log.Fatal("You must specify ASGs to cycle nodes from (in a comma-delimited list)")
+		asgTags := viper.GetStringSlice("asg-tag")
+		asgGlobs := viper.GetStringSlice("asg-glob")
+		if asgsString == "" && len(asgTags) == 0 && len(asgGlobs) == 0 {
+			log.Fatal("You must specify ASGs to cycle nodes from (in a comma-delimited list), or select them with --asg-tag or --asg-glob")
 		}
 
 		commandString := viper.GetString("full.command")
@@ -48,8 +50,15 @@ var fullCmd = &cobra.Command{
 		force := viper.GetBool("full.force")
 		termHook := viper.GetString("terminate-hook")
 		pendHook := viper.GetString("pending-hook")
+		eventsFile := viper.GetString("events-file")
+		summaryFile := viper.GetString("summary-file")
+		metricsAddr := viper.GetString("metrics-addr")
+		lbHealth := viper.GetBool("lb-health")
+		validateCommand := viper.GetString("validate-new")
+		restoreOnInterrupt := viper.GetBool("restore-on-interrupt")
 		fast := viper.GetBool("full.fast")
 		timeout := timeoutFromViper()
+		clientOpts := awsClientOptsFromViper()
 
 		log.Debugf("Binding vars, got %+v %+v %+v %+v", asgsString, noop, version, commandString)
 
@@ -57,15 +66,30 @@ var fullCmd = &cobra.Command{
 
 		var defCap int32 = 1
 		opts := bouncer.RunnerOpts{
-			Noop:            noop,
-			Force:           force,
-			Fast:            fast,
-			AsgString:       asgsString,
-			CommandString:   commandString,
-			DefaultCapacity: &defCap,
-			TerminateHook:   termHook,
-			PendingHook:     pendHook,
-			ItemTimeout:     timeout,
+			Noop:               noop,
+			Force:              force,
+			Fast:               fast,
+			AsgString:          asgsString,
+			ASGTags:            asgTags,
+			ASGGlobs:           asgGlobs,
+			CommandString:      commandString,
+			DefaultCapacity:    &defCap,
+			TerminateHook:      termHook,
+			PendingHook:        pendHook,
+			ItemTimeout:        timeout,
+			ClientOpts:         clientOpts,
+			EventsFile:         eventsFile,
+			SummaryFile:        summaryFile,
+			MetricsAddr:        metricsAddr,
+			LBHealth:           lbHealth,
+			ValidateCommand:    validateCommand,
+			Interrupt:          handleInterrupts(),
+			RestoreOnInterrupt: restoreOnInterrupt,
+			Webhooks:           webhookOptsFromViper(),
+			SuspendProcesses:   viper.GetStringSlice("suspend-processes"),
+			UnprotectOld:       viper.GetBool("unprotect-old"),
+			ProtectNew:         viper.GetBool("protect-new"),
+			RefreshWarmPool:    viper.GetBool("refresh-warm-pool"),
 		}
 
 		ctx, cancel := context.WithCancel(context.Background())
@@ -76,16 +100,28 @@ var fullCmd = &cobra.Command{
 		if err != nil {
 			log.Fatal(errors.Wrap(err, "error initializing runner"))
 		}
+		log.RegisterExitHandler(func() {
+			r.Finish(errors.New("bouncer exited on a fatal error"))
+		})
 
 		err = r.ValidatePrereqs(ctx)
 		if err != nil {
+			r.Finish(err)
 			log.Fatal(err)
 		}
 
 		err = r.Run()
+		if err == nil {
+			err = r.RefreshWarmPool()
+		}
+		r.Finish(err)
 		if err != nil {
 			log.Fatal(errors.Wrap(err, "error in run"))
 		}
+
+		if noop {
+			r.LogNoopPlan()
+		}
 	},
 }
 
@@ -110,7 +146,7 @@ func init() {
 		log.Fatal(errors.Wrap(err, "Binding PFlag 'command' to viper var 'full.command' failed: %s"))
 	}
 
-	fullCmd.Flags().BoolP("force", "f", false, "Force all nodes to be recycled, even if they're running the latest launch config")
+	fullCmd.Flags().BoolP("force", "f", false, "Force all nodes to be recycled, even if they're running the latest launch config; needed to roll out an on-demand or spot distribution change, which doesn't make any node old")
 	err = viper.BindPFlag("full.force", fullCmd.Flags().Lookup("force"))
 	if err != nil {
 		log.Fatal(errors.Wrap(err, "Binding PFlag 'force' to viper var 'full.force' failed: %s"))
@@ -0,0 +1,192 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/palantir/bouncer/bouncer"
+	"github.com/palantir/bouncer/instancerefresh"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var instanceRefreshCmd = &cobra.Command{
+	Use:   "instance-refresh",
+	Short: "Run bouncer in instance-refresh",
+	Long:  `Run bouncer in instance-refresh mode, where we start a native ASG instance refresh on each of the ASGs and wait for them to finish, cancelling or rolling them back on timeout.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetLevel(logLevelFromViper())
+
+		log.Debug("instance-refresh called")
+		if log.GetLevel() == log.DebugLevel {
+			cmd.DebugFlags()
+			viper.Debug()
+		}
+
+		asgsString := viper.GetString("instancerefresh.asgs")
+		asgTags := viper.GetStringSlice("asg-tag")
+		asgGlobs := viper.GetStringSlice("asg-glob")
+		if asgsString == "" && len(asgTags) == 0 && len(asgGlobs) == 0 {
+			log.Fatal("You must specify ASGs to refresh (in a comma-delimited list), or select them with --asg-tag or --asg-glob")
+		}
+
+		noop := viper.GetBool("instancerefresh.noop")
+		force := viper.GetBool("instancerefresh.force")
+		rollback := viper.GetBool("instancerefresh.rollback")
+		eventsFile := viper.GetString("events-file")
+		summaryFile := viper.GetString("summary-file")
+		metricsAddr := viper.GetString("metrics-addr")
+		lbHealth := viper.GetBool("lb-health")
+		validateCommand := viper.GetString("validate-new")
+		restoreOnInterrupt := viper.GetBool("restore-on-interrupt")
+		timeout := timeoutFromViper()
+		clientOpts := awsClientOptsFromViper()
+
+		var minHealthy, warmup, checkpointDelay *int32
+		if val := viper.GetInt32("instancerefresh.min-healthy-percentage"); val > 0 {
+			minHealthy = &val
+		}
+		if val := viper.GetInt32("instancerefresh.instance-warmup"); val >= 0 {
+			warmup = &val
+		}
+		if val := viper.GetInt32("instancerefresh.checkpoint-delay"); val >= 0 {
+			checkpointDelay = &val
+		}
+
+		var checkpoints []int32
+		for _, pct := range viper.GetIntSlice("instancerefresh.checkpoint-percentages") {
+			checkpoints = append(checkpoints, int32(pct))
+		}
+
+		log.Debugf("Binding vars, got %+v %+v %+v", asgsString, noop, version)
+
+		log.Info("Beginning bouncer instance-refresh run")
+
+		var defCap int32 = 1
+		opts := bouncer.RunnerOpts{
+			Noop:                  noop,
+			Force:                 force,
+			AsgString:             asgsString,
+			ASGTags:               asgTags,
+			ASGGlobs:              asgGlobs,
+			DefaultCapacity:       &defCap,
+			ItemTimeout:           timeout,
+			ClientOpts:            clientOpts,
+			EventsFile:            eventsFile,
+			SummaryFile:           summaryFile,
+			MetricsAddr:           metricsAddr,
+			LBHealth:              lbHealth,
+			ValidateCommand:       validateCommand,
+			Interrupt:             handleInterrupts(),
+			RestoreOnInterrupt:    restoreOnInterrupt,
+			Webhooks:              webhookOptsFromViper(),
+			SuspendProcesses:      viper.GetStringSlice("suspend-processes"),
+			UnprotectOld:          viper.GetBool("unprotect-old"),
+			ProtectNew:            viper.GetBool("protect-new"),
+			RefreshWarmPool:       viper.GetBool("refresh-warm-pool"),
+			MinHealthyPercentage:  minHealthy,
+			InstanceWarmup:        warmup,
+			CheckpointPercentages: checkpoints,
+			CheckpointDelay:       checkpointDelay,
+			Rollback:              rollback,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		log.RegisterExitHandler(cancel)
+
+		r, err := instancerefresh.NewRunner(ctx, &opts)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "error initializing runner"))
+		}
+		log.RegisterExitHandler(func() {
+			r.Finish(errors.New("bouncer exited on a fatal error"))
+		})
+
+		err = r.ValidatePrereqs(ctx)
+		if err != nil {
+			r.Finish(err)
+			log.Fatal(err)
+		}
+
+		err = r.Run()
+		if err == nil {
+			err = r.RefreshWarmPool()
+		}
+		r.Finish(err)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "error in run"))
+		}
+
+		if noop {
+			r.LogNoopPlan()
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(instanceRefreshCmd)
+
+	instanceRefreshCmd.Flags().BoolP("noop", "n", false, "Run this in noop mode, and only print what you would do")
+	err := viper.BindPFlag("instancerefresh.noop", instanceRefreshCmd.Flags().Lookup("noop"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'noop' to viper var 'instancerefresh.noop' failed: %s"))
+	}
+
+	instanceRefreshCmd.Flags().StringP("asgs", "a", "", "ASGs to refresh")
+	err = viper.BindPFlag("instancerefresh.asgs", instanceRefreshCmd.Flags().Lookup("asgs"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'asgs' to viper var 'instancerefresh.asgs' failed: %s"))
+	}
+
+	instanceRefreshCmd.Flags().BoolP("force", "f", false, "Force all nodes to be recycled, even if they're running the latest launch config (SkipMatching=false)")
+	err = viper.BindPFlag("instancerefresh.force", instanceRefreshCmd.Flags().Lookup("force"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'force' to viper var 'instancerefresh.force' failed: %s"))
+	}
+
+	instanceRefreshCmd.Flags().Int32("min-healthy-percentage", 0, "Percentage of desired capacity to keep healthy while refreshing. Defaults to the ASG's own setting, or 90.")
+	err = viper.BindPFlag("instancerefresh.min-healthy-percentage", instanceRefreshCmd.Flags().Lookup("min-healthy-percentage"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'min-healthy-percentage' to viper var 'instancerefresh.min-healthy-percentage' failed: %s"))
+	}
+
+	instanceRefreshCmd.Flags().Int32("instance-warmup", -1, "Seconds a new instance takes to warm up before it counts as healthy. Defaults to the ASG's own setting.")
+	err = viper.BindPFlag("instancerefresh.instance-warmup", instanceRefreshCmd.Flags().Lookup("instance-warmup"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'instance-warmup' to viper var 'instancerefresh.instance-warmup' failed: %s"))
+	}
+
+	instanceRefreshCmd.Flags().IntSlice("checkpoint-percentages", nil, "Comma-delimited percentages of instances replaced at which the refresh pauses for --checkpoint-delay")
+	err = viper.BindPFlag("instancerefresh.checkpoint-percentages", instanceRefreshCmd.Flags().Lookup("checkpoint-percentages"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'checkpoint-percentages' to viper var 'instancerefresh.checkpoint-percentages' failed: %s"))
+	}
+
+	instanceRefreshCmd.Flags().Int32("checkpoint-delay", -1, "Seconds to pause at each checkpoint. Defaults to an hour.")
+	err = viper.BindPFlag("instancerefresh.checkpoint-delay", instanceRefreshCmd.Flags().Lookup("checkpoint-delay"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'checkpoint-delay' to viper var 'instancerefresh.checkpoint-delay' failed: %s"))
+	}
+
+	instanceRefreshCmd.Flags().Bool("rollback", false, "Roll the refresh back instead of cancelling it if it times out or is aborted")
+	err = viper.BindPFlag("instancerefresh.rollback", instanceRefreshCmd.Flags().Lookup("rollback"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'rollback' to viper var 'instancerefresh.rollback' failed: %s"))
+	}
+}
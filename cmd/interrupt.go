@@ -0,0 +1,47 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// handleInterrupts returns a channel that's closed on the first SIGINT or SIGTERM, for the runner to wind down on.
+// A second signal exits right away, skipping the exit handlers, since they talk to AWS and could take minutes
+func handleInterrupts() <-chan struct{} {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	interrupt := make(chan struct{})
+	go func() {
+		sig := <-signals
+		log.WithFields(log.Fields{
+			"Signal": sig,
+		}).Warn("Received signal, no more instances will be terminated. Send it again to exit right away")
+		close(interrupt)
+
+		sig = <-signals
+		log.WithFields(log.Fields{
+			"Signal": sig,
+		}).Error("Received second signal, exiting")
+		os.Exit(1)
+	}()
+
+	return interrupt
+}
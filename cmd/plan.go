@@ -0,0 +1,200 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/palantir/bouncer/bouncer"
+	"github.com/palantir/bouncer/canary"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// rolloutPlan is the document the plan command emits
+type rolloutPlan struct {
+	Mode   string              `json:"mode"`
+	Phases []bouncer.PlanPhase `json:"phases"`
+}
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Print the rollout plan for a bounce without running it",
+	Long:  `Walk a bounce in the given mode against a projection of the ASGs, and print the phases it would go through as JSON or a table.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetLevel(logLevelFromViper())
+
+		log.Debug("plan called")
+		if log.GetLevel() == log.DebugLevel {
+			cmd.DebugFlags()
+			viper.Debug()
+		}
+
+		mode := viper.GetString("plan.mode")
+		asgsString := viper.GetString("plan.asgs")
+		asgTags := viper.GetStringSlice("asg-tag")
+		asgGlobs := viper.GetStringSlice("asg-glob")
+		if asgsString == "" && len(asgTags) == 0 && len(asgGlobs) == 0 {
+			log.Fatal("You must specify ASGs to plan a bounce for (in a comma-delimited list), or select them with --asg-tag or --asg-glob")
+		}
+
+		commandString := viper.GetString("plan.command")
+		force := viper.GetBool("plan.force")
+		fast := viper.GetBool("plan.fast")
+		batchSize, batchPercent, err := bouncer.ParseBatchSize(viper.GetString("plan.batchsize"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		output := viper.GetString("plan.output")
+		termHook := viper.GetString("terminate-hook")
+		pendHook := viper.GetString("pending-hook")
+		timeout := timeoutFromViper()
+		clientOpts := awsClientOptsFromViper()
+
+		if output != "json" && output != "table" {
+			log.Fatalf("Output must be one of json or table, got %s", output)
+		}
+
+		log.Debugf("Binding vars, got %+v %+v %+v %+v", mode, asgsString, version, commandString)
+
+		opts := bouncer.RunnerOpts{
+			Noop:          true,
+			Force:         force,
+			Fast:          fast,
+			BatchSize:     &batchSize,
+			BatchPercent:  batchPercent,
+			AsgString:     asgsString,
+			ASGTags:       asgTags,
+			ASGGlobs:      asgGlobs,
+			CommandString: commandString,
+			TerminateHook: termHook,
+			PendingHook:   pendHook,
+			ItemTimeout:   timeout,
+			ClientOpts:    clientOpts,
+
+			UnprotectOld:    viper.GetBool("unprotect-old"),
+			RefreshWarmPool: viper.GetBool("refresh-warm-pool"),
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		log.RegisterExitHandler(cancel)
+
+		r, err := newModeRunner(ctx, mode, &opts)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "error initializing runner"))
+		}
+
+		err = r.ValidatePrereqs(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = r.Run()
+		if err == nil {
+			err = r.RefreshWarmPool()
+		}
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "error in run"))
+		}
+
+		plan := rolloutPlan{
+			Mode:   mode,
+			Phases: r.Plan(),
+		}
+
+		if output == "table" {
+			err = writePlanTable(os.Stdout, &plan)
+		} else {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(&plan)
+		}
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "error writing plan"))
+		}
+	},
+}
+
+func writePlanTable(w io.Writer, plan *rolloutPlan) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "PHASE\tASG\tDESIRED\tTERMINATE\tSTANDBY\tDECREMENT\tPEAK IN SERVICE\tMIN IN SERVICE\n")
+	for _, phase := range plan.Phases {
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%s\t%t\t%d\t%d\n", phase.Phase, phase.ASG, phase.DesiredCapacity, planList(phase.Terminate), planList(phase.Standby), phase.Decrement, phase.PeakInService, phase.MinInService)
+	}
+	return tw.Flush()
+}
+
+// planList joins instance IDs for a table cell, or returns "-" if there are none
+func planList(ids []string) string {
+	if len(ids) == 0 {
+		return "-"
+	}
+	return strings.Join(ids, ",")
+}
+
+func init() {
+	RootCmd.AddCommand(planCmd)
+
+	planCmd.Flags().StringP("mode", "m", canary.Mode, "Mode to plan the bounce in, one of "+modeList())
+	err := viper.BindPFlag("plan.mode", planCmd.Flags().Lookup("mode"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'mode' to viper var 'plan.mode' failed: %s"))
+	}
+
+	planCmd.Flags().StringP("asgs", "a", "", "ASGs to plan a bounce for, in the same format as the chosen mode")
+	err = viper.BindPFlag("plan.asgs", planCmd.Flags().Lookup("asgs"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'asgs' to viper var 'plan.asgs' failed: %s"))
+	}
+
+	planCmd.Flags().StringP("batchsize", "b", "0", "Batch size for batch-canary, batch-serial and standby modes, as a number of nodes or a percentage of desired capacity like 25%")
+	err = viper.BindPFlag("plan.batchsize", planCmd.Flags().Lookup("batchsize"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'batchsize' to viper var 'plan.batchsize' failed: %s"))
+	}
+
+	planCmd.Flags().StringP("preterminatecall", "p", "", "External command that would be run before host is removed from its ELB & terminate process begins")
+	err = viper.BindPFlag("plan.command", planCmd.Flags().Lookup("preterminatecall"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'command' to viper var 'plan.command' failed: %s"))
+	}
+
+	planCmd.Flags().BoolP("force", "f", false, "Plan for all nodes to be recycled, even if they're running the latest launch config; needed to roll out an on-demand or spot distribution change, which doesn't make any node old")
+	err = viper.BindPFlag("plan.force", planCmd.Flags().Lookup("force"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'force' to viper var 'plan.force' failed: %s"))
+	}
+
+	planCmd.Flags().BoolP("fast", "", false, "In full mode, plan for all nodes to be brought down simultaneously")
+	err = viper.BindPFlag("plan.fast", planCmd.Flags().Lookup("fast"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'fast' to viper var 'plan.fast' failed: %s"))
+	}
+
+	planCmd.Flags().StringP("output", "o", "json", "Output format, one of json or table")
+	err = viper.BindPFlag("plan.output", planCmd.Flags().Lookup("output"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'output' to viper var 'plan.output' failed: %s"))
+	}
+}
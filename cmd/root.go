@@ -20,6 +20,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/palantir/bouncer/aws"
+	"github.com/palantir/bouncer/bouncer"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -47,7 +49,10 @@ var RootCmd = &cobra.Command{
 		switch cmdName := cmd.Name(); cmdName {
 		case "serial":
 			log.SetFormatter(&log.TextFormatter{})
-			log.SetOutput(os.Stdout)
+			// Keep stdout clean for machine-readable output if that's where it's been sent
+			if viper.GetString("events-file") != bouncer.StdoutFile && viper.GetString("summary-file") != bouncer.StdoutFile {
+				log.SetOutput(os.Stdout)
+			}
 		}
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -67,8 +72,14 @@ func Execute() {
 func init() {
 	cobra.OnInitialize(initConfig)
 
+	RootCmd.PersistentFlags().StringP("config", "c", "", "YAML or JSON file to read settings and the run spec for the run command from")
+	err := viper.BindPFlag("config", RootCmd.PersistentFlags().Lookup("config"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Error binding config flag"))
+	}
+
 	RootCmd.PersistentFlags().BoolP("verbose", "v", false, "Enable Verbose debugging output")
-	err := viper.BindPFlag("verbose", RootCmd.PersistentFlags().Lookup("verbose"))
+	err = viper.BindPFlag("verbose", RootCmd.PersistentFlags().Lookup("verbose"))
 	if err != nil {
 		log.Fatal(errors.Wrap(err, "Error binding verbose flag"))
 	}
@@ -93,6 +104,139 @@ func init() {
 		log.Fatal(errors.Wrap(err, "Error binding pending-hook flag"))
 	}
 
+	RootCmd.PersistentFlags().String("validate-new", "", "External command to run against each new instance once it's healthy, with its instance ID, private IP and ASG name appended unless it uses template variables. The instance only counts as healthy once this exits 0, and a failure stops the run")
+	err = viper.BindPFlag("validate-new", RootCmd.PersistentFlags().Lookup("validate-new"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Error binding validate-new flag"))
+	}
+
+	RootCmd.PersistentFlags().String("events-file", "", "File to write progress events to as newline-delimited JSON, or - for stdout")
+	err = viper.BindPFlag("events-file", RootCmd.PersistentFlags().Lookup("events-file"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Error binding events-file flag"))
+	}
+
+	RootCmd.PersistentFlags().String("summary-file", "", "File to write a JSON summary of the run to when it exits, or - for stdout")
+	err = viper.BindPFlag("summary-file", RootCmd.PersistentFlags().Lookup("summary-file"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Error binding summary-file flag"))
+	}
+
+	RootCmd.PersistentFlags().String("metrics-addr", "", "Address to serve Prometheus metrics on at /metrics while the run is going, e.g. :9090")
+	err = viper.BindPFlag("metrics-addr", RootCmd.PersistentFlags().Lookup("metrics-addr"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Error binding metrics-addr flag"))
+	}
+
+	RootCmd.PersistentFlags().Bool("lb-health", false, "Only count instances as healthy once they're healthy in every target group and classic ELB attached to their ASG, and wait for targets to finish draining")
+	err = viper.BindPFlag("lb-health", RootCmd.PersistentFlags().Lookup("lb-health"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Error binding lb-health flag"))
+	}
+
+	RootCmd.PersistentFlags().Bool("restore-on-interrupt", false, "On SIGINT or SIGTERM, restore each ASG's starting desired capacity rather than waiting for changes in flight to finish")
+	err = viper.BindPFlag("restore-on-interrupt", RootCmd.PersistentFlags().Lookup("restore-on-interrupt"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Error binding restore-on-interrupt flag"))
+	}
+
+	RootCmd.PersistentFlags().StringSlice("suspend-processes", nil, "Scaling processes to suspend on each ASG before changing anything, and resume when the run is over. Given on its own, suspends the defaults shown; to pick others, use --suspend-processes=A,B")
+	RootCmd.PersistentFlags().Lookup("suspend-processes").NoOptDefVal = strings.Join(bouncer.DefaultSuspendProcesses, ",")
+	err = viper.BindPFlag("suspend-processes", RootCmd.PersistentFlags().Lookup("suspend-processes"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Error binding suspend-processes flag"))
+	}
+
+	RootCmd.PersistentFlags().Bool("unprotect-old", false, "Remove scale-in protection from each old instance right before terminating it")
+	err = viper.BindPFlag("unprotect-old", RootCmd.PersistentFlags().Lookup("unprotect-old"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Error binding unprotect-old flag"))
+	}
+
+	RootCmd.PersistentFlags().Bool("protect-new", false, "Protect new instances from scale-in once they're healthy, and remove that protection when the run is over")
+	err = viper.BindPFlag("protect-new", RootCmd.PersistentFlags().Lookup("protect-new"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Error binding protect-new flag"))
+	}
+
+	RootCmd.PersistentFlags().Bool("refresh-warm-pool", false, "Once the rollout is done, terminate the old instances left in each ASG's warm pool so AWS refills it from the current launch template")
+	err = viper.BindPFlag("refresh-warm-pool", RootCmd.PersistentFlags().Lookup("refresh-warm-pool"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Error binding refresh-warm-pool flag"))
+	}
+
+	RootCmd.PersistentFlags().String("pre-terminate-webhook", "", "URL to POST a JSON description of each instance to right before it is terminated. A non-2xx response stops the run")
+	err = viper.BindPFlag("pre-terminate-webhook", RootCmd.PersistentFlags().Lookup("pre-terminate-webhook"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Error binding pre-terminate-webhook flag"))
+	}
+
+	RootCmd.PersistentFlags().String("post-new-healthy-webhook", "", "URL to POST a JSON description of each new instance to once it is healthy. A non-2xx response stops the run")
+	err = viper.BindPFlag("post-new-healthy-webhook", RootCmd.PersistentFlags().Lookup("post-new-healthy-webhook"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Error binding post-new-healthy-webhook flag"))
+	}
+
+	RootCmd.PersistentFlags().String("run-finished-webhook", "", "URL to POST the outcome of the run to once it finishes")
+	err = viper.BindPFlag("run-finished-webhook", RootCmd.PersistentFlags().Lookup("run-finished-webhook"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Error binding run-finished-webhook flag"))
+	}
+
+	RootCmd.PersistentFlags().Int("webhook-retries", 3, "How many more times to try a webhook after its first attempt fails")
+	err = viper.BindPFlag("webhook-retries", RootCmd.PersistentFlags().Lookup("webhook-retries"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Error binding webhook-retries flag"))
+	}
+
+	RootCmd.PersistentFlags().Duration("webhook-timeout", 30*time.Second, "Timeout for each attempt at a webhook")
+	err = viper.BindPFlag("webhook-timeout", RootCmd.PersistentFlags().Lookup("webhook-timeout"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Error binding webhook-timeout flag"))
+	}
+
+	RootCmd.PersistentFlags().StringArray("asg-tag", nil, "Bounce every ASG with this tag, given as key=value, can be repeated to require several tags")
+	err = viper.BindPFlag("asg-tag", RootCmd.PersistentFlags().Lookup("asg-tag"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Error binding asg-tag flag"))
+	}
+
+	RootCmd.PersistentFlags().StringArray("asg-glob", nil, "Bounce every ASG whose name matches this glob, can be repeated to match any of several")
+	err = viper.BindPFlag("asg-glob", RootCmd.PersistentFlags().Lookup("asg-glob"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Error binding asg-glob flag"))
+	}
+
+	RootCmd.PersistentFlags().String("region", "", "AWS region the ASGs are in, defaults to AWS_DEFAULT_REGION or us-east-1")
+	err = viper.BindPFlag("region", RootCmd.PersistentFlags().Lookup("region"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Error binding region flag"))
+	}
+
+	RootCmd.PersistentFlags().String("profile", "", "AWS shared config profile to get credentials from")
+	err = viper.BindPFlag("profile", RootCmd.PersistentFlags().Lookup("profile"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Error binding profile flag"))
+	}
+
+	RootCmd.PersistentFlags().String("assume-role-arn", "", "ARN of an IAM role to assume before talking to AWS, e.g. to bounce ASGs in another account")
+	err = viper.BindPFlag("assume-role-arn", RootCmd.PersistentFlags().Lookup("assume-role-arn"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Error binding assume-role-arn flag"))
+	}
+
+	RootCmd.PersistentFlags().String("external-id", "", "External ID to pass when assuming --assume-role-arn")
+	err = viper.BindPFlag("external-id", RootCmd.PersistentFlags().Lookup("external-id"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Error binding external-id flag"))
+	}
+
+	RootCmd.PersistentFlags().String("role-session-name", "bouncer", "Session name to use when assuming --assume-role-arn")
+	err = viper.BindPFlag("role-session-name", RootCmd.PersistentFlags().Lookup("role-session-name"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Error binding role-session-name flag"))
+	}
+
 	// Check for special killswitch
 	val := os.Getenv(killswitchVar)
 	if val != "" {
@@ -103,12 +247,47 @@ func init() {
 
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
+	configFile := viper.GetString("config")
+	if configFile == "" {
+		return
+	}
+
+	// The file type is taken from the extension
+	viper.SetConfigFile(configFile)
+	err := viper.ReadInConfig()
+	if err != nil {
+		log.Fatal(errors.Wrapf(err, "error reading config file %s", configFile))
+	}
+
+	log.WithFields(log.Fields{
+		"ConfigFile": viper.ConfigFileUsed(),
+	}).Debug("Read config file")
 }
 
 func timeoutFromViper() time.Duration {
 	return time.Duration(viper.GetInt("timeout")) * time.Minute
 }
 
+func awsClientOptsFromViper() aws.ClientOpts {
+	return aws.ClientOpts{
+		Region:          viper.GetString("region"),
+		Profile:         viper.GetString("profile"),
+		AssumeRoleARN:   viper.GetString("assume-role-arn"),
+		ExternalID:      viper.GetString("external-id"),
+		RoleSessionName: viper.GetString("role-session-name"),
+	}
+}
+
+func webhookOptsFromViper() bouncer.WebhookOpts {
+	return bouncer.WebhookOpts{
+		PreTerminate: viper.GetString("pre-terminate-webhook"),
+		NewHealthy:   viper.GetString("post-new-healthy-webhook"),
+		RunFinished:  viper.GetString("run-finished-webhook"),
+		Retries:      viper.GetInt("webhook-retries"),
+		Timeout:      viper.GetDuration("webhook-timeout"),
+	}
+}
+
 func logLevelFromViper() log.Level {
 	if viper.GetBool("verbose") {
 		return log.DebugLevel
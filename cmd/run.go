@@ -0,0 +1,327 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/palantir/bouncer/aws"
+	"github.com/palantir/bouncer/bouncer"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// asgSpec is how one ASG is declared in the run spec of the config file
+type asgSpec struct {
+	Name            string `mapstructure:"name"`
+	Mode            string `mapstructure:"mode"`
+	DesiredCapacity *int32 `mapstructure:"desired-capacity"`
+	// BatchSize is a number of instances, or a percentage of desired capacity like 25%
+	BatchSize     string `mapstructure:"batch-size"`
+	batchSize     int32
+	batchPercent  *int32
+	TerminateHook string `mapstructure:"terminate-hook"`
+	PendingHook   string `mapstructure:"pending-hook"`
+	// PreTerminateCommand is an explicit argv, only filled in from its template variables, not split or unquoted
+	PreTerminateCommand []string `mapstructure:"pre-terminate-command"`
+	// Timeout is a duration like 45m, or a bare number of minutes like the global timeout
+	Timeout string `mapstructure:"timeout"`
+	timeout time.Duration
+	Force   bool `mapstructure:"force"`
+	Fast    bool `mapstructure:"fast"`
+	// LBHealth gates health on the ASG's load balancers, and is also turned on by --lb-health
+	LBHealth bool `mapstructure:"lb-health"`
+	// ValidateNew is parsed like --validate-new
+	ValidateNew string `mapstructure:"validate-new"`
+	// MinHealthyPercentage and Rollback only apply to instance-refresh mode
+	MinHealthyPercentage *int32 `mapstructure:"min-healthy-percentage"`
+	Rollback             bool   `mapstructure:"rollback"`
+	// AutoRollback and MaxFailedReplacements only apply to the canary modes
+	AutoRollback          bool   `mapstructure:"auto-rollback"`
+	MaxFailedReplacements *int32 `mapstructure:"max-failed-replacements"`
+	// BakeTime only applies to standby mode
+	BakeTime time.Duration `mapstructure:"bake-time"`
+	// Region, Profile, AssumeRoleARN and ExternalID pick the account and region the ASG is in
+	Region        string `mapstructure:"region"`
+	Profile       string `mapstructure:"profile"`
+	AssumeRoleARN string `mapstructure:"assume-role-arn"`
+	ExternalID    string `mapstructure:"external-id"`
+}
+
+// asgSpecsFromViper reads the run spec from the config file, filling in anything left unset from the global flags
+func asgSpecsFromViper() ([]asgSpec, error) {
+	var specs []asgSpec
+	err := viper.UnmarshalKey("asgs", &specs)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing asgs from config")
+	}
+
+	if len(specs) == 0 {
+		return nil, errors.New("config must declare at least one ASG under asgs")
+	}
+
+	for i := range specs {
+		spec := &specs[i]
+
+		if spec.Name == "" {
+			return nil, errors.Errorf("ASG %d in config has no name", i+1)
+		}
+
+		if spec.Mode == "" {
+			return nil, errors.Errorf("ASG %s in config has no mode", spec.Name)
+		}
+
+		if spec.DesiredCapacity == nil {
+			spec.DesiredCapacity = modeDefaultCapacity(spec.Mode)
+			if spec.DesiredCapacity == nil {
+				return nil, errors.Errorf("ASG %s in config needs a desired-capacity in %s mode", spec.Name, spec.Mode)
+			}
+		}
+
+		spec.batchSize, spec.batchPercent, err = bouncer.ParseBatchSize(spec.BatchSize)
+		if err != nil {
+			return nil, errors.Wrapf(err, "ASG %s in config has a bad batch-size", spec.Name)
+		}
+
+		if spec.AutoRollback && !supportsAutoRollback(spec.Mode) {
+			return nil, errors.Errorf("ASG %s in config sets auto-rollback, which isn't supported in %s mode", spec.Name, spec.Mode)
+		}
+
+		if spec.MaxFailedReplacements == nil {
+			var maxFailed int32 = 3
+			spec.MaxFailedReplacements = &maxFailed
+		}
+
+		if spec.TerminateHook == "" {
+			spec.TerminateHook = viper.GetString("terminate-hook")
+		}
+
+		if spec.PendingHook == "" {
+			spec.PendingHook = viper.GetString("pending-hook")
+		}
+
+		if spec.ValidateNew == "" {
+			spec.ValidateNew = viper.GetString("validate-new")
+		}
+
+		spec.timeout, err = parseTimeout(spec.Timeout)
+		if err != nil {
+			return nil, errors.Wrapf(err, "ASG %s in config has a bad timeout", spec.Name)
+		}
+		if spec.timeout == 0 {
+			spec.timeout = timeoutFromViper()
+		}
+
+		if spec.Region == "" {
+			spec.Region = viper.GetString("region")
+		}
+
+		if spec.Profile == "" {
+			spec.Profile = viper.GetString("profile")
+		}
+
+		if spec.AssumeRoleARN == "" {
+			spec.AssumeRoleARN = viper.GetString("assume-role-arn")
+			spec.ExternalID = viper.GetString("external-id")
+		}
+	}
+
+	return specs, nil
+}
+
+// parseTimeout reads a per-ASG timeout, which is a duration like 45m, or a bare number of minutes like the global
+// timeout.  An empty string gives 0, meaning the global timeout
+func parseTimeout(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	var timeout time.Duration
+	if minutes, err := strconv.Atoi(s); err == nil {
+		timeout = time.Duration(minutes) * time.Minute
+	} else {
+		timeout, err = time.ParseDuration(s)
+		if err != nil {
+			return 0, errors.Errorf("%s is neither a duration like 45m nor a number of minutes", s)
+		}
+	}
+
+	if timeout < time.Second {
+		return 0, errors.Errorf("%s is shorter than a second", s)
+	}
+
+	return timeout, nil
+}
+
+func (spec *asgSpec) runnerOpts() *bouncer.RunnerOpts {
+	return &bouncer.RunnerOpts{
+		Force:                 spec.Force,
+		Fast:                  spec.Fast,
+		BatchSize:             &spec.batchSize,
+		BatchPercent:          spec.batchPercent,
+		LBHealth:              spec.LBHealth || viper.GetBool("lb-health"),
+		MinHealthyPercentage:  spec.MinHealthyPercentage,
+		Rollback:              spec.Rollback,
+		AutoRollback:          spec.AutoRollback,
+		MaxFailedReplacements: int(*spec.MaxFailedReplacements),
+		BakeTime:              spec.BakeTime,
+		ValidateCommand:       spec.ValidateNew,
+		ASGs: []*bouncer.DesiredASG{
+			{
+				AsgName:         spec.Name,
+				DesiredCapacity: *spec.DesiredCapacity,
+				PreTerminateCmd: spec.PreTerminateCommand,
+			},
+		},
+		TerminateHook: spec.TerminateHook,
+		PendingHook:   spec.PendingHook,
+		ItemTimeout:   spec.timeout,
+		ClientOpts: aws.ClientOpts{
+			Region:          spec.Region,
+			Profile:         spec.Profile,
+			AssumeRoleARN:   spec.AssumeRoleARN,
+			ExternalID:      spec.ExternalID,
+			RoleSessionName: viper.GetString("role-session-name"),
+		},
+	}
+}
+
+// clientsCache holds one set of clients per account and region, so ASGs that share them share clients
+type clientsCache map[aws.ClientOpts]*aws.Clients
+
+func (c clientsCache) get(ctx context.Context, opts aws.ClientOpts) (*aws.Clients, error) {
+	if clients, ok := c[opts]; ok {
+		return clients, nil
+	}
+
+	clients, err := aws.GetAWSClients(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	c[opts] = clients
+	return clients, nil
+}
+
+var runCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Bounce every ASG declared in the config file",
+	Long:  `Bounce the ASGs declared under asgs in the --config file, one after another in the order given, each in its own mode.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetLevel(logLevelFromViper())
+
+		log.Debug("run called")
+		if log.GetLevel() == log.DebugLevel {
+			cmd.DebugFlags()
+			viper.Debug()
+		}
+
+		if viper.ConfigFileUsed() == "" {
+			log.Fatal("You must specify a config file declaring the ASGs to bounce")
+		}
+
+		specs, err := asgSpecsFromViper()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		noop := viper.GetBool("run.noop")
+		eventsFile := viper.GetString("events-file")
+		metricsAddr := viper.GetString("metrics-addr")
+
+		if viper.GetString("summary-file") != "" {
+			log.Warn("--summary-file isn't supported by run, since each ASG would overwrite the last one's summary")
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		log.RegisterExitHandler(cancel)
+
+		// Once interrupted, the ASG being bounced winds down and the rest are never started
+		interrupt := handleInterrupts()
+		clients := make(clientsCache)
+		for _, spec := range specs {
+			log.WithFields(log.Fields{
+				"ASG":  spec.Name,
+				"Mode": spec.Mode,
+			}).Info("Beginning bouncer run")
+
+			opts := spec.runnerOpts()
+			opts.Noop = noop
+			opts.EventsFile = eventsFile
+			opts.MetricsAddr = metricsAddr
+			opts.Interrupt = interrupt
+			opts.RestoreOnInterrupt = viper.GetBool("restore-on-interrupt")
+			opts.Webhooks = webhookOptsFromViper()
+			opts.SuspendProcesses = viper.GetStringSlice("suspend-processes")
+			opts.UnprotectOld = viper.GetBool("unprotect-old")
+			opts.ProtectNew = viper.GetBool("protect-new")
+			opts.RefreshWarmPool = viper.GetBool("refresh-warm-pool")
+
+			opts.Clients, err = clients.get(ctx, opts.ClientOpts)
+			if err != nil {
+				log.Fatal(errors.Wrapf(err, "error getting AWS clients for %s", spec.Name))
+			}
+
+			r, err := newModeRunner(ctx, spec.Mode, opts)
+			if err != nil {
+				log.Fatal(errors.Wrapf(err, "error initializing runner for %s", spec.Name))
+			}
+			log.RegisterExitHandler(func() {
+				r.Finish(errors.New("bouncer exited on a fatal error"))
+			})
+
+			err = r.ValidatePrereqs(ctx)
+			if err != nil {
+				r.Finish(err)
+				log.Fatal(err)
+			}
+
+			err = r.Run()
+			if err == nil {
+				err = r.RefreshWarmPool()
+			}
+			r.Finish(err)
+			if bouncer.IsRollback(err) {
+				log.WithFields(log.Fields{
+					"ASG": spec.Name,
+				}).Error(err)
+				os.Exit(bouncer.RollbackExitCode)
+			}
+			if err != nil {
+				log.Fatal(errors.Wrapf(err, "error in run for %s", spec.Name))
+			}
+
+			if noop {
+				r.LogNoopPlan()
+			}
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(runCmd)
+
+	runCmd.Flags().BoolP("noop", "n", false, "Run this in noop mode, and only print what you would do")
+	err := viper.BindPFlag("run.noop", runCmd.Flags().Lookup("noop"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'noop' to viper var 'run.noop' failed: %s"))
+	}
+}
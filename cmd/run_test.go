@@ -0,0 +1,153 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/palantir/bouncer/aws"
+	"github.com/palantir/bouncer/bouncer"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `
+timeout: 30
+asgs:
+  - name: vault-server
+    mode: canary
+    desired-capacity: 3
+    terminate-hook: vault-terminate
+    pre-terminate-command: ["vault", "operator", "step-down", "-address=https://a,b"]
+    timeout: 45m
+  - name: nomad-worker
+    mode: serial
+    region: eu-west-1
+    assume-role-arn: arn:aws:iam::123456789012:role/bouncer
+    external-id: abc
+    batch-size: 25%
+`
+
+func readTestConfig(t *testing.T, config string) {
+	viper.SetConfigType("yaml")
+	require.NoError(t, viper.ReadConfig(strings.NewReader(config)))
+	t.Cleanup(func() {
+		require.NoError(t, viper.ReadConfig(strings.NewReader("")))
+	})
+}
+
+func TestASGSpecsFromViper(t *testing.T) {
+	readTestConfig(t, testConfig)
+
+	specs, err := asgSpecsFromViper()
+	require.NoError(t, err)
+	require.Len(t, specs, 2)
+
+	vault := specs[0]
+	assert.Equal(t, "vault-server", vault.Name)
+	assert.Equal(t, "canary", vault.Mode)
+	assert.Equal(t, int32(3), *vault.DesiredCapacity)
+	assert.Equal(t, int32(0), *vault.runnerOpts().BatchSize)
+	assert.Nil(t, vault.runnerOpts().BatchPercent)
+	assert.Equal(t, "vault-terminate", vault.TerminateHook)
+	assert.Equal(t, "pending-hook", vault.PendingHook)
+	assert.Equal(t, []string{"vault", "operator", "step-down", "-address=https://a,b"}, vault.PreTerminateCommand)
+	assert.Equal(t, 45*time.Minute, vault.timeout)
+
+	opts := vault.runnerOpts()
+	require.Len(t, opts.ASGs, 1)
+	assert.Equal(t, vault.PreTerminateCommand, opts.ASGs[0].PreTerminateCmd)
+
+	nomad := specs[1]
+	assert.Equal(t, int32(1), *nomad.DesiredCapacity)
+	assert.Equal(t, "terminate-hook", nomad.TerminateHook)
+	assert.Equal(t, 30*time.Minute, nomad.timeout)
+	assert.Equal(t, "eu-west-1", nomad.Region)
+	assert.Equal(t, "arn:aws:iam::123456789012:role/bouncer", nomad.AssumeRoleARN)
+	assert.Equal(t, "abc", nomad.ExternalID)
+	assert.Equal(t, "bouncer", nomad.runnerOpts().ClientOpts.RoleSessionName)
+	assert.Equal(t, int32(25), *nomad.runnerOpts().BatchPercent)
+}
+
+func TestClientsCache(t *testing.T) {
+	ctx := context.Background()
+	cache := make(clientsCache)
+
+	a, err := cache.get(ctx, aws.ClientOpts{Region: "us-east-1"})
+	require.NoError(t, err)
+	b, err := cache.get(ctx, aws.ClientOpts{Region: "us-east-1"})
+	require.NoError(t, err)
+	c, err := cache.get(ctx, aws.ClientOpts{Region: "eu-west-1"})
+	require.NoError(t, err)
+	d, err := cache.get(ctx, aws.ClientOpts{Region: "us-east-1", AssumeRoleARN: "arn:aws:iam::123456789012:role/bouncer"})
+	require.NoError(t, err)
+
+	assert.Same(t, a, b)
+	assert.NotSame(t, a, c)
+	assert.NotSame(t, a, d)
+	assert.Len(t, cache, 3)
+}
+
+func TestASGSpecsFromViperMissingCapacity(t *testing.T) {
+	readTestConfig(t, `
+asgs:
+  - name: vault-server
+    mode: canary
+`)
+
+	_, err := asgSpecsFromViper()
+	assert.Error(t, err)
+}
+
+func TestASGSpecsFromViperTimeout(t *testing.T) {
+	readTestConfig(t, `
+asgs:
+  - name: vault-server
+    mode: serial
+    timeout: 20
+`)
+
+	specs, err := asgSpecsFromViper()
+	require.NoError(t, err)
+	require.Len(t, specs, 1)
+	assert.Equal(t, 20*time.Minute, specs[0].timeout)
+
+	for _, timeout := range []string{"20ns", "0", "soon"} {
+		readTestConfig(t, `
+asgs:
+  - name: vault-server
+    mode: serial
+    timeout: `+timeout+`
+`)
+
+		_, err := asgSpecsFromViper()
+		assert.Error(t, err, timeout)
+	}
+}
+
+func TestModeList(t *testing.T) {
+	list := modeList()
+	for _, m := range modeRunners {
+		assert.Contains(t, list, m.mode)
+	}
+	assert.True(t, strings.HasSuffix(list, ", or full"), list)
+
+	_, err := newModeRunner(context.Background(), "bogus", &bouncer.RunnerOpts{})
+	assert.EqualError(t, err, `unknown mode "bogus"`)
+}
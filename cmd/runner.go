@@ -0,0 +1,122 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"strings"
+
+	"github.com/palantir/bouncer/batchcanary"
+	"github.com/palantir/bouncer/batchserial"
+	"github.com/palantir/bouncer/bouncer"
+	"github.com/palantir/bouncer/canary"
+	"github.com/palantir/bouncer/full"
+	"github.com/palantir/bouncer/instancerefresh"
+	"github.com/palantir/bouncer/rolling"
+	"github.com/palantir/bouncer/serial"
+	"github.com/palantir/bouncer/slowcanary"
+	"github.com/palantir/bouncer/standby"
+	"github.com/pkg/errors"
+)
+
+// modeRunner is satisfied by every runner, through the methods they get from bouncer.BaseRunner
+type modeRunner interface {
+	ValidatePrereqs(ctx context.Context) error
+	Run() error
+	RefreshWarmPool() error
+	Plan() []bouncer.PlanPhase
+	Finish(runErr error)
+	LogNoopPlan()
+}
+
+// modeDefaultCapacity is the desired capacity assumed for ASGs given without one, nil for modes that require it
+func modeDefaultCapacity(mode string) *int32 {
+	var defCap int32 = 1
+
+	switch mode {
+	case serial.Mode, rolling.Mode, full.Mode, batchserial.Mode, instancerefresh.Mode:
+		return &defCap
+	default:
+		return nil
+	}
+}
+
+// supportsAutoRollback returns whether the mode can roll back its new instances when the canary fails.  Standby
+// mode always does
+func supportsAutoRollback(mode string) bool {
+	switch mode {
+	case canary.Mode, slowcanary.Mode, batchcanary.Mode, standby.Mode:
+		return true
+	default:
+		return false
+	}
+}
+
+// modeRunners builds the runner for each mode, in the order they're listed in help text
+var modeRunners = []struct {
+	mode      string
+	newRunner func(ctx context.Context, opts *bouncer.RunnerOpts) (modeRunner, error)
+}{
+	{serial.Mode, func(ctx context.Context, opts *bouncer.RunnerOpts) (modeRunner, error) {
+		return serial.NewRunner(ctx, opts)
+	}},
+	{rolling.Mode, func(ctx context.Context, opts *bouncer.RunnerOpts) (modeRunner, error) {
+		return rolling.NewRunner(ctx, opts)
+	}},
+	{canary.Mode, func(ctx context.Context, opts *bouncer.RunnerOpts) (modeRunner, error) {
+		return canary.NewRunner(ctx, opts)
+	}},
+	{slowcanary.Mode, func(ctx context.Context, opts *bouncer.RunnerOpts) (modeRunner, error) {
+		return slowcanary.NewRunner(ctx, opts)
+	}},
+	{batchcanary.Mode, func(ctx context.Context, opts *bouncer.RunnerOpts) (modeRunner, error) {
+		return batchcanary.NewRunner(ctx, opts)
+	}},
+	{batchserial.Mode, func(ctx context.Context, opts *bouncer.RunnerOpts) (modeRunner, error) {
+		return batchserial.NewRunner(ctx, opts)
+	}},
+	{standby.Mode, func(ctx context.Context, opts *bouncer.RunnerOpts) (modeRunner, error) {
+		return standby.NewRunner(ctx, opts)
+	}},
+	{instancerefresh.Mode, func(ctx context.Context, opts *bouncer.RunnerOpts) (modeRunner, error) {
+		return instancerefresh.NewRunner(ctx, opts)
+	}},
+	{full.Mode, func(ctx context.Context, opts *bouncer.RunnerOpts) (modeRunner, error) {
+		return full.NewRunner(ctx, opts)
+	}},
+}
+
+// modeList lists every mode newModeRunner accepts, like "serial, rolling, or full"
+func modeList() string {
+	modes := make([]string, len(modeRunners))
+	for i, m := range modeRunners {
+		modes[i] = m.mode
+	}
+	return strings.Join(modes[:len(modes)-1], ", ") + ", or " + modes[len(modes)-1]
+}
+
+// newModeRunner builds the runner for the given mode
+func newModeRunner(ctx context.Context, mode string, opts *bouncer.RunnerOpts) (modeRunner, error) {
+	if opts.DefaultCapacity == nil {
+		opts.DefaultCapacity = modeDefaultCapacity(mode)
+	}
+
+	for _, m := range modeRunners {
+		if m.mode == mode {
+			return m.newRunner(ctx, opts)
+		}
+	}
+	return nil, errors.Errorf("unknown mode %q", mode)
+}
@@ -16,6 +16,7 @@ package cmd
 
 import (
 	"context"
+	"os"
 
 	"github.com/palantir/bouncer/bouncer"
 	"github.com/palantir/bouncer/slowcanary"
@@ -39,30 +40,62 @@ var slowCanaryCmd = &cobra.Command{
 		}
 
 		asgString := viper.GetString("slow-canary.asg")
-		if asgString == "" {
-			log.Fatal("You must specify ASG to cycle nodes from")
+		asgTags := viper.GetStringSlice("asg-tag")
+		asgGlobs := viper.GetStringSlice("asg-glob")
+		if asgString == "" && len(asgTags) == 0 && len(asgGlobs) == 0 {
+			log.Fatal("You must specify ASG to cycle nodes from, or select them with --asg-tag or --asg-glob")
 		}
 
 		commandString := viper.GetString("slow-canary.command")
 		noop := viper.GetBool("slow-canary.noop")
 		force := viper.GetBool("slow-canary.force")
+		checkpointFile := viper.GetString("slow-canary.checkpoint-file")
+		resume := viper.GetBool("slow-canary.resume")
 		termHook := viper.GetString("terminate-hook")
 		pendHook := viper.GetString("pending-hook")
+		eventsFile := viper.GetString("events-file")
+		summaryFile := viper.GetString("summary-file")
+		metricsAddr := viper.GetString("metrics-addr")
+		lbHealth := viper.GetBool("lb-health")
+		autoRollback := viper.GetBool("slow-canary.auto-rollback")
+		maxFailed := viper.GetInt("slow-canary.max-failed-replacements")
+		validateCommand := viper.GetString("validate-new")
+		restoreOnInterrupt := viper.GetBool("restore-on-interrupt")
 		timeout := timeoutFromViper()
+		clientOpts := awsClientOptsFromViper()
 
 		log.Debugf("Binding vars, got %+v %+v %+v %+v", asgString, noop, version, commandString)
 
 		log.Info("Beginning bouncer slow-canary run")
 
 		opts := bouncer.RunnerOpts{
-			Noop:            noop,
-			Force:           force,
-			AsgString:       asgString,
-			CommandString:   commandString,
-			DefaultCapacity: nil,
-			TerminateHook:   termHook,
-			PendingHook:     pendHook,
-			ItemTimeout:     timeout,
+			Noop:                  noop,
+			Force:                 force,
+			AsgString:             asgString,
+			ASGTags:               asgTags,
+			ASGGlobs:              asgGlobs,
+			CommandString:         commandString,
+			DefaultCapacity:       nil,
+			TerminateHook:         termHook,
+			PendingHook:           pendHook,
+			ItemTimeout:           timeout,
+			ClientOpts:            clientOpts,
+			EventsFile:            eventsFile,
+			SummaryFile:           summaryFile,
+			MetricsAddr:           metricsAddr,
+			LBHealth:              lbHealth,
+			ValidateCommand:       validateCommand,
+			Interrupt:             handleInterrupts(),
+			RestoreOnInterrupt:    restoreOnInterrupt,
+			Webhooks:              webhookOptsFromViper(),
+			SuspendProcesses:      viper.GetStringSlice("suspend-processes"),
+			UnprotectOld:          viper.GetBool("unprotect-old"),
+			ProtectNew:            viper.GetBool("protect-new"),
+			RefreshWarmPool:       viper.GetBool("refresh-warm-pool"),
+			AutoRollback:          autoRollback,
+			MaxFailedReplacements: maxFailed,
+			CheckpointFile:        checkpointFile,
+			Resume:                resume,
 		}
 
 		ctx, cancel := context.WithCancel(context.Background())
@@ -73,16 +106,37 @@ var slowCanaryCmd = &cobra.Command{
 		if err != nil {
 			log.Fatal(errors.Wrap(err, "error initializing runner"))
 		}
+		log.RegisterExitHandler(func() {
+			r.Finish(errors.New("bouncer exited on a fatal error"))
+		})
 
 		err = r.ValidatePrereqs(ctx)
 		if err != nil {
+			r.Finish(err)
 			log.Fatal(err)
 		}
 
 		err = r.Run()
+		if err == nil {
+			err = r.RefreshWarmPool()
+		}
+		r.Finish(err)
+		if bouncer.IsRollback(err) {
+			log.Error(err)
+			os.Exit(bouncer.RollbackExitCode)
+		}
 		if err != nil {
 			log.Fatal(errors.Wrap(err, "error in run"))
 		}
+
+		if noop {
+			r.LogNoopPlan()
+		}
+
+		err = r.RemoveCheckpoint()
+		if err != nil {
+			log.Fatal(err)
+		}
 	},
 }
 
@@ -107,9 +161,33 @@ func init() {
 		log.Fatal(errors.Wrap(err, "Binding PFlag 'command' to viper var 'slow-canary.command' failed: %s"))
 	}
 
-	slowCanaryCmd.Flags().BoolP("force", "f", false, "Force all nodes to be recycled, even if they're running the latest launch config")
+	slowCanaryCmd.Flags().BoolP("force", "f", false, "Force all nodes to be recycled, even if they're running the latest launch config; needed to roll out an on-demand or spot distribution change, which doesn't make any node old")
 	err = viper.BindPFlag("slow-canary.force", slowCanaryCmd.Flags().Lookup("force"))
 	if err != nil {
 		log.Fatal(errors.Wrap(err, "Binding PFlag 'force' to viper var 'slow-canary.force' failed: %s"))
 	}
+
+	slowCanaryCmd.Flags().StringP("checkpoint-file", "", "", "File to record progress in, so an interrupted run can be resumed with --resume")
+	err = viper.BindPFlag("slow-canary.checkpoint-file", slowCanaryCmd.Flags().Lookup("checkpoint-file"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'checkpoint-file' to viper var 'slow-canary.checkpoint-file' failed: %s"))
+	}
+
+	slowCanaryCmd.Flags().BoolP("resume", "", false, "Resume an interrupted run from the state recorded in --checkpoint-file")
+	err = viper.BindPFlag("slow-canary.resume", slowCanaryCmd.Flags().Lookup("resume"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'resume' to viper var 'slow-canary.resume' failed: %s"))
+	}
+
+	slowCanaryCmd.Flags().BoolP("auto-rollback", "", false, "If the canary fails, terminate the new instances and restore the original desired capacity, then exit 3")
+	err = viper.BindPFlag("slow-canary.auto-rollback", slowCanaryCmd.Flags().Lookup("auto-rollback"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'auto-rollback' to viper var 'slow-canary.auto-rollback' failed: %s"))
+	}
+
+	slowCanaryCmd.Flags().IntP("max-failed-replacements", "", 3, "With --auto-rollback, roll back once this many new instances have gone away without becoming healthy")
+	err = viper.BindPFlag("slow-canary.max-failed-replacements", slowCanaryCmd.Flags().Lookup("max-failed-replacements"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'max-failed-replacements' to viper var 'slow-canary.max-failed-replacements' failed: %s"))
+	}
 }
@@ -0,0 +1,204 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"github.com/palantir/bouncer/bouncer"
+	"github.com/palantir/bouncer/standby"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var standbyCmd = &cobra.Command{
+	Use:   "standby",
+	Short: "Run bouncer in standby",
+	Long:  `Run bouncer in standby mode, where we add new nodes to an ASG in batches, moving as many old nodes to standby as each batch comes up, and only terminate the old nodes once every new one has baked. If anything fails first, the old nodes are brought back out of standby and the new ones terminated.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetLevel(logLevelFromViper())
+
+		log.Debug("standby called")
+		if log.GetLevel() == log.DebugLevel {
+			cmd.DebugFlags()
+			viper.Debug()
+		}
+
+		asgString := viper.GetString("standby.asg")
+		asgTags := viper.GetStringSlice("asg-tag")
+		asgGlobs := viper.GetStringSlice("asg-glob")
+		if asgString == "" && len(asgTags) == 0 && len(asgGlobs) == 0 {
+			log.Fatal("You must specify ASG to cycle nodes from, or select them with --asg-tag or --asg-glob")
+		}
+
+		commandString := viper.GetString("standby.command")
+		noop := viper.GetBool("standby.noop")
+		force := viper.GetBool("standby.force")
+		checkpointFile := viper.GetString("standby.checkpoint-file")
+		resume := viper.GetBool("standby.resume")
+		batchSize, batchPercent, err := bouncer.ParseBatchSize(viper.GetString("standby.batchsize"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		termHook := viper.GetString("terminate-hook")
+		pendHook := viper.GetString("pending-hook")
+		eventsFile := viper.GetString("events-file")
+		summaryFile := viper.GetString("summary-file")
+		metricsAddr := viper.GetString("metrics-addr")
+		lbHealth := viper.GetBool("lb-health")
+		bakeTime := viper.GetDuration("standby.bake-time")
+		maxFailed := viper.GetInt("standby.max-failed-replacements")
+		validateCommand := viper.GetString("validate-new")
+		restoreOnInterrupt := viper.GetBool("restore-on-interrupt")
+		timeout := timeoutFromViper()
+		clientOpts := awsClientOptsFromViper()
+
+		log.Debugf("Binding vars, got %+v %+v %+v %+v", asgString, noop, version, commandString)
+
+		log.Info("Beginning bouncer standby run")
+
+		opts := bouncer.RunnerOpts{
+			Noop:                  noop,
+			BatchSize:             &batchSize,
+			BatchPercent:          batchPercent,
+			Force:                 force,
+			AsgString:             asgString,
+			ASGTags:               asgTags,
+			ASGGlobs:              asgGlobs,
+			CommandString:         commandString,
+			TerminateHook:         termHook,
+			PendingHook:           pendHook,
+			ItemTimeout:           timeout,
+			ClientOpts:            clientOpts,
+			EventsFile:            eventsFile,
+			SummaryFile:           summaryFile,
+			MetricsAddr:           metricsAddr,
+			LBHealth:              lbHealth,
+			ValidateCommand:       validateCommand,
+			Interrupt:             handleInterrupts(),
+			RestoreOnInterrupt:    restoreOnInterrupt,
+			Webhooks:              webhookOptsFromViper(),
+			SuspendProcesses:      viper.GetStringSlice("suspend-processes"),
+			UnprotectOld:          viper.GetBool("unprotect-old"),
+			ProtectNew:            viper.GetBool("protect-new"),
+			RefreshWarmPool:       viper.GetBool("refresh-warm-pool"),
+			BakeTime:              bakeTime,
+			MaxFailedReplacements: maxFailed,
+			CheckpointFile:        checkpointFile,
+			Resume:                resume,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		log.RegisterExitHandler(cancel)
+
+		r, err := standby.NewRunner(ctx, &opts)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "error initializing runner"))
+		}
+		log.RegisterExitHandler(func() {
+			r.Finish(errors.New("bouncer exited on a fatal error"))
+		})
+
+		err = r.ValidatePrereqs(ctx)
+		if err != nil {
+			r.Finish(err)
+			log.Fatal(err)
+		}
+
+		err = r.Run()
+		if err == nil {
+			err = r.RefreshWarmPool()
+		}
+		r.Finish(err)
+		if bouncer.IsRollback(err) {
+			log.Error(err)
+			os.Exit(bouncer.RollbackExitCode)
+		}
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "error in run"))
+		}
+
+		if noop {
+			r.LogNoopPlan()
+		}
+
+		err = r.RemoveCheckpoint()
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(standbyCmd)
+
+	standbyCmd.Flags().BoolP("noop", "n", false, "Run this in noop mode, and only print what you would do")
+	err := viper.BindPFlag("standby.noop", standbyCmd.Flags().Lookup("noop"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'noop' to viper var 'standby.noop' failed: %s"))
+	}
+
+	standbyCmd.Flags().StringP("asg", "a", "", "ASG to refresh")
+	err = viper.BindPFlag("standby.asg", standbyCmd.Flags().Lookup("asg"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'asg' to viper var 'standby.asg' failed: %s"))
+	}
+
+	standbyCmd.Flags().StringP("batchsize", "b", "0", "Max number of new nodes to add, and old nodes to move to standby, at a time, or a percentage of desired capacity like 25%, rounded up. Defaults to all nodes at once.")
+	err = viper.BindPFlag("standby.batchsize", standbyCmd.Flags().Lookup("batchsize"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'batchsize' to viper var 'standby.batchsize' failed: %s"))
+	}
+
+	standbyCmd.Flags().StringP("preterminatecall", "p", "", "External command to run before host is removed from its ELB & terminate process begins")
+	err = viper.BindPFlag("standby.command", standbyCmd.Flags().Lookup("preterminatecall"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'command' to viper var 'standby.command' failed: %s"))
+	}
+
+	standbyCmd.Flags().BoolP("force", "f", false, "Force all nodes to be recycled, even if they're running the latest launch config; needed to roll out an on-demand or spot distribution change, which doesn't make any node old")
+	err = viper.BindPFlag("standby.force", standbyCmd.Flags().Lookup("force"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'force' to viper var 'standby.force' failed: %s"))
+	}
+
+	standbyCmd.Flags().StringP("checkpoint-file", "", "", "File to record progress in, so an interrupted run can be resumed with --resume")
+	err = viper.BindPFlag("standby.checkpoint-file", standbyCmd.Flags().Lookup("checkpoint-file"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'checkpoint-file' to viper var 'standby.checkpoint-file' failed: %s"))
+	}
+
+	standbyCmd.Flags().BoolP("resume", "", false, "Resume an interrupted run from the state recorded in --checkpoint-file")
+	err = viper.BindPFlag("standby.resume", standbyCmd.Flags().Lookup("resume"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'resume' to viper var 'standby.resume' failed: %s"))
+	}
+
+	standbyCmd.Flags().DurationP("bake-time", "", 0, "How long to wait, once every old node is in standby and every new one is healthy, before terminating the old nodes")
+	err = viper.BindPFlag("standby.bake-time", standbyCmd.Flags().Lookup("bake-time"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'bake-time' to viper var 'standby.bake-time' failed: %s"))
+	}
+
+	standbyCmd.Flags().IntP("max-failed-replacements", "", 3, "Roll back once this many new instances have gone away without becoming healthy")
+	err = viper.BindPFlag("standby.max-failed-replacements", standbyCmd.Flags().Lookup("max-failed-replacements"))
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "Binding PFlag 'max-failed-replacements' to viper var 'standby.max-failed-replacements' failed: %s"))
+	}
+}
@@ -22,6 +22,9 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// Mode is the name this runner is invoked by
+const Mode = "full"
+
 // Runner holds data for a particular full run
 // Note that in the full case, asgs will always be of length 1
 type Runner struct {
@@ -30,7 +33,7 @@ type Runner struct {
 
 // NewRunner instantiates a new full runner
 func NewRunner(ctx context.Context, opts *bouncer.RunnerOpts) (*Runner, error) {
-	br, err := bouncer.NewBaseRunner(ctx, opts)
+	br, err := bouncer.NewBaseRunner(ctx, Mode, opts)
 	if err != nil {
 		return nil, errors.Wrap(err, "error getting base runner")
 	}
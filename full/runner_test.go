@@ -15,12 +15,16 @@
 package full
 
 import (
+	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
 	"github.com/palantir/bouncer/bouncer"
+	"github.com/palantir/bouncer/simulator"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func asgSliceTestConstructor(len int) []*bouncer.ASG {
@@ -54,3 +58,36 @@ func TestReverseASGSlice(t *testing.T) {
 	assert.Equal(t, asgSliceTestConstructor(8)[7], reverseASGSetOrder(asgSliceTestConstructor(8))[0], "The last asg in a set of 8 should equal the first entry in the reverse")
 	assert.Equal(t, asgSliceTestConstructor(15)[7], reverseASGSetOrder(asgSliceTestConstructor(15))[7], "The middle asg in a set of 15 should equal the middle asg in the reverse as it is an odd numbered slice")
 }
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	asgs := []string{"test-asg-0", "test-asg-1"}
+	var cfgs []simulator.ASGConfig
+	for _, name := range asgs {
+		cfgs = append(cfgs, simulator.ASGConfig{
+			Name:            name,
+			MinSize:         0,
+			MaxSize:         2,
+			DesiredCapacity: 2,
+		})
+	}
+	sim, err := simulator.NewWithOldASGs(cfgs...)
+	require.NoError(t, err)
+
+	r, err := NewRunner(ctx, &bouncer.RunnerOpts{
+		AsgString:     "test-asg-0:2,test-asg-1:2",
+		ItemTimeout:   time.Minute,
+		Clients:       sim.Clients(),
+		CheckInterval: time.Millisecond,
+	})
+	require.NoError(t, err)
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	require.NoError(t, r.Run())
+
+	for _, name := range asgs {
+		assert.Equal(t, 0, sim.OldInstanceCount(name))
+		assert.Len(t, sim.InstanceStates(name), 2)
+		assert.Equal(t, int32(2), sim.DesiredCapacity(name))
+		assert.Equal(t, simulator.Stats{MaxInstances: 2, MinInService: 0}, sim.Stats(name))
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package instancerefresh
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/palantir/bouncer/bouncer"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Mode is the name this runner is invoked by
+const Mode = "instance-refresh"
+
+// Runner holds data for a particular instance-refresh run
+type Runner struct {
+	bouncer.BaseRunner
+	// refreshIDs maps each ASG to the instance refresh started for it
+	refreshIDs map[string]string
+}
+
+// NewRunner instantiates a new instance-refresh runner
+func NewRunner(ctx context.Context, opts *bouncer.RunnerOpts) (*Runner, error) {
+	br, err := bouncer.NewBaseRunner(ctx, Mode, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting base runner")
+	}
+
+	r := Runner{
+		BaseRunner: *br,
+		refreshIDs: make(map[string]string),
+	}
+	return &r, nil
+}
+
+// ValidatePrereqs checks that the instance-refresh runner is safe to proceed
+func (r *Runner) ValidatePrereqs(ctx context.Context) error {
+	asgSet, err := r.NewASGSet(ctx)
+	if err != nil {
+		return errors.Wrap(err, "error building ASGSet")
+	}
+
+	divergedASGs := asgSet.GetDivergedASGs()
+	if len(divergedASGs) != 0 {
+		for _, badASG := range divergedASGs {
+			log.WithFields(log.Fields{
+				"ASG":                     *badASG.ASG.AutoScalingGroupName,
+				"desired_capacity actual": *badASG.ASG.DesiredCapacity,
+				"desired_capacity given":  badASG.DesiredASG.DesiredCapacity,
+			}).Error("ASG desired capacity doesn't match expected starting value")
+		}
+		return errors.New("error validating initial ASG state")
+	}
+
+	for _, asg := range asgSet.ASGs {
+		if *asg.ASG.DesiredCapacity == 0 {
+			log.WithFields(log.Fields{
+				"ASG": *asg.ASG.AutoScalingGroupName,
+			}).Warn("ASG desired capacity is 0 - nothing to do here")
+			return errors.New("error validating initial ASG state")
+		}
+
+		active, err := r.ActiveInstanceRefresh(ctx, *asg.ASG.AutoScalingGroupName)
+		if err != nil {
+			return errors.Wrap(err, "error checking for instance refreshes")
+		}
+		if active != nil {
+			log.WithFields(log.Fields{
+				"ASG":       *asg.ASG.AutoScalingGroupName,
+				"RefreshID": aws.ToString(active.InstanceRefreshId),
+				"Status":    active.Status,
+			}).Error("ASG already has an instance refresh going")
+			return errors.New("error validating initial ASG state")
+		}
+	}
+
+	return nil
+}
+
+// stopRefreshes cancels or rolls back every refresh this run started that's still going.  It's only called
+// once the run has already failed, so it gets its own context and logs errors rather than returning them
+func (r *Runner) stopRefreshes() {
+	ctx, cancel := r.NewContext()
+	defer cancel()
+
+	for asgName, refreshID := range r.refreshIDs {
+		refresh, err := r.GetInstanceRefresh(ctx, asgName, refreshID)
+		if err != nil {
+			log.Error(errors.Wrap(err, "error checking instance refresh before stopping it"))
+			continue
+		}
+
+		if refresh.Status != at.InstanceRefreshStatusPending && refresh.Status != at.InstanceRefreshStatusInProgress && refresh.Status != at.InstanceRefreshStatusBaking {
+			continue
+		}
+
+		err = r.StopInstanceRefresh(ctx, asgName)
+		if err != nil {
+			log.Error(errors.Wrap(err, "error stopping instance refresh"))
+		}
+	}
+}
+
+// Run starts an instance refresh on every ASG, then waits for them all to finish.  The timeout starts over
+// whenever a refresh makes progress, and if it's exceeded, or the run is aborted, the refreshes are stopped
+func (r *Runner) Run() error {
+	ctx, cancel := r.NewContext()
+	defer cancel()
+
+	asgSet, err := r.NewASGSet(ctx)
+	if err != nil {
+		return errors.Wrap(err, "error building ASGSet")
+	}
+
+	for _, asg := range asgSet.ASGs {
+		refreshID, err := r.StartInstanceRefresh(ctx, asg)
+		if err != nil {
+			r.stopRefreshes()
+			return errors.Wrap(err, "error starting instance refresh")
+		}
+		r.refreshIDs[*asg.ASG.AutoScalingGroupName] = refreshID
+	}
+
+	progress := make(map[string]int32)
+	for {
+		err = r.Wait(ctx)
+		if err != nil {
+			r.stopRefreshes()
+			return err
+		}
+
+		// The refreshes terminate instances on their own, so they have to be stopped before NewASGSet waits on them
+		if r.Interrupted() {
+			r.stopRefreshes()
+		}
+
+		// Rebuild the state of the world every iteration of the loop, so the metrics keep up with the refresh
+		log.Debug("Beginning new instance-refresh run check")
+		_, err = r.NewASGSet(ctx)
+		if err != nil {
+			r.stopRefreshes()
+			return errors.Wrap(err, "error building ASGSet")
+		}
+
+		done := true
+		for asgName, refreshID := range r.refreshIDs {
+			refresh, err := r.GetInstanceRefresh(ctx, asgName, refreshID)
+			if err != nil {
+				r.stopRefreshes()
+				return errors.Wrap(err, "error checking instance refresh")
+			}
+
+			switch refresh.Status {
+			case at.InstanceRefreshStatusSuccessful:
+				continue
+			case at.InstanceRefreshStatusFailed,
+				at.InstanceRefreshStatusCancelled,
+				at.InstanceRefreshStatusRollbackSuccessful,
+				at.InstanceRefreshStatusRollbackFailed:
+				r.stopRefreshes()
+				return errors.Errorf("instance refresh %s of ASG %s ended %s: %s", refreshID, asgName, refresh.Status, aws.ToString(refresh.StatusReason))
+			}
+
+			done = false
+			if percent := aws.ToInt32(refresh.PercentageComplete); percent > progress[asgName] {
+				progress[asgName] = percent
+				ctx, cancel = r.NewContext()
+				defer cancel()
+			}
+		}
+
+		if done {
+			log.Info("Every instance refresh has finished - we're done here!")
+			return nil
+		}
+	}
+}
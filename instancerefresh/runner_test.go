@@ -0,0 +1,171 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package instancerefresh
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/palantir/bouncer/bouncer"
+	"github.com/palantir/bouncer/simulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSim(t *testing.T, cfg simulator.ASGConfig) *simulator.Simulator {
+	sim, err := simulator.NewWithOldASGs(cfg)
+	require.NoError(t, err)
+	return sim
+}
+
+// newTestRunner returns a runner against the simulator which, unless opts say otherwise, checks it every millisecond
+// and gives each change a minute
+func newTestRunner(t *testing.T, sim *simulator.Simulator, opts bouncer.RunnerOpts) *Runner {
+	t.Helper()
+	opts.Clients = sim.Clients()
+	if opts.CheckInterval == 0 {
+		opts.CheckInterval = time.Millisecond
+	}
+	if opts.ItemTimeout == 0 {
+		opts.ItemTimeout = time.Minute
+	}
+
+	r, err := NewRunner(context.Background(), &opts)
+	require.NoError(t, err)
+	return r
+}
+
+func refreshStatuses(t *testing.T, sim *simulator.Simulator, asgName string) []at.InstanceRefreshStatus {
+	out, err := sim.DescribeInstanceRefreshes(context.Background(), &autoscaling.DescribeInstanceRefreshesInput{
+		AutoScalingGroupName: aws.String(asgName),
+	})
+	require.NoError(t, err)
+
+	var statuses []at.InstanceRefreshStatus
+	for _, refresh := range out.InstanceRefreshes {
+		statuses = append(statuses, refresh.Status)
+	}
+	return statuses
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	sim := newSim(t, simulator.ASGConfig{
+		Name:            "test-asg",
+		MinSize:         4,
+		MaxSize:         8,
+		DesiredCapacity: 4,
+	})
+
+	minHealthy := int32(50)
+	r := newTestRunner(t, sim, bouncer.RunnerOpts{
+		AsgString:            "test-asg:4",
+		MinHealthyPercentage: &minHealthy,
+	})
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	require.NoError(t, r.Run())
+
+	assert.Equal(t, 0, sim.OldInstanceCount("test-asg"))
+	assert.Len(t, sim.InstanceStates("test-asg"), 4)
+	assert.Equal(t, int32(4), sim.DesiredCapacity("test-asg"))
+	assert.Equal(t, simulator.Stats{MaxInstances: 6, MinInService: 2}, sim.Stats("test-asg"))
+	assert.Equal(t, []at.InstanceRefreshStatus{at.InstanceRefreshStatusSuccessful}, refreshStatuses(t, sim, "test-asg"))
+
+	// Nothing's old any more, so a second run has nothing to replace, unless forced
+	r = newTestRunner(t, sim, bouncer.RunnerOpts{
+		AsgString: "test-asg:4",
+	})
+	require.NoError(t, r.Run())
+	assert.Equal(t, simulator.Stats{MaxInstances: 6, MinInService: 2}, sim.Stats("test-asg"))
+}
+
+func TestRunNoop(t *testing.T) {
+	ctx := context.Background()
+	sim := newSim(t, simulator.ASGConfig{
+		Name:            "test-asg",
+		MinSize:         3,
+		MaxSize:         6,
+		DesiredCapacity: 3,
+	})
+	oldStates := sim.InstanceStates("test-asg")
+
+	r := newTestRunner(t, sim, bouncer.RunnerOpts{
+		Noop:      true,
+		Force:     true,
+		AsgString: "test-asg:3",
+	})
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	require.NoError(t, r.Run())
+
+	require.Len(t, r.Actions(), 1)
+	assert.Equal(t, bouncer.ActionStartInstanceRefresh, r.Actions()[0].Kind)
+
+	// The real ASG must be untouched
+	assert.Equal(t, oldStates, sim.InstanceStates("test-asg"))
+	assert.Empty(t, refreshStatuses(t, sim, "test-asg"))
+}
+
+func TestRunTimeout(t *testing.T) {
+	for _, rollback := range []bool{false, true} {
+		ctx := context.Background()
+		// New instances never become healthy, so the refresh stalls after its first batch
+		sim := newSim(t, simulator.ASGConfig{
+			Name:              "test-asg",
+			MinSize:           3,
+			MaxSize:           6,
+			DesiredCapacity:   3,
+			LoadBalancerNames: []string{"test-elb"},
+			LBHealthyAfter:    1000000,
+		})
+
+		r := newTestRunner(t, sim, bouncer.RunnerOpts{
+			AsgString:   "test-asg:3",
+			ItemTimeout: 50 * time.Millisecond,
+			Rollback:    rollback,
+		})
+		require.NoError(t, r.ValidatePrereqs(ctx))
+		assert.Error(t, r.Run())
+
+		want := at.InstanceRefreshStatusCancelling
+		if rollback {
+			want = at.InstanceRefreshStatusRollbackInProgress
+		}
+		assert.Equal(t, []at.InstanceRefreshStatus{want}, refreshStatuses(t, sim, "test-asg"))
+		assert.Equal(t, bouncer.ActionStopInstanceRefresh, r.Actions()[len(r.Actions())-1].Kind)
+	}
+}
+
+func TestValidatePrereqsRefreshInProgress(t *testing.T) {
+	ctx := context.Background()
+	sim := newSim(t, simulator.ASGConfig{
+		Name:            "test-asg",
+		MinSize:         3,
+		MaxSize:         6,
+		DesiredCapacity: 3,
+	})
+	_, err := sim.StartInstanceRefresh(ctx, &autoscaling.StartInstanceRefreshInput{
+		AutoScalingGroupName: aws.String("test-asg"),
+	})
+	require.NoError(t, err)
+
+	r := newTestRunner(t, sim, bouncer.RunnerOpts{
+		AsgString: "test-asg:3",
+	})
+	assert.Error(t, r.ValidatePrereqs(ctx))
+}
@@ -22,6 +22,9 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// Mode is the name this runner is invoked by
+const Mode = "rolling"
+
 // Runner holds data for a particular rolling run
 type Runner struct {
 	bouncer.BaseRunner
@@ -29,7 +32,7 @@ type Runner struct {
 
 // NewRunner instantiates a new rolling runner
 func NewRunner(ctx context.Context, opts *bouncer.RunnerOpts) (*Runner, error) {
-	br, err := bouncer.NewBaseRunner(ctx, opts)
+	br, err := bouncer.NewBaseRunner(ctx, Mode, opts)
 	if err != nil {
 		return nil, errors.Wrap(err, "error getting base runner")
 	}
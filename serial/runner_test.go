@@ -0,0 +1,129 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package serial
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/palantir/bouncer/bouncer"
+	"github.com/palantir/bouncer/simulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRunner returns a runner against the simulator which, unless opts say otherwise, checks it every millisecond
+// and gives each change a minute
+func newTestRunner(t *testing.T, sim *simulator.Simulator, opts bouncer.RunnerOpts) *Runner {
+	t.Helper()
+	opts.Clients = sim.Clients()
+	if opts.CheckInterval == 0 {
+		opts.CheckInterval = time.Millisecond
+	}
+	if opts.ItemTimeout == 0 {
+		opts.ItemTimeout = time.Minute
+	}
+
+	r, err := NewRunner(context.Background(), &opts)
+	require.NoError(t, err)
+	return r
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	asgs := []string{"test-asg-0", "test-asg-1", "test-asg-2"}
+	var cfgs []simulator.ASGConfig
+	for _, name := range asgs {
+		cfgs = append(cfgs, simulator.ASGConfig{
+			Name:            name,
+			MinSize:         0,
+			MaxSize:         1,
+			DesiredCapacity: 1,
+		})
+	}
+	sim, err := simulator.NewWithOldASGs(cfgs...)
+	require.NoError(t, err)
+
+	defCap := int32(1)
+
+	r := newTestRunner(t, sim, bouncer.RunnerOpts{
+		AsgString:       "test-asg-0,test-asg-1,test-asg-2",
+		DefaultCapacity: &defCap,
+	})
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	require.NoError(t, r.Run())
+
+	for _, name := range asgs {
+		assert.Equal(t, 0, sim.OldInstanceCount(name))
+		assert.Len(t, sim.InstanceStates(name), 1)
+		assert.Equal(t, int32(1), sim.DesiredCapacity(name))
+		assert.Equal(t, simulator.Stats{MaxInstances: 1, MinInService: 0}, sim.Stats(name))
+	}
+}
+
+func TestRunWebhooks(t *testing.T) {
+	var mu sync.Mutex
+	calls := make(map[bouncer.Webhook][]bouncer.WebhookPayload)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var payload bouncer.WebhookPayload
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+		mu.Lock()
+		calls[payload.Webhook] = append(calls[payload.Webhook], payload)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	sim, err := simulator.NewWithOldASGs(simulator.ASGConfig{
+		Name:            "test-asg",
+		MinSize:         0,
+		MaxSize:         3,
+		DesiredCapacity: 3,
+	})
+	require.NoError(t, err)
+	oldStates := sim.InstanceStates("test-asg")
+
+	r := newTestRunner(t, sim, bouncer.RunnerOpts{
+		AsgString: "test-asg:3",
+		Webhooks: bouncer.WebhookOpts{
+			PreTerminate: server.URL + "/pre-terminate",
+			NewHealthy:   server.URL + "/post-new-healthy",
+			RunFinished:  server.URL + "/run-finished",
+			Timeout:      time.Second,
+		},
+	})
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	require.NoError(t, r.Run())
+	r.Finish(nil)
+
+	require.Len(t, calls[bouncer.WebhookPreTerminate], 3)
+	for _, payload := range calls[bouncer.WebhookPreTerminate] {
+		assert.Contains(t, oldStates, payload.Instance.InstanceID)
+		assert.Equal(t, "test-asg", payload.Instance.ASG)
+		assert.Equal(t, Mode, payload.Mode)
+	}
+
+	require.Len(t, calls[bouncer.WebhookNewHealthy], 3)
+	for _, payload := range calls[bouncer.WebhookNewHealthy] {
+		assert.Contains(t, sim.InstanceStates("test-asg"), payload.Instance.InstanceID)
+	}
+
+	require.Len(t, calls[bouncer.WebhookRunFinished], 1)
+	assert.True(t, *calls[bouncer.WebhookRunFinished][0].Success)
+}
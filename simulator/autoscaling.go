@@ -0,0 +1,416 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulator
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/pkg/errors"
+)
+
+// DescribeAutoScalingGroups advances the simulation one tick, then returns the requested ASGs, or all of them if none are named
+func (s *Simulator) DescribeAutoScalingGroups(ctx context.Context, params *autoscaling.DescribeAutoScalingGroupsInput, optFns ...func(*autoscaling.Options)) (*autoscaling.DescribeAutoScalingGroupsOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tick()
+
+	var asgs []at.AutoScalingGroup
+	for _, g := range s.groups {
+		if len(params.AutoScalingGroupNames) == 0 || slices.Contains(params.AutoScalingGroupNames, g.cfg.Name) {
+			asgs = append(asgs, s.toASG(g))
+		}
+	}
+
+	return &autoscaling.DescribeAutoScalingGroupsOutput{
+		AutoScalingGroups: asgs,
+	}, nil
+}
+
+// DescribeLaunchConfigurations returns a launch configuration for each name given
+func (s *Simulator) DescribeLaunchConfigurations(ctx context.Context, params *autoscaling.DescribeLaunchConfigurationsInput, optFns ...func(*autoscaling.Options)) (*autoscaling.DescribeLaunchConfigurationsOutput, error) {
+	var lcs []at.LaunchConfiguration
+	for _, name := range params.LaunchConfigurationNames {
+		lcs = append(lcs, at.LaunchConfiguration{
+			LaunchConfigurationName: aws.String(name),
+		})
+	}
+
+	return &autoscaling.DescribeLaunchConfigurationsOutput{
+		LaunchConfigurations: lcs,
+	}, nil
+}
+
+// CompleteLifecycleAction moves an instance out of Pending:Wait or Terminating:Wait
+func (s *Simulator) CompleteLifecycleAction(ctx context.Context, params *autoscaling.CompleteLifecycleActionInput, optFns ...func(*autoscaling.Options)) (*autoscaling.CompleteLifecycleActionOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inst, ok := s.instances[aws.ToString(params.InstanceId)]
+	if !ok || inst.asgName != aws.ToString(params.AutoScalingGroupName) {
+		return nil, errors.Errorf("ValidationError: no active lifecycle action found for instance %s", aws.ToString(params.InstanceId))
+	}
+	g := s.getGroup(inst.asgName)
+	abandon := aws.ToString(params.LifecycleActionResult) == "ABANDON"
+	hook := aws.ToString(params.LifecycleHookName)
+
+	switch {
+	case inst.lifecycleState == at.LifecycleStatePendingWait && (g.loaded || hook == g.cfg.PendingHook):
+		if abandon {
+			inst.lifecycleState = at.LifecycleStateTerminating
+		} else {
+			inst.lifecycleState = at.LifecycleStatePendingProceed
+		}
+	case inst.lifecycleState == at.LifecycleStateTerminatingWait && (g.loaded || hook == g.cfg.TerminateHook):
+		inst.lifecycleState = at.LifecycleStateTerminatingProceed
+	default:
+		return nil, errors.Errorf("ValidationError: no active lifecycle action found with hook %s for instance %s", hook, inst.id)
+	}
+
+	return &autoscaling.CompleteLifecycleActionOutput{}, nil
+}
+
+// TerminateInstanceInAutoScalingGroup starts terminating an instance, optionally decrementing its ASG's desired capacity.
+// Warm pool instances never count towards desired capacity, so terminating one leaves it alone
+func (s *Simulator) TerminateInstanceInAutoScalingGroup(ctx context.Context, params *autoscaling.TerminateInstanceInAutoScalingGroupInput, optFns ...func(*autoscaling.Options)) (*autoscaling.TerminateInstanceInAutoScalingGroupOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inst, ok := s.instances[aws.ToString(params.InstanceId)]
+	if !ok || inst.lifecycleState == at.LifecycleStateTerminated {
+		return nil, errors.Errorf("ValidationError: instance Id not found - No managed instance found for instance ID %s", aws.ToString(params.InstanceId))
+	}
+	if isTerminating(inst.lifecycleState) || isWarmTerminating(inst.lifecycleState) {
+		return nil, errors.Errorf("ValidationError: instance %s is already terminating", inst.id)
+	}
+
+	g := s.getGroup(inst.asgName)
+	if slices.Contains(g.warm, inst) {
+		inst.lifecycleState = at.LifecycleStateWarmedTerminating
+		return &autoscaling.TerminateInstanceInAutoScalingGroupOutput{}, nil
+	}
+	if aws.ToBool(params.ShouldDecrementDesiredCapacity) {
+		if g.desired <= g.cfg.MinSize {
+			return nil, errors.Errorf("ValidationError: currently, desiredSize equals minSize (%d). Terminating instance without replacement will violate group's min size constraint", g.cfg.MinSize)
+		}
+		g.desired--
+	}
+	inst.lifecycleState = at.LifecycleStateTerminating
+	s.updateStats(g)
+
+	return &autoscaling.TerminateInstanceInAutoScalingGroupOutput{}, nil
+}
+
+// SetDesiredCapacity changes the desired capacity of an ASG, which takes effect on the next tick
+func (s *Simulator) SetDesiredCapacity(ctx context.Context, params *autoscaling.SetDesiredCapacityInput, optFns ...func(*autoscaling.Options)) (*autoscaling.SetDesiredCapacityOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := s.getGroup(aws.ToString(params.AutoScalingGroupName))
+	if g == nil {
+		return nil, errors.Errorf("ValidationError: AutoScalingGroup name not found - %s", aws.ToString(params.AutoScalingGroupName))
+	}
+
+	desired := aws.ToInt32(params.DesiredCapacity)
+	if desired > g.cfg.MaxSize {
+		return nil, errors.Errorf("ValidationError: new SetDesiredCapacity value %d is above max value %d for the AutoScalingGroup", desired, g.cfg.MaxSize)
+	}
+	if desired < g.cfg.MinSize {
+		return nil, errors.Errorf("ValidationError: new SetDesiredCapacity value %d is below min value %d for the AutoScalingGroup", desired, g.cfg.MinSize)
+	}
+	g.desired = desired
+
+	return &autoscaling.SetDesiredCapacityOutput{}, nil
+}
+
+// SuspendProcesses adds the given processes to those suspended on the ASG
+func (s *Simulator) SuspendProcesses(ctx context.Context, params *autoscaling.SuspendProcessesInput, optFns ...func(*autoscaling.Options)) (*autoscaling.SuspendProcessesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := s.getGroup(aws.ToString(params.AutoScalingGroupName))
+	if g == nil {
+		return nil, errors.Errorf("ValidationError: AutoScalingGroup name not found - %s", aws.ToString(params.AutoScalingGroupName))
+	}
+
+	for _, process := range params.ScalingProcesses {
+		if !slices.Contains(g.suspended, process) {
+			g.suspended = append(g.suspended, process)
+		}
+	}
+
+	return &autoscaling.SuspendProcessesOutput{}, nil
+}
+
+// ResumeProcesses removes the given processes from those suspended on the ASG
+func (s *Simulator) ResumeProcesses(ctx context.Context, params *autoscaling.ResumeProcessesInput, optFns ...func(*autoscaling.Options)) (*autoscaling.ResumeProcessesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := s.getGroup(aws.ToString(params.AutoScalingGroupName))
+	if g == nil {
+		return nil, errors.Errorf("ValidationError: AutoScalingGroup name not found - %s", aws.ToString(params.AutoScalingGroupName))
+	}
+
+	g.suspended = slices.DeleteFunc(g.suspended, func(process string) bool {
+		return slices.Contains(params.ScalingProcesses, process)
+	})
+
+	return &autoscaling.ResumeProcessesOutput{}, nil
+}
+
+// SetInstanceProtection turns scale-in protection on or off for instances in the ASG, which must be InService
+func (s *Simulator) SetInstanceProtection(ctx context.Context, params *autoscaling.SetInstanceProtectionInput, optFns ...func(*autoscaling.Options)) (*autoscaling.SetInstanceProtectionOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := aws.ToString(params.AutoScalingGroupName)
+	for _, id := range params.InstanceIds {
+		inst, ok := s.instances[id]
+		if !ok || inst.asgName != name || inst.lifecycleState == at.LifecycleStateTerminated {
+			return nil, errors.Errorf("ValidationError: The instance %s is not part of Auto Scaling group %s", id, name)
+		}
+		if inst.lifecycleState != at.LifecycleStateInService {
+			return nil, errors.Errorf("ValidationError: The instance %s is not in InService", id)
+		}
+	}
+
+	for _, id := range params.InstanceIds {
+		s.instances[id].protected = aws.ToBool(params.ProtectedFromScaleIn)
+	}
+
+	return &autoscaling.SetInstanceProtectionOutput{}, nil
+}
+
+// EnterStandby moves InService instances of the ASG to EnteringStandby, optionally decrementing its desired capacity.
+// Instances in standby don't count towards desired capacity, so without decrement they're replaced
+func (s *Simulator) EnterStandby(ctx context.Context, params *autoscaling.EnterStandbyInput, optFns ...func(*autoscaling.Options)) (*autoscaling.EnterStandbyOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := aws.ToString(params.AutoScalingGroupName)
+	g := s.getGroup(name)
+	if g == nil {
+		return nil, errors.Errorf("ValidationError: AutoScalingGroup name not found - %s", name)
+	}
+
+	for _, id := range params.InstanceIds {
+		inst, ok := s.instances[id]
+		if !ok || inst.asgName != name || inst.lifecycleState == at.LifecycleStateTerminated {
+			return nil, errors.Errorf("ValidationError: The instance %s is not part of Auto Scaling group %s", id, name)
+		}
+		if inst.lifecycleState != at.LifecycleStateInService {
+			return nil, errors.Errorf("ValidationError: The instance %s is not in InService", id)
+		}
+	}
+
+	if aws.ToBool(params.ShouldDecrementDesiredCapacity) {
+		desired := g.desired - int32(len(params.InstanceIds))
+		if desired < g.cfg.MinSize {
+			return nil, errors.Errorf("ValidationError: moving %d instances to standby would take desired capacity %d below min size %d", len(params.InstanceIds), g.desired, g.cfg.MinSize)
+		}
+		g.desired = desired
+	}
+
+	for _, id := range params.InstanceIds {
+		inst := s.instances[id]
+		inst.lifecycleState = at.LifecycleStateEnteringStandby
+		inst.inServiceTicks = 0
+	}
+	s.updateStats(g)
+
+	return &autoscaling.EnterStandbyOutput{}, nil
+}
+
+// ExitStandby moves Standby instances of the ASG back to Pending, incrementing its desired capacity
+func (s *Simulator) ExitStandby(ctx context.Context, params *autoscaling.ExitStandbyInput, optFns ...func(*autoscaling.Options)) (*autoscaling.ExitStandbyOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := aws.ToString(params.AutoScalingGroupName)
+	g := s.getGroup(name)
+	if g == nil {
+		return nil, errors.Errorf("ValidationError: AutoScalingGroup name not found - %s", name)
+	}
+
+	for _, id := range params.InstanceIds {
+		inst, ok := s.instances[id]
+		if !ok || inst.asgName != name || inst.lifecycleState == at.LifecycleStateTerminated {
+			return nil, errors.Errorf("ValidationError: The instance %s is not part of Auto Scaling group %s", id, name)
+		}
+		if inst.lifecycleState != at.LifecycleStateStandby {
+			return nil, errors.Errorf("ValidationError: The instance %s is not in Standby", id)
+		}
+	}
+
+	desired := g.desired + int32(len(params.InstanceIds))
+	if desired > g.cfg.MaxSize {
+		return nil, errors.Errorf("ValidationError: moving %d instances out of standby would take desired capacity %d above max size %d", len(params.InstanceIds), g.desired, g.cfg.MaxSize)
+	}
+	g.desired = desired
+
+	for _, id := range params.InstanceIds {
+		s.instances[id].lifecycleState = at.LifecycleStatePending
+	}
+
+	return &autoscaling.ExitStandbyOutput{}, nil
+}
+
+// DescribeWarmPool returns the ASG's warm pool instances, and its configuration if it has one
+func (s *Simulator) DescribeWarmPool(ctx context.Context, params *autoscaling.DescribeWarmPoolInput, optFns ...func(*autoscaling.Options)) (*autoscaling.DescribeWarmPoolOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := aws.ToString(params.AutoScalingGroupName)
+	g := s.getGroup(name)
+	if g == nil {
+		return nil, errors.Errorf("ValidationError: AutoScalingGroup name not found - %s", name)
+	}
+
+	output := autoscaling.DescribeWarmPoolOutput{
+		WarmPoolConfiguration: warmPoolConfiguration(g),
+	}
+	for _, inst := range g.warm {
+		output.Instances = append(output.Instances, toASGInstance(inst))
+	}
+
+	return &output, nil
+}
+
+func warmPoolConfiguration(g *group) *at.WarmPoolConfiguration {
+	if g.cfg.WarmPoolSize == 0 {
+		return nil
+	}
+
+	var state at.WarmPoolState
+	switch g.warmState {
+	case at.LifecycleStateWarmedRunning:
+		state = at.WarmPoolStateRunning
+	case at.LifecycleStateWarmedHibernated:
+		state = at.WarmPoolStateHibernated
+	default:
+		state = at.WarmPoolStateStopped
+	}
+
+	return &at.WarmPoolConfiguration{
+		MinSize:   aws.Int32(g.cfg.WarmPoolSize),
+		PoolState: state,
+	}
+}
+
+func (s *Simulator) toASG(g *group) at.AutoScalingGroup {
+	asg := at.AutoScalingGroup{
+		AutoScalingGroupName:             aws.String(g.cfg.Name),
+		AvailabilityZones:                slices.Clone(g.cfg.AvailabilityZones),
+		DesiredCapacity:                  aws.Int32(g.desired),
+		MinSize:                          aws.Int32(g.cfg.MinSize),
+		MaxSize:                          aws.Int32(g.cfg.MaxSize),
+		TargetGroupARNs:                  slices.Clone(g.cfg.TargetGroupARNs),
+		LoadBalancerNames:                slices.Clone(g.cfg.LoadBalancerNames),
+		NewInstancesProtectedFromScaleIn: aws.Bool(g.cfg.NewInstancesProtectedFromScaleIn),
+	}
+
+	for _, process := range g.suspended {
+		asg.SuspendedProcesses = append(asg.SuspendedProcesses, at.SuspendedProcess{
+			ProcessName:      aws.String(process),
+			SuspensionReason: aws.String("User suspended"),
+		})
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(g.cfg.Tags)) {
+		asg.Tags = append(asg.Tags, at.TagDescription{
+			Key:          aws.String(key),
+			Value:        aws.String(g.cfg.Tags[key]),
+			ResourceId:   aws.String(g.cfg.Name),
+			ResourceType: aws.String("auto-scaling-group"),
+		})
+	}
+
+	if g.template != nil && len(g.overrides) != 0 {
+		lt := at.LaunchTemplate{
+			LaunchTemplateSpecification: &at.LaunchTemplateSpecification{
+				LaunchTemplateId:   aws.String(g.template.id),
+				LaunchTemplateName: aws.String(g.template.name),
+				Version:            aws.String(g.cfg.LaunchTemplateVersion),
+			},
+		}
+		for _, o := range g.overrides {
+			ltOverride := at.LaunchTemplateOverrides{
+				InstanceType: aws.String(o.instanceType),
+			}
+			if o.template != nil {
+				ltOverride.LaunchTemplateSpecification = &at.LaunchTemplateSpecification{
+					LaunchTemplateId:   aws.String(o.template.id),
+					LaunchTemplateName: aws.String(o.template.name),
+					Version:            aws.String(o.version),
+				}
+			}
+			lt.Overrides = append(lt.Overrides, ltOverride)
+		}
+		asg.MixedInstancesPolicy = &at.MixedInstancesPolicy{
+			LaunchTemplate: &lt,
+		}
+	} else if g.template != nil {
+		asg.LaunchTemplate = &at.LaunchTemplateSpecification{
+			LaunchTemplateId:   aws.String(g.template.id),
+			LaunchTemplateName: aws.String(g.template.name),
+			Version:            aws.String(g.cfg.LaunchTemplateVersion),
+		}
+	} else if g.cfg.LaunchConfigurationName != "" {
+		asg.LaunchConfigurationName = aws.String(g.cfg.LaunchConfigurationName)
+	}
+
+	if cfg := warmPoolConfiguration(g); cfg != nil {
+		asg.WarmPoolConfiguration = cfg
+		asg.WarmPoolSize = aws.Int32(int32(len(warmPool(g))))
+	}
+
+	for _, inst := range g.instances {
+		asg.Instances = append(asg.Instances, toASGInstance(inst))
+	}
+
+	return asg
+}
+
+func toASGInstance(inst *instance) at.Instance {
+	asgInst := at.Instance{
+		InstanceId:           aws.String(inst.id),
+		AvailabilityZone:     aws.String(inst.az),
+		HealthStatus:         aws.String("Healthy"),
+		LifecycleState:       inst.lifecycleState,
+		ProtectedFromScaleIn: aws.Bool(inst.protected),
+	}
+
+	if inst.instanceType != "" {
+		asgInst.InstanceType = aws.String(inst.instanceType)
+	}
+
+	if inst.ltID != "" {
+		asgInst.LaunchTemplate = &at.LaunchTemplateSpecification{
+			LaunchTemplateId:   aws.String(inst.ltID),
+			LaunchTemplateName: aws.String(inst.ltName),
+			Version:            aws.String(inst.ltVersion),
+		}
+	} else if inst.lcName != "" {
+		asgInst.LaunchConfigurationName = aws.String(inst.lcName)
+	}
+
+	return asgInst
+}
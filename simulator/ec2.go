@@ -0,0 +1,110 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulator
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	et "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/pkg/errors"
+)
+
+// DescribeInstances returns one reservation per instance ID given
+func (s *Simulator) DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var reservations []et.Reservation
+	for _, id := range params.InstanceIds {
+		inst, ok := s.instances[id]
+		if !ok {
+			return nil, errors.Errorf("InvalidInstanceID.NotFound: the instance ID '%s' does not exist", id)
+		}
+
+		reservations = append(reservations, et.Reservation{
+			Instances: []et.Instance{s.toEC2Instance(inst)},
+		})
+	}
+
+	return &ec2.DescribeInstancesOutput{
+		Reservations: reservations,
+	}, nil
+}
+
+// DescribeInstanceAttribute returns an empty value for whichever attribute is requested
+func (s *Simulator) DescribeInstanceAttribute(ctx context.Context, params *ec2.DescribeInstanceAttributeInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceAttributeOutput, error) {
+	return &ec2.DescribeInstanceAttributeOutput{
+		InstanceId: params.InstanceId,
+		UserData:   &et.AttributeValue{Value: aws.String("")},
+	}, nil
+}
+
+// DescribeLaunchTemplates returns the launch templates for the IDs given
+func (s *Simulator) DescribeLaunchTemplates(ctx context.Context, params *ec2.DescribeLaunchTemplatesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeLaunchTemplatesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var templates []et.LaunchTemplate
+	for _, id := range params.LaunchTemplateIds {
+		t, ok := s.templates[id]
+		if !ok {
+			return nil, errors.Errorf("InvalidLaunchTemplateId.NotFound: the launch template ID '%s' does not exist", id)
+		}
+
+		templates = append(templates, et.LaunchTemplate{
+			LaunchTemplateId:     aws.String(t.id),
+			LaunchTemplateName:   aws.String(t.name),
+			DefaultVersionNumber: aws.Int64(t.def),
+			LatestVersionNumber:  aws.Int64(t.latest),
+		})
+	}
+
+	return &ec2.DescribeLaunchTemplatesOutput{
+		LaunchTemplates: templates,
+	}, nil
+}
+
+func (s *Simulator) toEC2Instance(inst *instance) et.Instance {
+	var state et.InstanceStateName
+	switch inst.lifecycleState {
+	case at.LifecycleStatePending, at.LifecycleStateWarmedPending:
+		state = et.InstanceStateNamePending
+	case at.LifecycleStateTerminatingProceed, at.LifecycleStateWarmedTerminatingProceed:
+		state = et.InstanceStateNameShuttingDown
+	case at.LifecycleStateTerminated, at.LifecycleStateWarmedTerminated:
+		state = et.InstanceStateNameTerminated
+	case at.LifecycleStateWarmedStopped, at.LifecycleStateWarmedHibernated:
+		state = et.InstanceStateNameStopped
+	default:
+		state = et.InstanceStateNameRunning
+	}
+
+	launchTime := inst.launchTime
+
+	return et.Instance{
+		InstanceId:       aws.String(inst.id),
+		LaunchTime:       &launchTime,
+		PrivateIpAddress: aws.String(inst.privateIP),
+		Placement: &et.Placement{
+			AvailabilityZone: aws.String(inst.az),
+		},
+		State: &et.InstanceState{
+			Name: state,
+		},
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulator
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancing"
+	lt "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancing/types"
+	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
+	tt "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	"github.com/pkg/errors"
+)
+
+// DescribeTargetHealth returns every instance registered with the target group. Instances are registered once
+// they're InService, start out initial, become healthy after LBHealthyAfter ticks, and drain once terminating
+func (s *Simulator) DescribeTargetHealth(ctx context.Context, params *elasticloadbalancingv2.DescribeTargetHealthInput, optFns ...func(*elasticloadbalancingv2.Options)) (*elasticloadbalancingv2.DescribeTargetHealthOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	arn := aws.ToString(params.TargetGroupArn)
+	var descs []tt.TargetHealthDescription
+	found := false
+
+	for _, g := range s.groups {
+		if !slices.Contains(g.cfg.TargetGroupARNs, arn) {
+			continue
+		}
+		found = true
+
+		for _, inst := range g.instances {
+			var state tt.TargetHealthStateEnum
+			switch {
+			case isTerminating(inst.lifecycleState):
+				state = tt.TargetHealthStateEnumDraining
+			case isLBHealthy(g, inst):
+				state = tt.TargetHealthStateEnumHealthy
+			case inst.lifecycleState == at.LifecycleStateInService:
+				state = tt.TargetHealthStateEnumInitial
+			default:
+				continue
+			}
+			descs = append(descs, targetHealth(inst.id, state))
+		}
+
+		for _, id := range slices.Sorted(maps.Keys(g.draining)) {
+			descs = append(descs, targetHealth(id, tt.TargetHealthStateEnumDraining))
+		}
+	}
+
+	if !found {
+		return nil, errors.Errorf("TargetGroupNotFound: target group '%s' not found", arn)
+	}
+
+	return &elasticloadbalancingv2.DescribeTargetHealthOutput{
+		TargetHealthDescriptions: descs,
+	}, nil
+}
+
+// DescribeTargetGroups returns each of the target groups asked for, with the TargetType of the first ASG attached to it
+func (s *Simulator) DescribeTargetGroups(ctx context.Context, params *elasticloadbalancingv2.DescribeTargetGroupsInput, optFns ...func(*elasticloadbalancingv2.Options)) (*elasticloadbalancingv2.DescribeTargetGroupsOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var groups []tt.TargetGroup
+	for _, arn := range params.TargetGroupArns {
+		i := slices.IndexFunc(s.groups, func(g *group) bool {
+			return slices.Contains(g.cfg.TargetGroupARNs, arn)
+		})
+		if i < 0 {
+			return nil, errors.Errorf("TargetGroupNotFound: target group '%s' not found", arn)
+		}
+
+		targetType := s.groups[i].cfg.TargetType
+		if targetType == "" {
+			targetType = tt.TargetTypeEnumInstance
+		}
+		groups = append(groups, tt.TargetGroup{
+			TargetGroupArn: aws.String(arn),
+			TargetType:     targetType,
+		})
+	}
+
+	return &elasticloadbalancingv2.DescribeTargetGroupsOutput{
+		TargetGroups: groups,
+	}, nil
+}
+
+// DescribeInstanceHealth returns every instance registered with the classic ELB, which is InService once
+// its target groups would see it as healthy, and OutOfService until then and once terminating
+func (s *Simulator) DescribeInstanceHealth(ctx context.Context, params *elasticloadbalancing.DescribeInstanceHealthInput, optFns ...func(*elasticloadbalancing.Options)) (*elasticloadbalancing.DescribeInstanceHealthOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := aws.ToString(params.LoadBalancerName)
+	var states []lt.InstanceState
+	found := false
+
+	for _, g := range s.groups {
+		if !slices.Contains(g.cfg.LoadBalancerNames, name) {
+			continue
+		}
+		found = true
+
+		for _, inst := range g.instances {
+			if inst.lifecycleState != at.LifecycleStateInService && !isTerminating(inst.lifecycleState) {
+				continue
+			}
+
+			state := "OutOfService"
+			if isLBHealthy(g, inst) {
+				state = "InService"
+			}
+			states = append(states, lt.InstanceState{
+				InstanceId: aws.String(inst.id),
+				State:      aws.String(state),
+			})
+		}
+	}
+
+	if !found {
+		return nil, errors.Errorf("LoadBalancerNotFound: there is no ACTIVE Load Balancer named '%s'", name)
+	}
+
+	return &elasticloadbalancing.DescribeInstanceHealthOutput{
+		InstanceStates: states,
+	}, nil
+}
+
+// isLBHealthy returns whether the instance has been InService long enough for its load balancers to see it as healthy
+func isLBHealthy(g *group, inst *instance) bool {
+	return inst.lifecycleState == at.LifecycleStateInService && inst.inServiceTicks >= g.cfg.LBHealthyAfter
+}
+
+func targetHealth(id string, state tt.TargetHealthStateEnum) tt.TargetHealthDescription {
+	return tt.TargetHealthDescription{
+		Target:       &tt.TargetDescription{Id: aws.String(id)},
+		TargetHealth: &tt.TargetHealth{State: state},
+	}
+}
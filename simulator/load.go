@@ -0,0 +1,185 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulator
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	et "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/pkg/errors"
+)
+
+// LoadASG adds an ASG to the simulator as it was observed in AWS, along with its warm pool instances, the EC2
+// instances behind both and every launch template it uses, including those of mixed instances policy overrides.
+// Lifecycle hooks aren't known, so instances already waiting on one move on by themselves, and any hook name is
+// accepted when completing their lifecycle actions
+func (s *Simulator) LoadASG(asg *at.AutoScalingGroup, warm []at.Instance, ec2Insts []*et.Instance, lts []*et.LaunchTemplate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := aws.ToString(asg.AutoScalingGroupName)
+	if s.getGroup(name) != nil {
+		return errors.Errorf("ASG %s already exists", name)
+	}
+
+	g := &group{
+		cfg: ASGConfig{
+			Name:                             name,
+			MinSize:                          aws.ToInt32(asg.MinSize),
+			MaxSize:                          aws.ToInt32(asg.MaxSize),
+			DesiredCapacity:                  aws.ToInt32(asg.DesiredCapacity),
+			AvailabilityZones:                slices.Clone(asg.AvailabilityZones),
+			LaunchConfigurationName:          aws.ToString(asg.LaunchConfigurationName),
+			NewInstancesProtectedFromScaleIn: aws.ToBool(asg.NewInstancesProtectedFromScaleIn),
+			TargetGroupARNs:                  slices.Clone(asg.TargetGroupARNs),
+			LoadBalancerNames:                slices.Clone(asg.LoadBalancerNames),
+		},
+		desired:   aws.ToInt32(asg.DesiredCapacity),
+		draining:  make(map[string]int),
+		warmState: at.LifecycleStateWarmedStopped,
+	}
+
+	for _, process := range asg.SuspendedProcesses {
+		g.suspended = append(g.suspended, aws.ToString(process.ProcessName))
+	}
+
+	for _, tag := range asg.Tags {
+		if g.cfg.Tags == nil {
+			g.cfg.Tags = make(map[string]string)
+		}
+		g.cfg.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	if len(g.cfg.AvailabilityZones) == 0 {
+		g.cfg.AvailabilityZones = []string{defaultAZ}
+	}
+
+	for _, lt := range lts {
+		if _, ok := s.templates[aws.ToString(lt.LaunchTemplateId)]; !ok {
+			s.templates[aws.ToString(lt.LaunchTemplateId)] = &template{
+				id:     aws.ToString(lt.LaunchTemplateId),
+				name:   aws.ToString(lt.LaunchTemplateName),
+				def:    aws.ToInt64(lt.DefaultVersionNumber),
+				latest: aws.ToInt64(lt.LatestVersionNumber),
+			}
+		}
+	}
+
+	spec := asg.LaunchTemplate
+	var policy *at.LaunchTemplate
+	if spec == nil && asg.MixedInstancesPolicy != nil && asg.MixedInstancesPolicy.LaunchTemplate != nil {
+		policy = asg.MixedInstancesPolicy.LaunchTemplate
+		spec = policy.LaunchTemplateSpecification
+	}
+
+	if spec != nil {
+		t, ok := s.templates[aws.ToString(spec.LaunchTemplateId)]
+		if !ok {
+			return errors.Errorf("ASG %s uses launch template %s but it wasn't given", name, aws.ToString(spec.LaunchTemplateId))
+		}
+		g.template = t
+
+		g.cfg.LaunchTemplateVersion = aws.ToString(spec.Version)
+		if g.cfg.LaunchTemplateVersion == "" {
+			g.cfg.LaunchTemplateVersion = "$Default"
+		}
+	}
+
+	if policy != nil {
+		for _, ltOverride := range policy.Overrides {
+			if ltOverride.InstanceType == nil {
+				g.anyType = true
+				continue
+			}
+
+			o := override{instanceType: aws.ToString(ltOverride.InstanceType)}
+			if ltOverride.LaunchTemplateSpecification != nil {
+				t, ok := s.templates[aws.ToString(ltOverride.LaunchTemplateSpecification.LaunchTemplateId)]
+				if !ok {
+					return errors.Errorf("ASG %s overrides %s with launch template %s but it wasn't given", name, o.instanceType, aws.ToString(ltOverride.LaunchTemplateSpecification.LaunchTemplateId))
+				}
+				o.template = t
+				o.version = aws.ToString(ltOverride.LaunchTemplateSpecification.Version)
+			}
+			g.overrides = append(g.overrides, o)
+		}
+	}
+
+	for _, asgInst := range asg.Instances {
+		if strings.HasPrefix(string(asgInst.LifecycleState), "Warmed:") {
+			// Loaded from warm below instead
+			continue
+		}
+		inst := s.loadInstance(name, asgInst, ec2Insts)
+		g.instances = append(g.instances, inst)
+
+		if inst.lifecycleState == at.LifecycleStateInService {
+			g.stats.MinInService++
+		}
+	}
+
+	if cfg := asg.WarmPoolConfiguration; cfg != nil {
+		switch cfg.PoolState {
+		case at.WarmPoolStateRunning:
+			g.warmState = at.LifecycleStateWarmedRunning
+		case at.WarmPoolStateHibernated:
+			g.warmState = at.LifecycleStateWarmedHibernated
+		}
+
+		for _, asgInst := range warm {
+			g.warm = append(g.warm, s.loadInstance(name, asgInst, ec2Insts))
+		}
+		// The pool is kept at the size it was seen at, since how AWS sizes it depends on the max size and desired capacity
+		g.cfg.WarmPoolSize = max(aws.ToInt32(cfg.MinSize), int32(len(warmPool(g))))
+	}
+
+	g.stats.MaxInstances = int32(len(g.instances))
+	g.loaded = true
+	s.groups = append(s.groups, g)
+
+	return nil
+}
+
+func (s *Simulator) loadInstance(asgName string, asgInst at.Instance, ec2Insts []*et.Instance) *instance {
+	id := aws.ToString(asgInst.InstanceId)
+	inst := &instance{
+		id:             id,
+		asgName:        asgName,
+		az:             aws.ToString(asgInst.AvailabilityZone),
+		lifecycleState: asgInst.LifecycleState,
+		instanceType:   aws.ToString(asgInst.InstanceType),
+		lcName:         aws.ToString(asgInst.LaunchConfigurationName),
+		protected:      aws.ToBool(asgInst.ProtectedFromScaleIn),
+	}
+
+	if asgInst.LaunchTemplate != nil {
+		inst.ltID = aws.ToString(asgInst.LaunchTemplate.LaunchTemplateId)
+		inst.ltName = aws.ToString(asgInst.LaunchTemplate.LaunchTemplateName)
+		inst.ltVersion = aws.ToString(asgInst.LaunchTemplate.Version)
+	}
+
+	for _, ec2Inst := range ec2Insts {
+		if aws.ToString(ec2Inst.InstanceId) == id {
+			inst.privateIP = aws.ToString(ec2Inst.PrivateIpAddress)
+			inst.launchTime = aws.ToTime(ec2Inst.LaunchTime)
+		}
+	}
+
+	s.instances[id] = inst
+	return inst
+}
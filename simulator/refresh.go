@@ -0,0 +1,240 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	bouncerAWS "github.com/palantir/bouncer/aws"
+	"github.com/pkg/errors"
+)
+
+const defaultMinHealthyPercentage = 90
+
+// refresh is an instance refresh, which replaces the instances it was started with a batch at a time,
+// keeping MinHealthyPercentage of the desired capacity InService
+type refresh struct {
+	id         string
+	status     at.InstanceRefreshStatus
+	startTime  time.Time
+	endTime    time.Time
+	minHealthy int32
+	// toUpdate is the instances the refresh was started with that it will replace
+	toUpdate []string
+	prefs    *at.RefreshPreferences
+}
+
+// StartInstanceRefresh starts replacing the ASG's instances, or only the old ones if SkipMatching is set
+func (s *Simulator) StartInstanceRefresh(ctx context.Context, params *autoscaling.StartInstanceRefreshInput, optFns ...func(*autoscaling.Options)) (*autoscaling.StartInstanceRefreshOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := s.getGroup(aws.ToString(params.AutoScalingGroupName))
+	if g == nil {
+		return nil, errors.Errorf("ValidationError: AutoScalingGroup name not found - %s", aws.ToString(params.AutoScalingGroupName))
+	}
+	if r := activeRefresh(g); r != nil {
+		return nil, errors.Errorf("InstanceRefreshInProgress: an instance refresh %s is already in progress for ASG %s", r.id, g.cfg.Name)
+	}
+
+	r := &refresh{
+		id:         fmt.Sprintf("%08x-0000-0000-0000-%012x", len(g.refreshes), s.nextID),
+		status:     at.InstanceRefreshStatusPending,
+		startTime:  time.Now(),
+		minHealthy: defaultMinHealthyPercentage,
+		prefs:      params.Preferences,
+	}
+	s.nextID++
+
+	skipMatching := false
+	if params.Preferences != nil {
+		if params.Preferences.MinHealthyPercentage != nil {
+			r.minHealthy = *params.Preferences.MinHealthyPercentage
+		}
+		skipMatching = aws.ToBool(params.Preferences.SkipMatching)
+	}
+
+	for _, inst := range activeInstances(g) {
+		if !skipMatching || s.isOld(g, inst) {
+			r.toUpdate = append(r.toUpdate, inst.id)
+		}
+	}
+
+	g.refreshes = append(g.refreshes, r)
+
+	return &autoscaling.StartInstanceRefreshOutput{
+		InstanceRefreshId: aws.String(r.id),
+	}, nil
+}
+
+// DescribeInstanceRefreshes returns the ASG's instance refreshes, newest first, optionally only those with the IDs given
+func (s *Simulator) DescribeInstanceRefreshes(ctx context.Context, params *autoscaling.DescribeInstanceRefreshesInput, optFns ...func(*autoscaling.Options)) (*autoscaling.DescribeInstanceRefreshesOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := s.getGroup(aws.ToString(params.AutoScalingGroupName))
+	if g == nil {
+		return nil, errors.Errorf("ValidationError: AutoScalingGroup name not found - %s", aws.ToString(params.AutoScalingGroupName))
+	}
+
+	var refreshes []at.InstanceRefresh
+	for i := len(g.refreshes) - 1; i >= 0; i-- {
+		r := g.refreshes[i]
+		if len(params.InstanceRefreshIds) == 0 || slices.Contains(params.InstanceRefreshIds, r.id) {
+			refreshes = append(refreshes, s.toInstanceRefresh(g, r))
+		}
+	}
+
+	return &autoscaling.DescribeInstanceRefreshesOutput{
+		InstanceRefreshes: refreshes,
+	}, nil
+}
+
+// CancelInstanceRefresh stops the ASG's active instance refresh, leaving whatever it's already replaced
+func (s *Simulator) CancelInstanceRefresh(ctx context.Context, params *autoscaling.CancelInstanceRefreshInput, optFns ...func(*autoscaling.Options)) (*autoscaling.CancelInstanceRefreshOutput, error) {
+	r, err := s.stopRefresh(aws.ToString(params.AutoScalingGroupName), at.InstanceRefreshStatusCancelling)
+	if err != nil {
+		return nil, err
+	}
+
+	return &autoscaling.CancelInstanceRefreshOutput{
+		InstanceRefreshId: aws.String(r.id),
+	}, nil
+}
+
+// RollbackInstanceRefresh stops the ASG's active instance refresh. The simulator doesn't model the rollback
+// replacing instances again, so this behaves like a cancel apart from the statuses it goes through
+func (s *Simulator) RollbackInstanceRefresh(ctx context.Context, params *autoscaling.RollbackInstanceRefreshInput, optFns ...func(*autoscaling.Options)) (*autoscaling.RollbackInstanceRefreshOutput, error) {
+	r, err := s.stopRefresh(aws.ToString(params.AutoScalingGroupName), at.InstanceRefreshStatusRollbackInProgress)
+	if err != nil {
+		return nil, err
+	}
+
+	return &autoscaling.RollbackInstanceRefreshOutput{
+		InstanceRefreshId: aws.String(r.id),
+	}, nil
+}
+
+func (s *Simulator) stopRefresh(asgName string, status at.InstanceRefreshStatus) (*refresh, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := s.getGroup(asgName)
+	if g == nil {
+		return nil, errors.Errorf("ValidationError: AutoScalingGroup name not found - %s", asgName)
+	}
+
+	r := activeRefresh(g)
+	if r == nil || r.status == at.InstanceRefreshStatusCancelling || r.status == at.InstanceRefreshStatusRollbackInProgress {
+		return nil, errors.Errorf("ActiveInstanceRefreshNotFound: no in progress or pending instance refresh found for ASG %s", asgName)
+	}
+
+	r.status = status
+	return r, nil
+}
+
+// advanceRefresh moves the ASG's active instance refresh on by one tick, once the ASG has settled from its last batch
+func (s *Simulator) advanceRefresh(g *group) {
+	r := activeRefresh(g)
+	if r == nil {
+		return
+	}
+
+	switch r.status {
+	case at.InstanceRefreshStatusPending:
+		r.status = at.InstanceRefreshStatusInProgress
+		return
+	case at.InstanceRefreshStatusCancelling:
+		r.finish(at.InstanceRefreshStatusCancelled)
+		return
+	case at.InstanceRefreshStatusRollbackInProgress:
+		r.finish(at.InstanceRefreshStatusRollbackSuccessful)
+		return
+	}
+
+	for _, inst := range g.instances {
+		if !isLBHealthy(g, inst) {
+			return
+		}
+	}
+	if int32(len(g.instances)) != g.desired {
+		return
+	}
+
+	remaining := s.remainingToUpdate(r)
+	if len(remaining) == 0 {
+		r.finish(at.InstanceRefreshStatusSuccessful)
+		return
+	}
+
+	minHealthy := (g.desired*r.minHealthy + 99) / 100
+	batch := max(1, int32(len(g.instances))-minHealthy)
+	for _, inst := range remaining[:min(int(batch), len(remaining))] {
+		inst.lifecycleState = at.LifecycleStateTerminating
+	}
+}
+
+// remainingToUpdate returns the instances the refresh still has to replace
+func (s *Simulator) remainingToUpdate(r *refresh) []*instance {
+	var remaining []*instance
+	for _, id := range r.toUpdate {
+		if inst, ok := s.instances[id]; ok && !isTerminating(inst.lifecycleState) {
+			remaining = append(remaining, inst)
+		}
+	}
+	return remaining
+}
+
+func (r *refresh) finish(status at.InstanceRefreshStatus) {
+	r.status = status
+	r.endTime = time.Now()
+}
+
+func (s *Simulator) toInstanceRefresh(g *group, r *refresh) at.InstanceRefresh {
+	remaining := len(s.remainingToUpdate(r))
+	percent := int32(100)
+	if len(r.toUpdate) > 0 {
+		percent = int32((len(r.toUpdate) - remaining) * 100 / len(r.toUpdate))
+	}
+
+	refresh := at.InstanceRefresh{
+		AutoScalingGroupName: aws.String(g.cfg.Name),
+		InstanceRefreshId:    aws.String(r.id),
+		Status:               r.status,
+		StartTime:            aws.Time(r.startTime),
+		PercentageComplete:   aws.Int32(percent),
+		InstancesToUpdate:    aws.Int32(int32(remaining)),
+		Preferences:          r.prefs,
+	}
+	if !r.endTime.IsZero() {
+		refresh.EndTime = aws.Time(r.endTime)
+	}
+	return refresh
+}
+
+func activeRefresh(g *group) *refresh {
+	for _, r := range g.refreshes {
+		if bouncerAWS.IsInstanceRefreshActive(r.status) {
+			return r
+		}
+	}
+	return nil
+}
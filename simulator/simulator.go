@@ -0,0 +1,776 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package simulator is an in-memory model of autoscaling groups and their EC2 instances which
+// satisfies the aws.ASGAPI and aws.EC2API interfaces, so runners can be driven without AWS.
+package simulator
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	tt "github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2/types"
+	"github.com/palantir/bouncer/aws"
+	"github.com/pkg/errors"
+)
+
+const defaultAZ = "us-east-1a"
+
+var (
+	_ aws.ASGAPI   = (*Simulator)(nil)
+	_ aws.EC2API   = (*Simulator)(nil)
+	_ aws.ELBV2API = (*Simulator)(nil)
+	_ aws.ELBAPI   = (*Simulator)(nil)
+)
+
+// ASGConfig describes an ASG to add to the simulator
+type ASGConfig struct {
+	Name            string
+	MinSize         int32
+	MaxSize         int32
+	DesiredCapacity int32
+	// AvailabilityZones new instances are balanced across, defaults to a single AZ
+	AvailabilityZones []string
+	// StartingAZs places the starting instances, oldest first, instead of balancing them across AvailabilityZones
+	StartingAZs []string
+	// LaunchTemplateVersion is the version set on the ASG, defaults to $Latest
+	LaunchTemplateVersion string
+	// LaunchConfigurationName makes the ASG use launch configurations instead of a launch template
+	LaunchConfigurationName string
+	// PendingHook and TerminateHook, if set, make instances pass through Pending:Wait and Terminating:Wait
+	PendingHook   string
+	TerminateHook string
+	Tags          map[string]string
+	// SuspendedProcesses are the scaling processes suspended on the ASG to start with
+	SuspendedProcesses []string
+	// NewInstancesProtectedFromScaleIn has every instance launched, including the starting ones, protected from scale-in
+	NewInstancesProtectedFromScaleIn bool
+	// TargetGroupARNs and LoadBalancerNames attach load balancers, which every instance registers with once it's InService
+	TargetGroupARNs   []string
+	LoadBalancerNames []string
+	// TargetType is the type of the ASG's target groups, defaults to instance
+	TargetType tt.TargetTypeEnum
+	// LBHealthyAfter is how many ticks an instance must be InService before its load balancers see it as healthy
+	LBHealthyAfter int
+	// DrainingTicks is how many ticks a target stays draining in its target groups once its instance has terminated
+	DrainingTicks int
+	// InstanceTypes gives the ASG a mixed instances policy which overrides these instance types, all on its launch
+	// template to start with.  New instances are launched as the first
+	InstanceTypes []string
+	// WarmPoolSize gives the ASG a warm pool of stopped instances, kept topped up on its current launch template or
+	// configuration.  Scale-outs take from it before launching anything new
+	WarmPoolSize int32
+}
+
+// Stats are the extremes an ASG has been through since it was added
+// MinInService only counts instances healthy in the ASG's load balancers, if it has any
+type Stats struct {
+	MaxInstances int32
+	MinInService int32
+}
+
+type template struct {
+	id     string
+	name   string
+	def    int64
+	latest int64
+}
+
+// override is an instance type in an ASG's mixed instances policy, and the launch template it's launched from if it
+// isn't the ASG's own
+type override struct {
+	instanceType string
+	template     *template
+	version      string
+}
+
+type instance struct {
+	id             string
+	asgName        string
+	az             string
+	instanceType   string
+	privateIP      string
+	launchTime     time.Time
+	lifecycleState at.LifecycleState
+	ltID           string
+	ltName         string
+	ltVersion      string
+	lcName         string
+	protected      bool
+	// inServiceTicks is how many ticks the instance has spent InService
+	inServiceTicks int
+}
+
+type group struct {
+	cfg       ASGConfig
+	desired   int32
+	template  *template
+	instances []*instance
+	stats     Stats
+	// loaded is set on ASGs loaded from AWS, whose lifecycle hook names aren't known
+	loaded bool
+	// draining maps terminated instances still draining from the target groups to the ticks they have left
+	draining  map[string]int
+	refreshes []*refresh
+	// suspended is the scaling processes currently suspended
+	suspended []string
+	// minInServiceByAZ is the fewest instances each AZ has had in service, filled in on the first tick
+	minInServiceByAZ map[string]int32
+	// warm is the warm pool, which doesn't count towards desired capacity
+	warm []*instance
+	// warmState is the state warm pool instances settle in once they're ready
+	warmState at.LifecycleState
+	// overrides is the ASG's mixed instances policy, which restricts the instance types it launches to those listed,
+	// unless anyType is set because some were picked by attributes instead
+	overrides []override
+	anyType   bool
+}
+
+// Simulator holds the modelled state of all ASGs, launch templates, and instances.
+// Every call to DescribeAutoScalingGroups advances the model by one tick
+type Simulator struct {
+	mu        sync.Mutex
+	groups    []*group
+	instances map[string]*instance
+	templates map[string]*template
+	nextID    int
+}
+
+// New returns an empty Simulator
+func New() *Simulator {
+	return &Simulator{
+		instances: make(map[string]*instance),
+		templates: make(map[string]*template),
+	}
+}
+
+// NewWithOldASGs returns a Simulator with each of the given ASGs added, then moved onto a new launch template version
+// or launch configuration, so every instance they start with is old and due to be replaced
+func NewWithOldASGs(cfgs ...ASGConfig) (*Simulator, error) {
+	s := New()
+	for _, cfg := range cfgs {
+		err := s.AddASG(cfg)
+		if err != nil {
+			return nil, err
+		}
+		err = s.NewLaunchTemplateVersion(cfg.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Clients returns an aws.Clients backed by this simulator
+func (s *Simulator) Clients() *aws.Clients {
+	return &aws.Clients{
+		ASGClient:   s,
+		EC2Client:   s,
+		ELBV2Client: s,
+		ELBClient:   s,
+	}
+}
+
+// AddASG creates an ASG with DesiredCapacity InService instances on its current launch template version
+func (s *Simulator) AddASG(cfg ASGConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.getGroup(cfg.Name) != nil {
+		return errors.Errorf("ASG %s already exists", cfg.Name)
+	}
+
+	if cfg.DesiredCapacity < cfg.MinSize || cfg.DesiredCapacity > cfg.MaxSize {
+		return errors.Errorf("desired capacity %d of ASG %s must be between min %d and max %d", cfg.DesiredCapacity, cfg.Name, cfg.MinSize, cfg.MaxSize)
+	}
+
+	if len(cfg.AvailabilityZones) == 0 {
+		cfg.AvailabilityZones = []string{defaultAZ}
+	}
+
+	g := &group{
+		cfg:       cfg,
+		desired:   cfg.DesiredCapacity,
+		draining:  make(map[string]int),
+		suspended: slices.Clone(cfg.SuspendedProcesses),
+		warmState: at.LifecycleStateWarmedStopped,
+	}
+
+	if cfg.LaunchConfigurationName == "" {
+		if cfg.LaunchTemplateVersion == "" {
+			g.cfg.LaunchTemplateVersion = "$Latest"
+		}
+
+		t := &template{
+			id:     fmt.Sprintf("lt-%017d", len(s.templates)),
+			name:   cfg.Name,
+			def:    1,
+			latest: 1,
+		}
+		s.templates[t.id] = t
+		g.template = t
+	}
+
+	if len(cfg.InstanceTypes) != 0 {
+		if g.template == nil {
+			return errors.Errorf("ASG %s needs a launch template for a mixed instances policy", cfg.Name)
+		}
+		for _, instanceType := range cfg.InstanceTypes {
+			g.overrides = append(g.overrides, override{instanceType: instanceType})
+		}
+	}
+
+	if len(cfg.StartingAZs) != 0 && int32(len(cfg.StartingAZs)) != cfg.DesiredCapacity {
+		return errors.Errorf("ASG %s has %d starting AZs for a desired capacity of %d", cfg.Name, len(cfg.StartingAZs), cfg.DesiredCapacity)
+	}
+
+	for i := range cfg.DesiredCapacity {
+		inst := s.launch(g)
+		if len(cfg.StartingAZs) != 0 {
+			inst.az = cfg.StartingAZs[i]
+		}
+		inst.lifecycleState = at.LifecycleStateInService
+		inst.launchTime = inst.launchTime.Add(-time.Hour)
+		inst.inServiceTicks = cfg.LBHealthyAfter
+	}
+
+	for range cfg.WarmPoolSize {
+		inst := s.launchWarm(g)
+		inst.lifecycleState = g.warmState
+		inst.launchTime = inst.launchTime.Add(-time.Hour)
+	}
+
+	g.stats = Stats{
+		MaxInstances: cfg.DesiredCapacity,
+		MinInService: cfg.DesiredCapacity,
+	}
+
+	s.groups = append(s.groups, g)
+
+	return nil
+}
+
+// NewLaunchTemplateVersion publishes a new version of the ASG's launch template, or swaps its launch
+// configuration for a new one, making all its current instances old
+func (s *Simulator) NewLaunchTemplateVersion(asgName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := s.getGroup(asgName)
+	if g == nil {
+		return errors.Errorf("ASG %s not found", asgName)
+	}
+
+	if g.template == nil {
+		g.cfg.LaunchConfigurationName = fmt.Sprintf("%s-%d", g.cfg.Name, s.nextID)
+		s.nextID++
+		return nil
+	}
+
+	g.template.latest++
+	g.template.def = g.template.latest
+	if _, err := strconv.ParseInt(g.cfg.LaunchTemplateVersion, 10, 64); err == nil {
+		g.cfg.LaunchTemplateVersion = strconv.FormatInt(g.template.latest, 10)
+	}
+
+	return nil
+}
+
+// SetInstanceTypes replaces the instance types overridden in the given ASG's mixed instances policy, making any
+// instance of a type no longer listed old.  Types still listed keep their launch template
+func (s *Simulator) SetInstanceTypes(asgName string, instanceTypes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := s.getGroup(asgName)
+	if g == nil {
+		return errors.Errorf("ASG %s not found", asgName)
+	}
+	if g.template == nil {
+		return errors.Errorf("ASG %s needs a launch template for a mixed instances policy", asgName)
+	}
+
+	var overrides []override
+	for _, instanceType := range instanceTypes {
+		o := override{instanceType: instanceType}
+		for _, existing := range g.overrides {
+			if existing.instanceType == instanceType {
+				o = existing
+			}
+		}
+		overrides = append(overrides, o)
+	}
+	g.overrides = overrides
+
+	return nil
+}
+
+// NewOverrideTemplate gives the instance type overridden in the given ASG's mixed instances policy a launch template
+// of its own, on $Latest, making every instance of that type old
+func (s *Simulator) NewOverrideTemplate(asgName string, instanceType string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := s.getGroup(asgName)
+	if g == nil {
+		return errors.Errorf("ASG %s not found", asgName)
+	}
+
+	for i, o := range g.overrides {
+		if o.instanceType == instanceType {
+			t := &template{
+				id:     fmt.Sprintf("lt-%017d", len(s.templates)),
+				name:   fmt.Sprintf("%s-%s", asgName, instanceType),
+				def:    1,
+				latest: 1,
+			}
+			s.templates[t.id] = t
+			g.overrides[i].template = t
+			g.overrides[i].version = "$Latest"
+			return nil
+		}
+	}
+
+	return errors.Errorf("ASG %s doesn't override instance type %s", asgName, instanceType)
+}
+
+// DesiredCapacity returns the current desired capacity of the given ASG
+func (s *Simulator) DesiredCapacity(asgName string) int32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.getGroup(asgName).desired
+}
+
+// InstanceStates returns the lifecycle state of each instance in the given ASG, keyed by instance ID
+func (s *Simulator) InstanceStates(asgName string) map[string]at.LifecycleState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := make(map[string]at.LifecycleState)
+	for _, inst := range s.getGroup(asgName).instances {
+		states[inst.id] = inst.lifecycleState
+	}
+	return states
+}
+
+// OldInstanceCount returns how many instances in the ASG are not on its current launch template or configuration
+func (s *Simulator) OldInstanceCount(asgName string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := s.getGroup(asgName)
+	count := 0
+	for _, inst := range g.instances {
+		if s.isOld(g, inst) {
+			count++
+		}
+	}
+	return count
+}
+
+// WarmPoolStates returns the lifecycle state of each instance in the given ASG's warm pool, keyed by instance ID
+func (s *Simulator) WarmPoolStates(asgName string) map[string]at.LifecycleState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := make(map[string]at.LifecycleState)
+	for _, inst := range s.getGroup(asgName).warm {
+		states[inst.id] = inst.lifecycleState
+	}
+	return states
+}
+
+// OldWarmPoolCount returns how many instances in the ASG's warm pool are not on its current launch template or configuration
+func (s *Simulator) OldWarmPoolCount(asgName string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := s.getGroup(asgName)
+	count := 0
+	for _, inst := range g.warm {
+		if s.isOld(g, inst) {
+			count++
+		}
+	}
+	return count
+}
+
+// Stats returns the extremes the given ASG has been through
+func (s *Simulator) Stats(asgName string) Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.getGroup(asgName).stats
+}
+
+// SuspendedProcesses returns the scaling processes currently suspended on the given ASG
+func (s *Simulator) SuspendedProcesses(asgName string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Sorted(slices.Values(s.getGroup(asgName).suspended))
+}
+
+// ProtectedInstances returns the IDs of the given ASG's instances that are protected from scale-in
+func (s *Simulator) ProtectedInstances(asgName string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []string
+	for _, inst := range s.getGroup(asgName).instances {
+		if inst.protected {
+			ids = append(ids, inst.id)
+		}
+	}
+	return ids
+}
+
+// MinInServiceByAZ returns the fewest instances each of the given ASG's AZs has had in service
+func (s *Simulator) MinInServiceByAZ(asgName string) map[string]int32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return maps.Clone(s.getGroup(asgName).minInServiceByAZ)
+}
+
+// Tick advances every instance one step through its lifecycle, then launches or scales in instances
+// so that each ASG's active instance count matches its desired capacity
+func (s *Simulator) Tick() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tick()
+}
+
+func (s *Simulator) tick() {
+	for _, g := range s.groups {
+		for id, left := range g.draining {
+			if left <= 1 {
+				delete(g.draining, id)
+			} else {
+				g.draining[id] = left - 1
+			}
+		}
+
+		var remaining []*instance
+		for _, inst := range g.instances {
+			if s.advance(g, inst) {
+				remaining = append(remaining, inst)
+			} else if len(g.cfg.TargetGroupARNs) > 0 && g.cfg.DrainingTicks > 0 {
+				g.draining[inst.id] = g.cfg.DrainingTicks
+			}
+		}
+		g.instances = remaining
+
+		var warm []*instance
+		for _, inst := range g.warm {
+			if s.advanceWarm(g, inst) {
+				warm = append(warm, inst)
+			}
+		}
+		g.warm = warm
+
+		active := activeInstances(g)
+		for i := int32(len(active)); i < g.desired; i++ {
+			s.launch(g)
+		}
+		for i := g.desired; i < int32(len(active)); i++ {
+			victim := s.scaleInVictim(g)
+			if victim == nil {
+				break
+			}
+			victim.lifecycleState = at.LifecycleStateTerminating
+		}
+
+		for i := int32(len(warmPool(g))); i < g.cfg.WarmPoolSize; i++ {
+			s.launchWarm(g)
+		}
+
+		s.advanceRefresh(g)
+
+		s.updateStats(g)
+	}
+}
+
+// advance moves an instance one step through its lifecycle, returning false once it's fully terminated
+func (s *Simulator) advance(g *group, inst *instance) bool {
+	switch inst.lifecycleState {
+	case at.LifecycleStateInService:
+		inst.inServiceTicks++
+	case at.LifecycleStatePending:
+		if g.cfg.PendingHook != "" {
+			inst.lifecycleState = at.LifecycleStatePendingWait
+		} else {
+			inst.lifecycleState = at.LifecycleStateInService
+		}
+	case at.LifecycleStatePendingWait, at.LifecycleStatePendingProceed:
+		inst.lifecycleState = at.LifecycleStateInService
+	case at.LifecycleStateTerminating:
+		if g.cfg.TerminateHook != "" {
+			inst.lifecycleState = at.LifecycleStateTerminatingWait
+		} else {
+			inst.lifecycleState = at.LifecycleStateTerminatingProceed
+		}
+	case at.LifecycleStateTerminatingWait:
+		inst.lifecycleState = at.LifecycleStateTerminatingProceed
+	case at.LifecycleStateEnteringStandby:
+		inst.lifecycleState = at.LifecycleStateStandby
+	case at.LifecycleStateTerminatingProceed:
+		inst.lifecycleState = at.LifecycleStateTerminated
+		return false
+	}
+	return true
+}
+
+// advanceWarm moves a warm pool instance one step through its lifecycle, returning false once it's fully terminated
+func (s *Simulator) advanceWarm(g *group, inst *instance) bool {
+	switch inst.lifecycleState {
+	case at.LifecycleStateWarmedPending, at.LifecycleStateWarmedPendingWait, at.LifecycleStateWarmedPendingProceed:
+		inst.lifecycleState = g.warmState
+	case at.LifecycleStateWarmedTerminating, at.LifecycleStateWarmedTerminatingWait:
+		inst.lifecycleState = at.LifecycleStateWarmedTerminatingProceed
+	case at.LifecycleStateWarmedTerminatingProceed:
+		inst.lifecycleState = at.LifecycleStateWarmedTerminated
+		return false
+	}
+	return true
+}
+
+// launch brings an instance into service, taking the first ready one from the warm pool if there is one.  Those keep
+// whatever they were launched with, so an old warm pool hands out old instances
+func (s *Simulator) launch(g *group) *instance {
+	for i, inst := range g.warm {
+		if inst.lifecycleState == g.warmState {
+			g.warm = slices.Delete(g.warm, i, i+1)
+			inst.lifecycleState = at.LifecycleStatePending
+			inst.protected = g.cfg.NewInstancesProtectedFromScaleIn
+			g.instances = append(g.instances, inst)
+			return inst
+		}
+	}
+
+	inst := s.newInstance(g)
+	g.instances = append(g.instances, inst)
+	return inst
+}
+
+// launchWarm adds a new instance to the warm pool
+func (s *Simulator) launchWarm(g *group) *instance {
+	inst := s.newInstance(g)
+	inst.lifecycleState = at.LifecycleStateWarmedPending
+	g.warm = append(g.warm, inst)
+	return inst
+}
+
+func (s *Simulator) newInstance(g *group) *instance {
+	// Skip over IDs taken by instances loaded from AWS
+	id := fmt.Sprintf("i-%017x", s.nextID)
+	for s.instances[id] != nil {
+		s.nextID++
+		id = fmt.Sprintf("i-%017x", s.nextID)
+	}
+	s.nextID++
+
+	inst := &instance{
+		id:             id,
+		asgName:        g.cfg.Name,
+		az:             s.leastPopulatedAZ(g),
+		privateIP:      fmt.Sprintf("10.0.%d.%d", (s.nextID/250)%250, s.nextID%250+1),
+		launchTime:     time.Now(),
+		lifecycleState: at.LifecycleStatePending,
+		lcName:         g.cfg.LaunchConfigurationName,
+		protected:      g.cfg.NewInstancesProtectedFromScaleIn,
+	}
+
+	if len(g.overrides) != 0 {
+		inst.instanceType = g.overrides[0].instanceType
+	}
+
+	if g.template != nil {
+		t, version := s.launchTemplate(g, inst.instanceType)
+		inst.ltID = t.id
+		inst.ltName = t.name
+		inst.ltVersion = version
+	}
+
+	s.instances[id] = inst
+	return inst
+}
+
+// scaleInVictim approximates the default termination policy: most populated AZ first, then instances
+// not on the current launch template or configuration, then the oldest.  Instances protected from scale-in
+// are never picked, so it returns nil if they all are
+func (s *Simulator) scaleInVictim(g *group) *instance {
+	active := activeInstances(g)
+	azCounts := make(map[string]int)
+	for _, inst := range active {
+		azCounts[inst.az]++
+	}
+
+	active = slices.DeleteFunc(active, func(inst *instance) bool {
+		return inst.protected
+	})
+	if len(active) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(active, func(i, j int) bool {
+		a, b := active[i], active[j]
+		if azCounts[a.az] != azCounts[b.az] {
+			return azCounts[a.az] > azCounts[b.az]
+		}
+		if oldA, oldB := s.isOld(g, a), s.isOld(g, b); oldA != oldB {
+			return oldA
+		}
+		return a.launchTime.Before(b.launchTime)
+	})
+
+	return active[0]
+}
+
+func (s *Simulator) leastPopulatedAZ(g *group) string {
+	azCounts := make(map[string]int)
+	for _, inst := range activeInstances(g) {
+		azCounts[inst.az]++
+	}
+
+	best := g.cfg.AvailabilityZones[0]
+	for _, az := range g.cfg.AvailabilityZones {
+		if azCounts[az] < azCounts[best] {
+			best = az
+		}
+	}
+	return best
+}
+
+// launchTemplate returns the launch template instances of the given type are launched from, and the version they get
+func (s *Simulator) launchTemplate(g *group, instanceType string) (*template, string) {
+	for _, o := range g.overrides {
+		if o.instanceType == instanceType && o.template != nil {
+			return o.template, resolveVersion(o.template, o.version)
+		}
+	}
+	return g.template, resolveVersion(g.template, g.cfg.LaunchTemplateVersion)
+}
+
+func resolveVersion(t *template, version string) string {
+	switch version {
+	case "$Latest":
+		return strconv.FormatInt(t.latest, 10)
+	case "$Default", "":
+		return strconv.FormatInt(t.def, 10)
+	default:
+		return version
+	}
+}
+
+func (s *Simulator) isOld(g *group, inst *instance) bool {
+	if g.template == nil {
+		return inst.lcName != g.cfg.LaunchConfigurationName
+	}
+
+	if len(g.overrides) != 0 && !g.anyType && !slices.ContainsFunc(g.overrides, func(o override) bool {
+		return o.instanceType == inst.instanceType
+	}) {
+		return true
+	}
+
+	t, version := s.launchTemplate(g, inst.instanceType)
+	return inst.ltID != t.id || inst.ltVersion != version
+}
+
+func (s *Simulator) updateStats(g *group) {
+	inService := int32(0)
+	inServiceByAZ := make(map[string]int32)
+	for _, az := range g.cfg.AvailabilityZones {
+		inServiceByAZ[az] = 0
+	}
+	for _, inst := range g.instances {
+		if isLBHealthy(g, inst) {
+			inService++
+			inServiceByAZ[inst.az]++
+		}
+	}
+
+	if g.minInServiceByAZ == nil {
+		g.minInServiceByAZ = inServiceByAZ
+	} else {
+		for az, count := range inServiceByAZ {
+			if least, ok := g.minInServiceByAZ[az]; !ok || count < least {
+				g.minInServiceByAZ[az] = count
+			}
+		}
+	}
+
+	g.stats.MaxInstances = max(g.stats.MaxInstances, int32(len(g.instances)))
+	g.stats.MinInService = min(g.stats.MinInService, inService)
+}
+
+func (s *Simulator) getGroup(name string) *group {
+	for _, g := range s.groups {
+		if g.cfg.Name == name {
+			return g
+		}
+	}
+	return nil
+}
+
+func isTerminating(state at.LifecycleState) bool {
+	switch state {
+	case at.LifecycleStateTerminating, at.LifecycleStateTerminatingWait, at.LifecycleStateTerminatingProceed, at.LifecycleStateTerminated:
+		return true
+	}
+	return false
+}
+
+func isWarmTerminating(state at.LifecycleState) bool {
+	switch state {
+	case at.LifecycleStateWarmedTerminating, at.LifecycleStateWarmedTerminatingWait, at.LifecycleStateWarmedTerminatingProceed, at.LifecycleStateWarmedTerminated:
+		return true
+	}
+	return false
+}
+
+// warmPool returns the warm pool instances that aren't on their way out
+func warmPool(g *group) []*instance {
+	var warm []*instance
+	for _, inst := range g.warm {
+		if !isWarmTerminating(inst.lifecycleState) {
+			warm = append(warm, inst)
+		}
+	}
+	return warm
+}
+
+func isStandby(state at.LifecycleState) bool {
+	return state == at.LifecycleStateEnteringStandby || state == at.LifecycleStateStandby
+}
+
+// activeInstances returns the instances that count towards the ASG's desired capacity
+func activeInstances(g *group) []*instance {
+	var active []*instance
+	for _, inst := range g.instances {
+		if !isTerminating(inst.lifecycleState) && !isStandby(inst.lifecycleState) {
+			active = append(active, inst)
+		}
+	}
+	return active
+}
@@ -0,0 +1,95 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLifecycle(t *testing.T) {
+	ctx := context.Background()
+	sim := New()
+	require.NoError(t, sim.AddASG(ASGConfig{
+		Name:            "test-asg",
+		MinSize:         1,
+		MaxSize:         2,
+		DesiredCapacity: 1,
+		PendingHook:     "pending-hook",
+		TerminateHook:   "terminate-hook",
+	}))
+	require.NoError(t, sim.NewLaunchTemplateVersion("test-asg"))
+	assert.Equal(t, 1, sim.OldInstanceCount("test-asg"))
+
+	var oldID string
+	for id := range sim.InstanceStates("test-asg") {
+		oldID = id
+	}
+
+	// Can't decrement below min size
+	_, err := sim.TerminateInstanceInAutoScalingGroup(ctx, &autoscaling.TerminateInstanceInAutoScalingGroupInput{
+		InstanceId:                     aws.String(oldID),
+		ShouldDecrementDesiredCapacity: aws.Bool(true),
+	})
+	assert.Error(t, err)
+
+	_, err = sim.SetDesiredCapacity(ctx, &autoscaling.SetDesiredCapacityInput{
+		AutoScalingGroupName: aws.String("test-asg"),
+		DesiredCapacity:      aws.Int32(3),
+	})
+	assert.Error(t, err)
+
+	_, err = sim.SetDesiredCapacity(ctx, &autoscaling.SetDesiredCapacityInput{
+		AutoScalingGroupName: aws.String("test-asg"),
+		DesiredCapacity:      aws.Int32(2),
+	})
+	require.NoError(t, err)
+
+	var newID string
+	for _, want := range []at.LifecycleState{at.LifecycleStatePending, at.LifecycleStatePendingWait, at.LifecycleStateInService} {
+		sim.Tick()
+		states := sim.InstanceStates("test-asg")
+		require.Len(t, states, 2)
+		for id, state := range states {
+			if id != oldID {
+				newID = id
+				assert.Equal(t, want, state)
+			}
+		}
+	}
+	assert.Equal(t, 1, sim.OldInstanceCount("test-asg"))
+
+	_, err = sim.TerminateInstanceInAutoScalingGroup(ctx, &autoscaling.TerminateInstanceInAutoScalingGroupInput{
+		InstanceId:                     aws.String(oldID),
+		ShouldDecrementDesiredCapacity: aws.Bool(true),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), sim.DesiredCapacity("test-asg"))
+
+	for _, want := range []at.LifecycleState{at.LifecycleStateTerminatingWait, at.LifecycleStateTerminatingProceed} {
+		sim.Tick()
+		assert.Equal(t, want, sim.InstanceStates("test-asg")[oldID])
+	}
+
+	sim.Tick()
+	assert.Equal(t, map[string]at.LifecycleState{newID: at.LifecycleStateInService}, sim.InstanceStates("test-asg"))
+	assert.Equal(t, Stats{MaxInstances: 2, MinInService: 1}, sim.Stats("test-asg"))
+}
@@ -22,6 +22,9 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// Mode is the name this runner is invoked by
+const Mode = "slow-canary"
+
 // Runner holds data for a particular slow-canary run
 // Note that in the slow-canary case, asgs will always be of length 1
 type Runner struct {
@@ -30,7 +33,7 @@ type Runner struct {
 
 // NewRunner instantiates a new slow-canary runner
 func NewRunner(ctx context.Context, opts *bouncer.RunnerOpts) (*Runner, error) {
-	br, err := bouncer.NewBaseRunner(ctx, opts)
+	br, err := bouncer.NewBaseRunner(ctx, Mode, opts)
 	if err != nil {
 		return nil, errors.Wrap(err, "error getting base runner")
 	}
@@ -56,11 +59,11 @@ func (r *Runner) ValidatePrereqs(ctx context.Context) error {
 	}
 
 	for _, actualAsg := range asgSet.ASGs {
-		if actualAsg.DesiredASG.DesiredCapacity != *actualAsg.ASG.DesiredCapacity {
+		if actualAsg.DesiredASG.DesiredCapacity != r.StartingDesiredCapacity(actualAsg) {
 			log.WithFields(log.Fields{
 				"ASG":                     *actualAsg.ASG.AutoScalingGroupName,
 				"desired_capacity given":  actualAsg.DesiredASG.DesiredCapacity,
-				"desired_capacity actual": *actualAsg.ASG.DesiredCapacity,
+				"desired_capacity actual": r.StartingDesiredCapacity(actualAsg),
 			}).Error("Desired capacity given must be equal to starting desired_capacity of ASG")
 			return errors.New("error validating initial ASG state")
 		}
@@ -105,7 +108,10 @@ func (r *Runner) Run() error {
 		}
 
 		if asgSet.IsTransient() {
-			r.Sleep(ctx)
+			err = r.WaitOrRollBack(ctx)
+			if err != nil {
+				return err
+			}
 			continue
 		}
 
@@ -134,7 +140,10 @@ func (r *Runner) Run() error {
 
 			ctx, cancel = r.NewContext()
 			defer cancel()
-			r.Sleep(ctx)
+			err = r.WaitOrRollBack(ctx)
+			if err != nil {
+				return err
+			}
 
 			continue
 		} else if *curDesiredCapacity == *finDesiredCapacity+1 {
@@ -163,7 +172,10 @@ func (r *Runner) Run() error {
 
 				ctx, cancel = r.NewContext()
 				defer cancel()
-				r.Sleep(ctx)
+				err = r.WaitOrRollBack(ctx)
+				if err != nil {
+					return err
+				}
 
 				continue
 			}
@@ -173,15 +185,17 @@ func (r *Runner) Run() error {
 				"ASG": *asg.ASG.AutoScalingGroupName,
 			}).Info("Killing an old node, and letting AWS replace it")
 			decrement := false
-			oldInstances := asgSet.GetOldInstances()
-			err := r.KillInstance(ctx, oldInstances[0], &decrement)
+			err := r.KillInstance(ctx, asgSet.GetBestOldInstance(), &decrement)
 			if err != nil {
 				return errors.Wrap(err, "error killing instance")
 			}
 
 			ctx, cancel = r.NewContext()
 			defer cancel()
-			r.Sleep(ctx)
+			err = r.WaitOrRollBack(ctx)
+			if err != nil {
+				return err
+			}
 
 			continue
 		}
@@ -0,0 +1,51 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package slowcanary
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/palantir/bouncer/bouncer"
+	"github.com/palantir/bouncer/simulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	sim, err := simulator.NewWithOldASGs(simulator.ASGConfig{
+		Name:            "test-asg",
+		MinSize:         3,
+		MaxSize:         4,
+		DesiredCapacity: 3,
+	})
+	require.NoError(t, err)
+
+	r, err := NewRunner(ctx, &bouncer.RunnerOpts{
+		AsgString:     "test-asg:3",
+		ItemTimeout:   time.Minute,
+		Clients:       sim.Clients(),
+		CheckInterval: time.Millisecond,
+	})
+	require.NoError(t, err)
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	require.NoError(t, r.Run())
+
+	assert.Equal(t, 0, sim.OldInstanceCount("test-asg"))
+	assert.Len(t, sim.InstanceStates("test-asg"), 3)
+	assert.Equal(t, int32(3), sim.DesiredCapacity("test-asg"))
+	assert.Equal(t, simulator.Stats{MaxInstances: 5, MinInService: 3}, sim.Stats("test-asg"))
+}
@@ -0,0 +1,259 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package standby
+
+import (
+	"context"
+	"time"
+
+	"github.com/palantir/bouncer/bouncer"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Mode is the name this runner is invoked by
+const Mode = "standby"
+
+// Runner holds data for a particular standby run
+// Note that in the standby case, every ASG given is bounced as one pool, like in batch-canary
+type Runner struct {
+	bouncer.BaseRunner
+	batchSize int32 // This field is set in ValidatePrereqs
+	// bakeStart is when every old instance was last seen in Standby with nothing else changing, zero until then
+	bakeStart time.Time
+	// committed is set once the old instances in Standby start being terminated, after which there's nothing to roll back to
+	committed bool
+}
+
+// NewRunner instantiates a new standby runner
+func NewRunner(ctx context.Context, opts *bouncer.RunnerOpts) (*Runner, error) {
+	// Rolling back by bringing the old instances out of Standby is the point of this mode, so it's always on
+	opts.AutoRollback = true
+
+	br, err := bouncer.NewBaseRunner(ctx, Mode, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting base runner")
+	}
+
+	r := Runner{
+		BaseRunner: *br,
+	}
+	return &r, nil
+}
+
+// ValidatePrereqs checks that the standby runner is safe to proceed
+func (r *Runner) ValidatePrereqs(ctx context.Context) error {
+	asgSet, err := r.NewASGSet(ctx)
+	if err != nil {
+		return errors.Wrap(err, "error building actualASG")
+	}
+
+	r.batchSize, err = r.ValidatePoolPrereqs(asgSet)
+	return err
+}
+
+// wait is WaitOrRollBack until the old instances in Standby start being terminated, and Wait after that
+func (r *Runner) wait(ctx context.Context) error {
+	if r.committed {
+		return r.Wait(ctx)
+	}
+	return r.WaitOrRollBack(ctx)
+}
+
+// Run surges a batch of new nodes at a time, and once they're healthy, moves as many old nodes to Standby with
+// decrement.  Once every old node is in Standby and nothing has changed for the bake time, they're terminated.
+// Until then, a failure brings the old nodes back out of Standby and terminates the new ones
+func (r *Runner) Run() error {
+	ctx, cancel := r.NewContext()
+	defer cancel()
+
+	for {
+		// Rebuild the state of the world every iteration of the loop because instance and ASG statuses are changing
+		log.Debug("Beginning new standby run check")
+		asgSet, err := r.NewASGSet(ctx)
+		if err != nil {
+			return errors.Wrap(err, "error building ASGSet")
+		}
+
+		// This check already prints statuses of individual nodes
+		if asgSet.IsTransient() {
+			// Only time with nothing changing counts towards the bake
+			r.bakeStart = time.Time{}
+			log.Info("Waiting for nodes to settle")
+			err = r.wait(ctx)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Every ASG is one pool, so the capacities, counts and batch are all across the whole set
+		curDesiredCapacity, finDesiredCapacity := asgSet.PoolCapacity()
+		standby := r.StandbyInstances(asgSet)
+
+		// Old instances already in Standby before bouncer started are left alone
+		var oldHealthy []*bouncer.Instance
+		oldCount := int32(0)
+		for _, inst := range asgSet.GetOldInstances() {
+			if inst.InStandby() {
+				continue
+			}
+			oldCount++
+			if inst.IsHealthy {
+				oldHealthy = append(oldHealthy, inst)
+			}
+		}
+		healthyCount := int32(len(asgSet.GetHealthyNewInstances()) + len(oldHealthy))
+
+		if oldCount == 0 {
+			// Any surge left is in ASGs that had no old instances left to move to Standby
+			if curDesiredCapacity > finDesiredCapacity {
+				log.Info("Removing surge left over in the pool")
+				capacities := make(map[string]int32)
+				for _, asg := range asgSet.ASGs {
+					capacities[*asg.ASG.AutoScalingGroupName] = asg.DesiredASG.DesiredCapacity
+				}
+
+				err = r.ScaleInPool(ctx, asgSet, capacities)
+				if err != nil {
+					return errors.Wrap(err, "error killing instance")
+				}
+
+				ctx, cancel = r.NewContext()
+				defer cancel()
+				err = r.wait(ctx)
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			// Our exit case - every old node in service has been replaced, and the ones bouncer put in Standby are gone
+			if len(standby) == 0 {
+				log.Info("Didn't find any old instances or ASGs - we're done here!")
+				return nil
+			}
+
+			if r.bakeStart.IsZero() {
+				r.bakeStart = time.Now()
+				log.WithFields(log.Fields{
+					"Bake time":     r.Opts.BakeTime,
+					"Standby nodes": len(standby),
+				}).Info("Every old node is in standby, baking the new ones")
+			}
+
+			// The noop projection doesn't run on the wall clock, so there's nothing to wait out
+			if !r.Opts.Noop && time.Since(r.bakeStart) < r.Opts.BakeTime {
+				// The timeout is for changes settling, so it starts over every check while baking
+				ctx, cancel = r.NewContext()
+				defer cancel()
+				err = r.wait(ctx)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			log.Info("Bake finished, terminating the old nodes in standby")
+			r.committed = true
+			for _, inst := range standby {
+				// Instances in Standby don't count towards desired capacity, so there's nothing to decrement
+				decrement := false
+				err := r.KillInstance(ctx, inst, &decrement)
+				if err != nil {
+					return errors.Wrap(err, "error killing instance")
+				}
+			}
+
+			ctx, cancel = r.NewContext()
+			defer cancel()
+			err = r.wait(ctx)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		// Scale-out a batch, as big as the number of old nodes left to replace, up to the batch size
+		maxDesiredCapacity := finDesiredCapacity + min(r.batchSize, oldCount)
+		if curDesiredCapacity < maxDesiredCapacity {
+			log.WithFields(log.Fields{
+				"Batch size given":       r.batchSize,
+				"Old machines remaining": oldCount,
+				"Max descap":             maxDesiredCapacity,
+				"Current batch size":     maxDesiredCapacity - curDesiredCapacity,
+			}).Info("Adding a batch of new nodes")
+
+			capacities, err := asgSet.SpreadCapacity(maxDesiredCapacity - curDesiredCapacity)
+			if err != nil {
+				return errors.Wrap(err, "error spreading batch across ASGs")
+			}
+
+			err = r.SetPoolCapacity(ctx, asgSet, capacities)
+			if err != nil {
+				return errors.Wrap(err, "error setting desired capacity")
+			}
+
+			ctx, cancel = r.NewContext()
+			defer cancel()
+			err = r.wait(ctx)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		// The batch is healthy, so move as many old nodes to Standby
+		extraNodes := healthyCount - finDesiredCapacity
+		if extraNodes > 0 && len(oldHealthy) > 0 {
+			log.WithFields(log.Fields{
+				"Old nodes":     oldCount,
+				"Healthy nodes": healthyCount,
+				"Extra nodes":   extraNodes,
+			}).Info("Moving a batch of old nodes to standby")
+
+			withDecrement, withoutDecrement := asgSet.PickPoolVictims(oldHealthy, extraNodes)
+			err = r.EnterStandby(ctx, withDecrement, true)
+			if err == nil {
+				err = r.EnterStandby(ctx, withoutDecrement, false)
+			}
+			if err != nil {
+				return errors.Wrap(err, "error moving instances to standby")
+			}
+
+			ctx, cancel = r.NewContext()
+			defer cancel()
+			err = r.wait(ctx)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		// Not sure how this would happen off-hand?
+		log.WithFields(log.Fields{
+			"Current desired capacity": curDesiredCapacity,
+			"Final desired capacity":   finDesiredCapacity,
+			"Old nodes":                oldCount,
+			"Healthy nodes":            healthyCount,
+			"Extra nodes":              extraNodes,
+		}).Error("Unknown condition hit")
+		return errors.New("undefined error")
+	}
+}
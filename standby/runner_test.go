@@ -0,0 +1,172 @@
+// Copyright 2017 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package standby
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	at "github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
+	"github.com/palantir/bouncer/bouncer"
+	"github.com/palantir/bouncer/simulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRunner returns a runner against the simulator which, unless opts say otherwise, checks it every millisecond
+// and gives each change a minute
+func newTestRunner(t *testing.T, sim *simulator.Simulator, opts bouncer.RunnerOpts) *Runner {
+	t.Helper()
+	opts.Clients = sim.Clients()
+	if opts.CheckInterval == 0 {
+		opts.CheckInterval = time.Millisecond
+	}
+	if opts.ItemTimeout == 0 {
+		opts.ItemTimeout = time.Minute
+	}
+
+	r, err := NewRunner(context.Background(), &opts)
+	require.NoError(t, err)
+	return r
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	sim, err := simulator.NewWithOldASGs(simulator.ASGConfig{
+		Name:            "test-asg",
+		MinSize:         2,
+		MaxSize:         6,
+		DesiredCapacity: 4,
+	})
+	require.NoError(t, err)
+
+	batchSize := int32(2)
+	r := newTestRunner(t, sim, bouncer.RunnerOpts{
+		AsgString: "test-asg:4",
+		BatchSize: &batchSize,
+		BakeTime:  10 * time.Millisecond,
+	})
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	require.NoError(t, r.Run())
+
+	assert.Equal(t, 0, sim.OldInstanceCount("test-asg"))
+	assert.Len(t, sim.InstanceStates("test-asg"), 4)
+	assert.Equal(t, int32(4), sim.DesiredCapacity("test-asg"))
+	// Every old instance is still running, in standby, when the second batch comes up
+	assert.Equal(t, simulator.Stats{MaxInstances: 8, MinInService: 4}, sim.Stats("test-asg"))
+
+	// Nothing is terminated until every old instance is in standby
+	var standby, terminated int
+	for _, action := range r.Actions() {
+		switch action.Kind {
+		case bouncer.ActionEnterStandby:
+			assert.Zero(t, terminated)
+			assert.True(t, action.Decrement)
+			standby++
+		case bouncer.ActionTerminateInstance:
+			assert.False(t, action.Decrement)
+			terminated++
+		}
+	}
+	assert.Equal(t, 4, standby)
+	assert.Equal(t, 4, terminated)
+}
+
+func TestRunRollBack(t *testing.T) {
+	ctx := context.Background()
+	sim, err := simulator.NewWithOldASGs(simulator.ASGConfig{
+		Name:            "test-asg",
+		MinSize:         2,
+		MaxSize:         6,
+		DesiredCapacity: 4,
+	})
+	require.NoError(t, err)
+	oldStates := sim.InstanceStates("test-asg")
+
+	// Only the first batch of new instances passes validation, by which point half the old ones are in standby
+	dir := t.TempDir()
+	validate := fmt.Sprintf(`sh -c 'n=$(ls %s | wc -l); touch %s/$0; [ $n -lt 2 ]'`, dir, dir)
+
+	batchSize := int32(2)
+	r := newTestRunner(t, sim, bouncer.RunnerOpts{
+		AsgString:       "test-asg:4",
+		BatchSize:       &batchSize,
+		ValidateCommand: validate,
+	})
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	err = r.Run()
+
+	require.Error(t, err)
+	assert.True(t, bouncer.IsRollback(err))
+	for i := 0; i < 10; i++ {
+		sim.Tick()
+	}
+
+	// The old instances are back in service, and the new ones are gone
+	assert.Equal(t, int32(4), sim.DesiredCapacity("test-asg"))
+	assert.Equal(t, oldStates, sim.InstanceStates("test-asg"))
+
+	var restored int
+	for _, action := range r.Actions() {
+		if action.Kind == bouncer.ActionExitStandby {
+			restored++
+		}
+	}
+	assert.Equal(t, 2, restored)
+
+	for _, state := range sim.InstanceStates("test-asg") {
+		assert.Equal(t, at.LifecycleStateInService, state)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	ctx := context.Background()
+	sim, err := simulator.NewWithOldASGs(simulator.ASGConfig{
+		Name:            "test-asg",
+		MinSize:         2,
+		MaxSize:         6,
+		DesiredCapacity: 4,
+	})
+	require.NoError(t, err)
+
+	batchSize := int32(2)
+	r := newTestRunner(t, sim, bouncer.RunnerOpts{
+		Noop:      true,
+		AsgString: "test-asg:4",
+		BatchSize: &batchSize,
+		BakeTime:  time.Hour,
+	})
+	require.NoError(t, r.ValidatePrereqs(ctx))
+	require.NoError(t, r.Run())
+
+	plan := r.Plan()
+	require.Len(t, plan, 5)
+
+	var desired []int32
+	for i, phase := range plan {
+		assert.Equal(t, i+1, phase.Phase)
+		assert.GreaterOrEqual(t, phase.MinInService, int32(4))
+		desired = append(desired, phase.DesiredCapacity)
+	}
+	assert.Equal(t, []int32{6, 4, 6, 4, 4}, desired)
+
+	assert.Len(t, plan[1].Standby, 2)
+	assert.True(t, plan[1].Decrement)
+	assert.Len(t, plan[3].Standby, 2)
+	assert.Empty(t, plan[3].Terminate)
+	assert.Len(t, plan[4].Terminate, 4)
+	assert.False(t, plan[4].Decrement)
+}